@@ -0,0 +1,151 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// AIBackendEnv names the environment variable that picks the backend
+// RouteWithOptions uses when none is set: `codex` (the default), `openai`
+// (see DefaultOpenAIBackend) or `cmd` (see DefaultCommandBackend). When it is
+// unset and AICommandEnv is set, `cmd` is used.
+const AIBackendEnv = "GOSH_AI_BACKEND"
+
+// AICommandEnv names the environment variable holding the command template
+// of DefaultCommandBackend.
+const AICommandEnv = "GOSH_AI_CMD"
+
+// promptPlaceholder is replaced by the prompt in command templates.
+const promptPlaceholder = "{prompt}"
+
+// CommandBackend sends non-deterministic inputs to any command line AI tool.
+// Template is split like a command line, and `{prompt}` in any argument is
+// replaced by the prompt, as in `claude -p {prompt}`. Without a placeholder
+// the prompt is written to the command's stdin.
+type CommandBackend struct {
+	Template string
+	Dir      string
+	Stdout   io.Writer
+	Stderr   io.Writer
+}
+
+// DefaultCommandBackend returns a command backend with the template in
+// AICommandEnv.
+func DefaultCommandBackend() CommandBackend {
+	return CommandBackend{
+		Template: os.Getenv(AICommandEnv),
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}
+}
+
+// Run invokes the command for one unmatched input.
+func (b CommandBackend) Run(ctx context.Context, input string) error {
+	_, err := b.RunSession(ctx, RouteResult{Kind: RouteNeedsAI, Input: input})
+	return err
+}
+
+// RunSession invokes the command for a routed input and records the
+// session.
+func (b CommandBackend) RunSession(ctx context.Context, result RouteResult) (*AISession, error) {
+	session := newAISession("cmd", result)
+	session.Config = map[string]string{"template": b.Template}
+	session.Prompt = codexPrompt(result.Input)
+	cmd, err := b.command(ctx, session.Prompt)
+	if err != nil {
+		return session, session.finish(err)
+	}
+	if cmd.Dir != "" {
+		session.Dir = cmd.Dir
+	}
+	stdout, doneStdout := session.capture(defaultWriter(b.Stdout, os.Stdout), &session.Stdout)
+	stderr, doneStderr := session.capture(cmd.Stderr, &session.Stderr)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err = cmd.Run()
+	doneStdout()
+	doneStderr()
+	return session, session.finish(err)
+}
+
+// Plan runs the command with the planner prompt and returns its output, so
+// the backend can serve as a PlanBackend's Planner.
+func (b CommandBackend) Plan(ctx context.Context, input string, tools []ToolInfo) (string, error) {
+	prompt, err := plannerPrompt(input, tools)
+	if err != nil {
+		return "", err
+	}
+	cmd, err := b.command(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (b CommandBackend) command(ctx context.Context, prompt string) (*exec.Cmd, error) {
+	if strings.TrimSpace(b.Template) == "" {
+		return nil, fmt.Errorf("command backend: no command template; set %s", AICommandEnv)
+	}
+	args, err := SplitArgs(b.Template)
+	if err != nil {
+		return nil, fmt.Errorf("command backend: %w", err)
+	}
+	placeholder := false
+	for i, arg := range args {
+		if strings.Contains(arg, promptPlaceholder) {
+			args[i] = strings.ReplaceAll(arg, promptPlaceholder, prompt)
+			placeholder = true
+		}
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = defaultWriter(b.Stderr, os.Stderr)
+	cmd.Dir = b.Dir
+	if placeholder {
+		cmd.Stdin = os.Stdin
+	} else {
+		cmd.Stdin = strings.NewReader(prompt)
+	}
+	return cmd, nil
+}
+
+// selectAIBackend returns the backend named by AIBackendEnv, configured
+// with the route's policy, approver and writers, and the same backend as a
+// Planner.
+func selectAIBackend(options RouteOptions) (AIBackend, Planner, error) {
+	stdout := defaultWriter(options.Stdout, os.Stdout)
+	stderr := defaultWriter(options.Stderr, os.Stderr)
+	name := strings.ToLower(os.Getenv(AIBackendEnv))
+	if name == "" && os.Getenv(AICommandEnv) != "" {
+		name = "cmd"
+	}
+	switch name {
+	case "", "codex":
+		codex := DefaultCodexBackend()
+		codex.Stdout, codex.Stderr = stdout, stderr
+		return codex, CodexPlanner{Codex: codex}, nil
+	case "openai":
+		openai := DefaultOpenAIBackend()
+		openai.Policy, openai.Approver = options.Policy, options.Approver
+		openai.Stdout, openai.Stderr = stdout, stderr
+		return openai, openai, nil
+	case "cmd":
+		command := DefaultCommandBackend()
+		command.Stdout, command.Stderr = stdout, stderr
+		return command, command, nil
+	}
+	return nil, nil, fmt.Errorf("unknown %s %q: expected codex, openai or cmd", AIBackendEnv, name)
+}
+
+// errBackend is an AIBackend that fails with err.
+type errBackend struct{ err error }
+
+func (b errBackend) Run(context.Context, string) error { return b.err }
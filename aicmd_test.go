@@ -0,0 +1,61 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCommandBackendPassesPrompt(t *testing.T) {
+	var stdout bytes.Buffer
+	backend := CommandBackend{Template: `sh -c 'printf "%s" "$1"' sh {prompt}`, Stdout: &stdout}
+	if err := backend.Run(context.Background(), "explain the repo"); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "User input:\nexplain the repo") {
+		t.Fatalf("placeholder prompt = %q", stdout.String())
+	}
+
+	backend = CommandBackend{Template: "cat"}
+	script, err := backend.Plan(context.Background(), "release it", Tools())
+	if err != nil || !strings.Contains(script, "Plan the user's request") || !strings.Contains(script, "release it") {
+		t.Fatalf("stdin prompt = %q, %v", script, err)
+	}
+
+	if err := (CommandBackend{}).Run(context.Background(), "x"); err == nil || !strings.Contains(err.Error(), AICommandEnv) {
+		t.Fatalf("missing template error = %v", err)
+	}
+}
+
+func TestSelectAIBackend(t *testing.T) {
+	t.Setenv(AICommandEnv, "")
+	cases := map[string]string{"": "gosh.CodexBackend", "codex": "gosh.CodexBackend", "OpenAI": "gosh.OpenAIBackend", "cmd": "gosh.CommandBackend"}
+	for name, want := range cases {
+		t.Setenv(AIBackendEnv, name)
+		backend, planner, err := selectAIBackend(RouteOptions{Policy: ReadOnlyPolicy()})
+		if err != nil || typeName(backend) != want || planner == nil {
+			t.Fatalf("%s=%q: %s, %v", AIBackendEnv, name, typeName(backend), err)
+		}
+		if openai, ok := backend.(OpenAIBackend); ok && openai.Policy.MaxCallRisk != RiskLow {
+			t.Fatalf("openai backend policy = %+v", openai.Policy)
+		}
+	}
+
+	t.Setenv(AIBackendEnv, "")
+	t.Setenv(AICommandEnv, "claude -p {prompt}")
+	if backend, _, _ := selectAIBackend(RouteOptions{}); typeName(backend) != "gosh.CommandBackend" {
+		t.Fatalf("%s alone = %s", AICommandEnv, typeName(backend))
+	}
+
+	t.Setenv(AIBackendEnv, "bogus")
+	err := RouteWithOptions(context.Background(), "qqqq zzzz", RouteOptions{Policy: DefaultPolicy()})
+	if err == nil || !strings.Contains(err.Error(), `unknown GOSH_AI_BACKEND "bogus"`) {
+		t.Fatalf("unknown backend error = %v", err)
+	}
+}
+
+func typeName(value interface{}) string {
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,176 @@
+package gosh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AssumeYesEnv names the environment variable that, when true, approves every
+// command like the `--yes` flag.
+const AssumeYesEnv = "GOSH_ASSUME_YES"
+
+// ErrNotApproved is returned by approvers that decline a command.
+var ErrNotApproved = errors.New("not approved")
+
+// Approver decides whether a command that needs approval may run. Commands
+// need approval when their RouteResult has RequiresApproval set or high risk.
+// Approve returns nil to let the command run, or an error saying why not.
+type Approver interface {
+	Approve(ctx context.Context, result RouteResult) error
+}
+
+// ApproverFunc adapts a function to the Approver interface.
+type ApproverFunc func(ctx context.Context, result RouteResult) error
+
+// Approve calls f.
+func (f ApproverFunc) Approve(ctx context.Context, result RouteResult) error {
+	return f(ctx, result)
+}
+
+// AssumeYes approves every command.
+var AssumeYes Approver = ApproverFunc(func(context.Context, RouteResult) error {
+	return nil
+})
+
+// ApprovalError reports a script line or command that needed approval and
+// did not get it.
+type ApprovalError struct {
+	Line   int
+	File   string
+	Input  string
+	Result RouteResult
+	Err    error
+}
+
+func (e *ApprovalError) Error() string {
+	where := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		where += " of " + e.File
+	}
+	return fmt.Sprintf("%v, %s\n[%s]", e.Err, where, e.Input)
+}
+
+func (e *ApprovalError) Unwrap() error {
+	return e.Err
+}
+
+// TTYApprover asks on a terminal before each command that needs approval,
+// showing the command, its risk and the reasons for it. Only `y` or `yes`
+// approves.
+type TTYApprover struct {
+	In  io.Reader // defaults to os.Stdin
+	Out io.Writer // defaults to os.Stderr
+}
+
+// Approve prompts for one command and reads the answer.
+func (a TTYApprover) Approve(ctx context.Context, result RouteResult) error {
+	in := a.In
+	if in == nil {
+		in = os.Stdin
+	}
+	out := defaultWriter(a.Out, os.Stderr)
+
+	if strings.Contains(result.Input, "\n") {
+		writef(out, "gosh: approve these lines?\n    %s\n", strings.ReplaceAll(result.Input, "\n", "\n    "))
+	} else {
+		writef(out, "gosh: approve %s?\n", result.Input)
+	}
+	writef(out, "  risk: %s", result.Risk)
+	if result.RequiresApproval {
+		writef(out, " (requires approval)")
+	}
+	writef(out, "\n")
+	if len(result.RiskReasons) == 0 && result.Reason != "" {
+		writef(out, "  reason: %s\n", result.Reason)
+	}
+	for _, reason := range result.RiskReasons {
+		writef(out, "  reason: %s\n", reason)
+	}
+	writef(out, "[y/N] ")
+
+	answer, err := readAnswer(in)
+	if err != nil && answer == "" {
+		writef(out, "\n")
+		return fmt.Errorf("%w: %v", ErrNotApproved, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrNotApproved
+}
+
+// readAnswer reads one line a byte at a time, so nothing after it is
+// consumed from in.
+func readAnswer(in io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
+
+// CLIApprover returns the approver gosh's command line uses: AssumeYes when
+// assumeYes is set or AssumeYesEnv is true, a TTYApprover on in and out when
+// in is a terminal, and otherwise one that declines every command needing
+// approval.
+func CLIApprover(in *os.File, out io.Writer, assumeYes bool) Approver {
+	if assumeYes || envTrue(AssumeYesEnv) {
+		return AssumeYes
+	}
+	if isTerminal(in) {
+		return TTYApprover{In: in, Out: out}
+	}
+	return ApproverFunc(func(context.Context, RouteResult) error {
+		return fmt.Errorf("%w: stdin is not a terminal; use --yes or %s to approve", ErrNotApproved, AssumeYesEnv)
+	})
+}
+
+// needsApproval reports whether a routable command must be approved before
+// it runs.
+func needsApproval(result RouteResult) bool {
+	return result.Kind != RouteRejected && (result.RequiresApproval || result.Risk == RiskHigh)
+}
+
+// approve asks approver about result, if it needs approval.
+func approve(ctx context.Context, approver Approver, result RouteResult) error {
+	if approver == nil || !needsApproval(result) {
+		return nil
+	}
+	ctx = scriptContext(ctx)
+	return approver.Approve(ctx, result.masked(contextSecrets(ctx)))
+}
+
+func envTrue(name string) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if strings.EqualFold(value, "yes") || strings.EqualFold(value, "y") {
+		return true
+	}
+	ok, _ := strconv.ParseBool(value)
+	return ok
+}
+
+func isTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,128 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTTYApproverPromptsAndReadsOneAnswer(t *testing.T) {
+	in := strings.NewReader("y\nno\n")
+	var out bytes.Buffer
+	approver := TTYApprover{In: in, Out: &out}
+	result := RouteResult{Input: "rm -rf build", Risk: RiskHigh, RiskReasons: []string{"rm: high by rule destructive, deletes files"}}
+
+	if err := approver.Approve(context.Background(), result); err != nil {
+		t.Fatalf("yes answer = %v", err)
+	}
+	for _, want := range []string{"approve rm -rf build?", "risk: high", "deletes files", "[y/N]"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("prompt %q missing %q", out.String(), want)
+		}
+	}
+	if err := approver.Approve(context.Background(), result); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("no answer = %v", err)
+	}
+	if err := approver.Approve(context.Background(), result); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("EOF = %v", err)
+	}
+}
+
+func TestCLIApprover(t *testing.T) {
+	t.Setenv(AssumeYesEnv, "")
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	result := RouteResult{Input: "GoshTypedDeployTest prod 1", Risk: RiskHigh}
+
+	err = CLIApprover(f, &bytes.Buffer{}, false).Approve(context.Background(), result)
+	if !errors.Is(err, ErrNotApproved) || !strings.Contains(err.Error(), "not a terminal") {
+		t.Fatalf("non-interactive = %v", err)
+	}
+	if err := CLIApprover(f, &bytes.Buffer{}, true).Approve(context.Background(), result); err != nil {
+		t.Fatalf("--yes = %v", err)
+	}
+	t.Setenv(AssumeYesEnv, "1")
+	if err := CLIApprover(f, &bytes.Buffer{}, false).Approve(context.Background(), result); err != nil {
+		t.Fatalf("%s = %v", AssumeYesEnv, err)
+	}
+}
+
+func TestScriptAsksApproverForRiskyLines(t *testing.T) {
+	var asked []string
+	approver := ApproverFunc(func(ctx context.Context, result RouteResult) error {
+		asked = append(asked, result.Input)
+		if result.Args[0] == "prod" {
+			return ErrNotApproved
+		}
+		return nil
+	})
+	typedToolEnv = ""
+	err := RunWithOptions(context.Background(), "set x = 1\nGoshTypedDeployTest staging 2", ScriptOptions{Approver: approver})
+	if err != nil || typedToolEnv != "staging" {
+		t.Fatalf("approved line: err=%v env=%q", err, typedToolEnv)
+	}
+
+	err = RunWithOptions(context.Background(), "GoshTypedDeployTest prod 2", ScriptOptions{Approver: approver})
+	var approvalErr *ApprovalError
+	if !errors.As(err, &approvalErr) || !errors.Is(err, ErrNotApproved) || approvalErr.Line != 0 || typedToolEnv != "staging" {
+		t.Fatalf("declined line: err=%v env=%q", err, typedToolEnv)
+	}
+	if strings.Join(asked, "|") != "GoshTypedDeployTest staging 2|GoshTypedDeployTest prod 2" {
+		t.Fatalf("asked = %q", asked)
+	}
+}
+
+func TestRouteAsksApprover(t *testing.T) {
+	declined := ApproverFunc(func(context.Context, RouteResult) error { return ErrNotApproved })
+	err := RouteWithOptions(context.Background(), "GoshTypedDeployTest prod 1", RouteOptions{Approver: declined})
+	if !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestMCPAsksApproverWithinGates(t *testing.T) {
+	var asked RouteResult
+	approver := ApproverFunc(func(ctx context.Context, result RouteResult) error {
+		asked = result
+		return nil
+	})
+	_, rpcErr := callMCPToolWithOptions("GoshTypedDeployTest", map[string]interface{}{"env": "prod", "count": 3}, MCPOptions{Approver: AssumeYes})
+	if rpcErr == nil || rpcErr.Message != "Tool requires approval" {
+		t.Fatalf("an approver lifted the MCP gates: %+v", rpcErr)
+	}
+
+	gates := MCPOptions{AllowApprovalRequired: true, AllowHighRisk: true}
+	gates.Approver = approver
+	result, rpcErr := callMCPToolWithOptions("GoshTypedDeployTest", map[string]interface{}{"env": "prod", "count": 3}, gates)
+	if rpcErr != nil || result.(map[string]interface{})["isError"] != false {
+		t.Fatalf("result=%v err=%+v", result, rpcErr)
+	}
+	if asked.Command != "GoshTypedDeployTest" || asked.Risk != RiskHigh || !asked.RequiresApproval {
+		t.Fatalf("asked = %+v", asked)
+	}
+
+	declined := ApproverFunc(func(context.Context, RouteResult) error { return ErrNotApproved })
+	gates.Approver = declined
+	_, rpcErr = callMCPToolWithOptions("GoshTypedDeployTest", map[string]interface{}{"env": "prod", "count": 3}, gates)
+	if rpcErr == nil || rpcErr.Message != "Tool not approved" {
+		t.Fatalf("declined = %+v", rpcErr)
+	}
+}
+
+func TestParseCLIFlags(t *testing.T) {
+	t.Setenv(PolicyEnv, "safe")
+	args, flags, err := ParseCLIFlags([]string{"--yes", "--policy=readonly", "ls", "--yes"})
+	if err != nil || !flags.Yes || flags.Policy != "readonly" || strings.Join(args, " ") != "ls --yes" {
+		t.Fatalf("args=%q flags=%+v err=%v", args, flags, err)
+	}
+	if _, flags, _ := ParseCLIFlags([]string{"ls"}); flags.Yes || flags.Policy != "safe" {
+		t.Fatalf("env flags = %+v", flags)
+	}
+}
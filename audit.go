@@ -0,0 +1,194 @@
+package gosh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MCPAuditEnv names the environment variable holding the file `serve mcp`
+// appends its audit log to.
+const MCPAuditEnv = "GOSH_MCP_AUDIT"
+
+// Audit decisions and statuses.
+const (
+	AuditAllowed  = "allowed"  // the call ran without asking anyone
+	AuditApproved = "approved" // the call ran after the Approver agreed
+	AuditRejected = "rejected" // the call did not run
+
+	AuditOK    = "ok"    // the call ran and succeeded
+	AuditError = "error" // the call ran and failed
+)
+
+// redacted replaces the values of secret arguments in audit events.
+const redacted = "[REDACTED]"
+
+// MCPClientInfo identifies an MCP client, from its initialize request.
+type MCPClientInfo struct {
+	Name            string `json:"name,omitempty"`
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+}
+
+// MCPAuditEvent records one MCP tool call: who asked, what for, what the
+// server decided and how the call ended. Status is AuditOK or AuditError
+// for calls that ran and AuditRejected for those that did not.
+type MCPAuditEvent struct {
+	Time      time.Time              `json:"time"`
+	Client    MCPClientInfo          `json:"client"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Risk      RiskLevel              `json:"risk,omitempty"`
+	Decision  string                 `json:"decision"`
+	Reason    string                 `json:"reason,omitempty"`
+	Duration  time.Duration          `json:"duration_ns"`
+	Status    string                 `json:"status"`
+}
+
+// MCPAuditor receives an event for every MCP tool call.
+type MCPAuditor interface {
+	Audit(event MCPAuditEvent) error
+}
+
+// MCPAuditorFunc adapts a function to MCPAuditor.
+type MCPAuditorFunc func(event MCPAuditEvent) error
+
+// Audit calls f.
+func (f MCPAuditorFunc) Audit(event MCPAuditEvent) error {
+	return f(event)
+}
+
+// AuditLog is an MCPAuditor that writes each event as a line of JSON.
+type AuditLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewAuditLog returns an audit log writing to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog returns an audit log appending to the file at path.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{w: file, closer: file}, nil
+}
+
+// Audit writes one event.
+func (l *AuditLog) Audit(event MCPAuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file an OpenAuditLog log writes to.
+func (l *AuditLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// newMCPAuditEvent starts the event for a call, with secret arguments
+// redacted.
+func newMCPAuditEvent(name string, arguments map[string]interface{}, options MCPOptions) MCPAuditEvent {
+	event := MCPAuditEvent{Time: time.Now(), Client: options.client, Tool: name}
+	if options.Audit == nil {
+		return event
+	}
+	var params []ParamSpec
+	if call, ok := Calls[strings.ToLower(name)]; ok {
+		params = call.Tool.Params
+		event.Risk = call.Tool.Risk
+	}
+	event.Arguments = redactArguments(params, arguments)
+	return event
+}
+
+// audit completes an event from the call's result and sends it to the
+// auditor. Failures to record it are logged.
+func (o MCPOptions) audit(event *MCPAuditEvent, result interface{}, rpcErr *mcpError) {
+	if o.Audit == nil {
+		return
+	}
+	event.Duration = time.Since(event.Time)
+	response, _ := result.(map[string]interface{})
+	switch {
+	case rpcErr != nil:
+		event.Decision, event.Status = AuditRejected, AuditRejected
+		if event.Reason == "" {
+			event.Reason = rpcErr.Message
+			if rpcErr.Data != nil {
+				event.Reason += fmt.Sprintf(": %v", rpcErr.Data)
+			}
+		}
+	case event.Decision == AuditRejected:
+		event.Status = AuditRejected
+	case response["isError"] == true:
+		event.Status = AuditError
+	default:
+		event.Status = AuditOK
+	}
+	if event.Decision == "" {
+		event.Decision = AuditAllowed
+	}
+	// Secrets seen while the call ran, such as in a run_command line, are
+	// masked too.
+	for name, value := range event.Arguments {
+		if text, ok := value.(string); ok {
+			event.Arguments[name] = o.secrets.mask(text)
+		}
+	}
+	event.Reason = o.secrets.mask(event.Reason)
+	if err := o.Audit.Audit(*event); err != nil {
+		writef(defaultWriter(o.logs, os.Stderr), "gosh mcp audit: %v\n", err)
+	}
+}
+
+// secretName matches parameter names whose values are taken to be secret.
+var secretName = regexp.MustCompile(`(?i)(password|passwd|passphrase|secret|token|api_?key|credential|private_?key)`)
+
+// secretParam reports whether a parameter's values are kept out of logs:
+// those marked Secret and those named like secrets.
+func secretParam(param ParamSpec) bool {
+	return param.Secret || secretName.MatchString(param.Name)
+}
+
+// redactArguments copies arguments with the values of secret parameters,
+// and of arguments named like secrets, replaced.
+func redactArguments(params []ParamSpec, arguments map[string]interface{}) map[string]interface{} {
+	if len(arguments) == 0 {
+		return nil
+	}
+	secret := map[string]bool{}
+	for _, param := range params {
+		secret[param.Name] = secretParam(param)
+	}
+	out := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		if secret[name] || secretName.MatchString(name) {
+			value = redacted
+		}
+		out[name] = value
+	}
+	return out
+}
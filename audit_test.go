@@ -0,0 +1,126 @@
+package gosh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var _ = Tool("GoshAuditTestLogin", func(user string, apiToken string) {},
+	Desc("Log in for audit tests"),
+	Param("user"),
+	Param("api_token"),
+)
+
+var _ = Tool("GoshAuditTestWipe", func() {},
+	Desc("Wipe for audit tests"),
+	Risk(RiskHigh),
+)
+
+var _ = Tool("GoshAuditTestFail", func() error { return errors.New("boom") },
+	Desc("Fail for audit tests"),
+)
+
+func TestServeMCPAuditsToolCalls(t *testing.T) {
+	input := strings.Join([]string{
+		mcpFrame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","clientInfo":{"name":"test-client","version":"1.2"}}}`),
+		mcpFrame(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"GoshAuditTestLogin","arguments":{"user":"ann","api_token":"hunter2"}}}`),
+		mcpFrame(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"GoshAuditTestWipe","arguments":{}}}`),
+		mcpFrame(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"GoshAuditTestFail","arguments":{}}}`),
+		mcpFrame(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"GoshAuditTestMissing"}}`),
+	}, "")
+	var log bytes.Buffer
+	if err := ServeMCPWithOptions(strings.NewReader(input), &bytes.Buffer{}, &bytes.Buffer{}, MCPOptions{Audit: NewAuditLog(&log)}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(log.String(), "hunter2") {
+		t.Fatalf("audit log leaks a secret: %s", log.String())
+	}
+
+	var events []MCPAuditEvent
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var event MCPAuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("events = %+v", events)
+	}
+	login, wipe, fail, missing := events[0], events[1], events[2], events[3]
+	if login.Client != (MCPClientInfo{Name: "test-client", Version: "1.2", ProtocolVersion: "2025-06-18"}) ||
+		login.Decision != AuditAllowed || login.Status != AuditOK || login.Arguments["user"] != "ann" || login.Arguments["api_token"] != redacted {
+		t.Fatalf("login event = %+v", login)
+	}
+	if wipe.Decision != AuditRejected || wipe.Status != AuditRejected || wipe.Risk != RiskHigh || !strings.Contains(wipe.Reason, "High-risk tool disabled") {
+		t.Fatalf("wipe event = %+v", wipe)
+	}
+	if fail.Decision != AuditAllowed || fail.Status != AuditError {
+		t.Fatalf("fail event = %+v", fail)
+	}
+	if missing.Status != AuditRejected || !strings.Contains(missing.Reason, "Unknown tool") {
+		t.Fatalf("missing event = %+v", missing)
+	}
+}
+
+func TestMCPAuditRecordsApprovalsAndRunCommand(t *testing.T) {
+	var events []MCPAuditEvent
+	options := MCPOptions{
+		Approver:      AssumeYes,
+		AllowHighRisk: true,
+		RunCommand:    true,
+		Audit: MCPAuditorFunc(func(event MCPAuditEvent) error {
+			events = append(events, event)
+			return nil
+		}),
+	}
+	if _, rpcErr := callMCPToolWithOptions("GoshAuditTestWipe", nil, options); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if _, rpcErr := callRunCommand(map[string]interface{}{"command": "gosh-audit-test-missing"}, options); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if len(events) != 2 || events[0].Decision != AuditApproved || events[0].Status != AuditOK {
+		t.Fatalf("events = %+v", events)
+	}
+	if run := events[1]; run.Tool != runCommandToolName || run.Decision != AuditRejected || run.Status != AuditRejected ||
+		run.Arguments["command"] != "gosh-audit-test-missing" || run.Reason == "" {
+		t.Fatalf("run_command event = %+v", run)
+	}
+}
+
+func TestOpenAuditLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "mcp.jsonl")
+	for i := 0; i < 2; i++ {
+		log, err := OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, rpcErr := callMCPToolWithOptions("GoshAuditTestFail", nil, MCPOptions{Audit: log}); rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || strings.Count(string(data), "\n") != 2 {
+		t.Fatalf("audit file = %q, %v", data, err)
+	}
+
+	var logs bytes.Buffer
+	failing := MCPAuditorFunc(func(MCPAuditEvent) error { return errors.New("disk full") })
+	if _, rpcErr := callMCPToolWithOptions("GoshAuditTestFail", nil, MCPOptions{Audit: failing, logs: &logs}); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if !strings.Contains(logs.String(), "gosh mcp audit: disk full") {
+		t.Fatalf("logs = %q", logs.String())
+	}
+}
@@ -0,0 +1,300 @@
+package gosh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diagnostic is one problem Check found in a script. Lines and columns start
+// at 1, as editors count them. Code is one of parse, unknown-command,
+// invalid-args, undefined-var, policy or error.
+type Diagnostic struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	file := d.File
+	if file == "" {
+		file = "<script>"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s [%s]", file, d.Line, d.Column, d.Message, d.Code)
+}
+
+// CheckOptions configures CheckWithOptions.
+type CheckOptions struct {
+	// File names the script in diagnostics.
+	File string
+
+	// Policy, when set, reports lines it would reject.
+	Policy *Policy
+
+	// Env lists the variables that are set before the script starts. Nil
+	// uses the names in the process environment.
+	Env []string
+}
+
+// Check finds problems in a script without running it: lines that do not
+// parse, unknown commands, invalid arguments to registered commands and
+// variables used without being set.
+func Check(script string) []Diagnostic {
+	return CheckWithOptions(script, CheckOptions{})
+}
+
+// CheckWithOptions checks a script like Check. It walks the script as a dry
+// run, following cd, pushd, set and source, and also checks the bodies of
+// functions the script never calls.
+func CheckWithOptions(script string, options CheckOptions) []Diagnostic {
+	lines := strings.Split(strings.ReplaceAll(script, "\r\n", "\n"), "\n")
+	check := &scriptCheck{
+		lines:  map[string][]string{options.File: lines},
+		seen:   map[Diagnostic]bool{},
+		walked: map[*scriptFunc]bool{},
+	}
+	s := newScript(context.Background(), ScriptOptions{Policy: options.Policy, DryRun: true, OnPlan: check.step})
+	if options.Env != nil {
+		s.env = make(map[string]string, len(options.Env))
+		for _, name := range options.Env {
+			s.env[name] = ""
+		}
+	}
+	if options.File != "" {
+		s.file = options.File
+		s.args = []string{options.File}
+	}
+	s.check = check
+	s.onErr = check.err
+	for _, line := range parseScriptLines(lines) {
+		s.runLine(line)
+	}
+	return check.diags
+}
+
+// scriptCheck collects diagnostics for the line being walked.
+type scriptCheck struct {
+	file   string
+	line   int
+	lines  map[string][]string // physical lines by file
+	seen   map[Diagnostic]bool
+	diags  []Diagnostic
+	walked map[*scriptFunc]bool
+}
+
+// at moves to a line and returns a function that moves back.
+func (c *scriptCheck) at(file string, line int) func() {
+	prevFile, prevLine := c.file, c.line
+	c.file, c.line = file, line
+	return func() {
+		c.file, c.line = prevFile, prevLine
+	}
+}
+
+// add records a diagnostic at byte offset col of the current line, or at its
+// first word when col is negative.
+func (c *scriptCheck) add(code string, col int, message string) {
+	text := c.lineText()
+	if col < 0 || col > len(text) {
+		col = len(text) - len(strings.TrimLeft(text, " \t"))
+	}
+	d := Diagnostic{
+		File:    c.file,
+		Line:    c.line + 1,
+		Column:  utf8.RuneCountInString(text[:col]) + 1,
+		Code:    code,
+		Message: message,
+	}
+	if !c.seen[d] {
+		c.seen[d] = true
+		c.diags = append(c.diags, d)
+	}
+}
+
+func (c *scriptCheck) lineText() string {
+	lines, ok := c.lines[c.file]
+	if !ok {
+		if content, err := os.ReadFile(c.file); err == nil {
+			lines = strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+		}
+		c.lines[c.file] = lines
+	}
+	if c.line < len(lines) {
+		return lines[c.line]
+	}
+	return ""
+}
+
+func (c *scriptCheck) step(step PlanStep) {
+	text := c.lineText()
+	_, isCall := Calls[strings.ToLower(step.Command)]
+	unknown := step.Kind == RouteNeedsAI || (step.Kind == RouteRejected && !isCall && step.Executable == "")
+	switch {
+	case unknown:
+		message := fmt.Sprintf("unknown command %q", step.Command)
+		if hint := didYouMean(step.Suggestions); hint != "" {
+			message += "; " + hint
+		}
+		c.add("unknown-command", strings.Index(text, step.Command), message)
+	case step.Kind == RouteRejected && len(step.ValidationErrors) > 0:
+		c.add("invalid-args", -1, fmt.Sprintf("invalid arguments to %s: %s", step.Command, strings.Join(step.ValidationErrors, "; ")))
+	case step.Kind == RouteRejected:
+		c.add("policy", -1, step.Reason)
+	}
+}
+
+func (c *scriptCheck) err(err error) {
+	cause := err
+	if inner := errors.Unwrap(err); inner != nil {
+		cause = inner
+	}
+	if errors.Is(err, errIncomplete) {
+		c.add("parse", unmatchedQuote(c.lineText()), cause.Error())
+		return
+	}
+	c.add("error", -1, cause.Error())
+}
+
+// unsetVariable reports a variable expanded without a value while Check
+// walks the script.
+func (s *Script) unsetVariable(name string) {
+	if s.check == nil {
+		return
+	}
+	text := s.check.lineText()
+	col := strings.Index(text, "${"+name)
+	if col < 0 {
+		col = strings.Index(text, "$"+name)
+	}
+	s.check.add("undefined-var", col, fmt.Sprintf("variable %s is not set", name))
+}
+
+// checkFunc walks a function body when Check sees its definition, so
+// functions the script never calls are checked too. Parameters count as
+// set; variables the body sets stay set, as they would after a call.
+func (s *Script) checkFunc(def *scriptFunc) {
+	dirs := append([]string{}, s.dirs...)
+	if err := s.callFunc(def, make([]string, len(def.params))); err != nil {
+		s.reportErr(err)
+	}
+	s.dirs = dirs
+}
+
+// unmatchedQuote returns the offset of a quote that is never closed, or -1.
+func unmatchedQuote(text string) int {
+	var quote rune
+	open := -1
+	escaped := false
+	for i, ch := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote, open = ch, i
+		}
+	}
+	if quote == 0 {
+		return -1
+	}
+	return open
+}
+
+// runCheck implements the `check [--json] [files...]` meta command. Without
+// files it checks every registered script.
+func runCheck(w io.Writer, args []string, policy Policy) error {
+	asJSON := false
+	var files []string
+	for _, arg := range args {
+		if arg == "--json" {
+			asJSON = true
+		} else {
+			files = append(files, arg)
+		}
+	}
+
+	diags := []Diagnostic{}
+	if len(files) == 0 {
+		names := ScriptNames()
+		if len(names) == 0 {
+			return fmt.Errorf("check: no script files given and no scripts registered")
+		}
+		for _, name := range names {
+			diags = append(diags, CheckWithOptions(scripts[strings.ToLower(name)].text, CheckOptions{File: name, Policy: &policy})...)
+		}
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		diags = append(diags, CheckWithOptions(string(content), CheckOptions{File: file, Policy: &policy})...)
+	}
+
+	if asJSON {
+		if err := writeJSON(w, diags); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diags {
+			writef(w, "%s\n", d)
+		}
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("check found %d problem(s)", len(diags))
+	}
+	return nil
+}
+
+// registeredScript is a script stored with RegisterScript.
+type registeredScript struct {
+	name string
+	text string
+}
+
+var scripts = map[string]registeredScript{}
+
+// RegisterScript stores a named script, such as one embedded in the binary,
+// so the `check` meta command lints it and RunScript can run it by name.
+func RegisterScript(name string, script string) interface{} {
+	if name == "" {
+		panic("Cannot register a script with an empty name")
+	}
+	key := strings.ToLower(name)
+	if _, found := scripts[key]; found {
+		panic(fmt.Sprintf("Cannot register more than one script named '%s'", name))
+	}
+	scripts[key] = registeredScript{name: name, text: script}
+	return nil
+}
+
+// ScriptNames returns the names of registered scripts, sorted.
+func ScriptNames() []string {
+	names := make([]string, 0, len(scripts))
+	for _, script := range scripts {
+		names = append(names, script.name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names
+}
+
+// RunScript runs a registered script with explicit options.
+func RunScript(ctx context.Context, name string, options ScriptOptions) error {
+	script, ok := scripts[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("no script registered as %q", name)
+	}
+	return RunWithOptions(ctx, script.text, options)
+}
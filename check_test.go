@@ -0,0 +1,133 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var _ = RegisterScript("goshCheckTestScript", "set who = world\necho hello ${who}\n")
+
+func TestCheckFindsProblems(t *testing.T) {
+	script := strings.Join([]string{
+		"# typos only show up at run time",
+		"set name = gosh",
+		"goshPlanTestDeploy qa",
+		"  goHeloMissingCommand ${name}",
+		"echo ${nmae} ${name} ${maybe:-default} ${later:=x} ${later}",
+		"func greet who",
+		"  echo ${who} ${unknownInFunc}",
+		"end",
+		`ls "open`,
+	}, "\n")
+	got := CheckWithOptions(script, CheckOptions{File: "build.gosh", Env: []string{}})
+	want := []Diagnostic{
+		{File: "build.gosh", Line: 3, Column: 1, Code: "invalid-args"},
+		{File: "build.gosh", Line: 4, Column: 3, Code: "unknown-command"},
+		{File: "build.gosh", Line: 5, Column: 6, Code: "undefined-var"},
+		{File: "build.gosh", Line: 7, Column: 15, Code: "undefined-var"},
+		{File: "build.gosh", Line: 9, Column: 4, Code: "parse"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("diagnostics = %v", got)
+	}
+	for i := range want {
+		got[i].Message = ""
+		if got[i] != want[i] {
+			t.Fatalf("diagnostic %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckCleanScriptAndEnv(t *testing.T) {
+	if got := Check("set who = world\necho hello ${who}\npushd ..\npopd"); len(got) != 0 {
+		t.Fatalf("clean script = %v", got)
+	}
+	t.Setenv("GOSH_CHECK_TEST_VAR", "1")
+	if got := Check("echo ${GOSH_CHECK_TEST_VAR}"); len(got) != 0 {
+		t.Fatalf("process environment = %v", got)
+	}
+	if got := CheckWithOptions("echo ${GOSH_CHECK_TEST_VAR}", CheckOptions{Env: []string{}}); len(got) != 1 {
+		t.Fatalf("empty Env = %v", got)
+	}
+}
+
+func TestCheckFollowsSourceAndPolicy(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.gosh")
+	if err := os.WriteFile(lib, []byte("set from_lib = 1\n\nmissingLibCommand\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy := ReadOnlyPolicy()
+	got := CheckWithOptions("source "+lib+"\necho ${from_lib}\nrm x", CheckOptions{Policy: &policy})
+	if len(got) != 2 {
+		t.Fatalf("diagnostics = %v", got)
+	}
+	if got[0].File != lib || got[0].Line != 3 || got[0].Code != "unknown-command" {
+		t.Fatalf("sourced diagnostic = %+v", got[0])
+	}
+	if got[1].Line != 3 || got[1].Code != "policy" || !strings.Contains(got[1].Message, "readonly") {
+		t.Fatalf("policy diagnostic = %+v", got[1])
+	}
+}
+
+func TestCheckDoesNotRunCommands(t *testing.T) {
+	dir := t.TempDir()
+	planToolRuns, planHookRuns = nil, nil
+	Check("mkDir " + filepath.Join(dir, "made") + "\ngoshPlanTestDeploy prod\ntouch " + filepath.Join(dir, "touched"))
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 || planToolRuns != nil || planHookRuns != nil {
+		t.Fatalf("entries=%v err=%v runs=%q hooks=%q", entries, err, planToolRuns, planHookRuns)
+	}
+}
+
+func TestMenuCheck(t *testing.T) {
+	oldArgs := os.Args
+	oldDefaultErr := defaultErr
+	defer func() {
+		os.Args = oldArgs
+		defaultErr = oldDefaultErr
+	}()
+	var gotErr error
+	defaultErr = func(err error) { gotErr = err }
+
+	var out bytes.Buffer
+	os.Args = []string{"goshfile", "check"}
+	MenuWithOptions(MenuOptions{Stdout: &out})
+	if gotErr != nil || out.Len() != 0 {
+		t.Fatalf("registered scripts: out=%q err=%v", out.String(), gotErr)
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.gosh")
+	if err := os.WriteFile(path, []byte("echo ok\ngoshCheckMissing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"goshfile", "check", "--json", path}
+	MenuWithOptions(MenuOptions{Stdout: &out})
+	var diags []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &diags); err != nil || gotErr == nil {
+		t.Fatalf("out=%q unmarshal=%v err=%v", out.String(), err, gotErr)
+	}
+	if len(diags) != 1 || diags[0].String() != path+":2:1: unknown command \"goshCheckMissing\" [unknown-command]" {
+		t.Fatalf("diags = %v", diags)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	if names := ScriptNames(); len(names) == 0 || names[0] != "goshCheckTestScript" {
+		t.Fatalf("names = %q", names)
+	}
+	output, err := captureStdout(func() error {
+		return RunScript(context.Background(), "goshchecktestscript", ScriptOptions{})
+	})
+	if err != nil || output != "hello world\n" {
+		t.Fatalf("output=%q err=%v", output, err)
+	}
+	if err := RunScript(context.Background(), "missing", ScriptOptions{}); err == nil {
+		t.Fatal("expected error for missing script")
+	}
+}
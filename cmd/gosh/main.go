@@ -0,0 +1,172 @@
+// Command gosh runs gosh scripts without a Go toolchain.
+//
+//	gosh                      start an interactive prompt
+//	gosh script.gosh [args]   run a script file
+//	gosh -c 'script'          run script text
+//	gosh --resolve [input]    classify input as JSON without executing
+//	gosh tools --json         list exported tools as JSON
+//	gosh serve mcp            serve exported tools over MCP stdio; add
+//	                          --run-command for a policy-checked run_command tool
+//	gosh check file.gosh ...  lint scripts without running them
+//	gosh history [show id]    list or show journaled runs and AI sessions
+//	gosh rerun id             run a journaled command again
+//	gosh <command> [args]     run a builtin, plugin tool or executable
+//	gosh --policy name ...    apply a policy preset or file to any of the above
+//	gosh --yes ...            run commands that need approval without asking
+//	gosh --dry-run [--json] ...  show what a script or command would run
+//
+// Commands that require approval or have high risk are confirmed on the
+// terminal first; when stdin is not a terminal they are declined unless
+// --yes or GOSH_ASSUME_YES is given.
+//
+// When GOSH_HISTORY_DIR is set, commands run by scripts, routed inputs and
+// MCP tool calls are journaled there; GOSH_HISTORY_RETENTION bounds the
+// journal by entries or age.
+//
+// Script files can start with `#!/usr/bin/env gosh`. Go commands are added as
+// plugins: any `gosh-*` executable in GOSH_PLUGIN_PATH (or the gosh/plugins
+// user config directory) whose main calls gosh.Menu.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wthorp/gosh"
+)
+
+func main() {
+	os.Exit(run(os.Args, os.Stdin, os.Stderr))
+}
+
+func run(args []string, stdin *os.File, stderr io.Writer) int {
+	if err := gosh.LoadPlugins(); err != nil {
+		fmt.Fprintf(stderr, "gosh: %v\n", err)
+	}
+
+	rest, flags, err := gosh.ParseCLIFlags(args[1:])
+	if err != nil {
+		fmt.Fprintf(stderr, "gosh: %v\n", err)
+		return 2
+	}
+	journal, err := gosh.DefaultJournal()
+	if err != nil {
+		return report(stderr, err)
+	}
+	options := gosh.ScriptOptions{Approver: gosh.CLIApprover(stdin, stderr, flags.Yes), Journal: journal}
+	// With --json, the plan is collected and written once the script ends.
+	var steps []gosh.PlanStep
+	done := func(err error) int {
+		if flags.DryRun && flags.JSON {
+			if steps == nil {
+				steps = []gosh.PlanStep{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if encodeErr := encoder.Encode(steps); err == nil {
+				err = encodeErr
+			}
+		}
+		return report(stderr, err)
+	}
+	if flags.DryRun {
+		options.DryRun = true
+		if flags.JSON {
+			options.OnPlan = func(step gosh.PlanStep) { steps = append(steps, step) }
+		}
+	}
+	if flags.Policy != "" {
+		policy, err := gosh.LoadPolicy(flags.Policy)
+		if err != nil {
+			return report(stderr, err)
+		}
+		options.Policy = &policy
+	}
+	args = append(args[:1:1], rest...)
+
+	ctx := context.Background()
+	switch {
+	case len(args) <= 1:
+		if isTerminal(stdin) {
+			return done(gosh.REPL(ctx, stdin, stderr, options))
+		}
+		script, err := io.ReadAll(stdin)
+		if err != nil {
+			return report(stderr, err)
+		}
+		return done(gosh.RunWithOptions(ctx, string(script), options))
+	case args[1] == "-h" || args[1] == "--help":
+		fmt.Fprint(stderr, usage)
+		return 0
+	case args[1] == "-c":
+		if len(args) < 3 {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		return done(gosh.RunWithOptions(ctx, args[2], options))
+	case isScriptFile(args[1]):
+		return done(gosh.RunFile(ctx, args[1], args[2:], options))
+	default:
+		gosh.Menu()
+		return 0
+	}
+}
+
+const usage = `Usage:
+    gosh                      start an interactive prompt
+    gosh script.gosh [args]   run a script file
+    gosh -c 'script'          run script text
+    gosh --resolve [input]    classify input as JSON without executing
+    gosh tools --json         list exported tools as JSON
+    gosh serve mcp            serve exported tools over MCP stdio; add
+                              --run-command for a run_command tool checked
+                              by the policy (safe unless --policy is given);
+                              GOSH_MCP_AUDIT names a JSONL audit log file
+    gosh check file.gosh ...  lint scripts without running them; add --json
+                              for JSON
+    gosh history [show id]    list or show the runs and AI sessions
+                              journaled in GOSH_HISTORY_DIR, if it is set;
+                              --sessions lists the AI sessions alone; add
+                              --json for JSON
+    gosh rerun id             run a journaled command again, in the
+                              directory it ran in
+    gosh <command> [args]     run a builtin, plugin tool or executable
+    gosh --policy name ...    apply a policy preset (default, safe, readonly)
+                              or file to any of the above; also GOSH_POLICY
+    gosh --yes ...            run commands that need approval without asking;
+                              also GOSH_ASSUME_YES
+    gosh --dry-run ...        show how each line would run, without running
+                              it; add --json for JSON
+`
+
+// isScriptFile reports whether arg names a script rather than a command.
+func isScriptFile(arg string) bool {
+	if strings.HasSuffix(arg, ".gosh") {
+		return true
+	}
+	if !strings.ContainsAny(arg, `/\`) {
+		return false
+	}
+	info, err := os.Stat(arg)
+	return err == nil && !info.IsDir()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func report(stderr io.Writer, err error) int {
+	if err == nil {
+		return 0
+	}
+	fmt.Fprintf(stderr, "FAIL: %+v\n", err)
+	return 1
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsScriptFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recipe")
+	if err := os.WriteFile(path, []byte("echo hi\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"deploy.gosh": true,
+		path:          true,
+		dir:           false,
+		"echo":        false,
+		"./missing":   false,
+	}
+	for arg, want := range cases {
+		if got := isScriptFile(arg); got != want {
+			t.Fatalf("isScriptFile(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestRunScriptsAndReportsFailures(t *testing.T) {
+	t.Setenv("GOSH_PLUGIN_PATH", t.TempDir())
+	t.Setenv("GOSH_HISTORY_DIR", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fail.gosh")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env gosh\nmissing-command-for-gosh-binary\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if code := run([]string{"gosh", path}, os.Stdin, &stderr); code != 1 || !strings.Contains(stderr.String(), "FAIL") {
+		t.Fatalf("code=%d stderr=%q", code, stderr.String())
+	}
+	stderr.Reset()
+	if code := run([]string{"gosh", "-c", "set x = 1"}, os.Stdin, &stderr); code != 0 {
+		t.Fatalf("code=%d stderr=%q", code, stderr.String())
+	}
+	if code := run([]string{"gosh", "-c"}, os.Stdin, &stderr); code != 2 {
+		t.Fatalf("missing -c script code = %d", code)
+	}
+	stderr.Reset()
+	if code := run([]string{"gosh", "--help"}, os.Stdin, &stderr); code != 0 || !strings.Contains(stderr.String(), "serve mcp") {
+		t.Fatalf("help code=%d stderr=%q", code, stderr.String())
+	}
+
+	stdin := filepath.Join(dir, "stdin.gosh")
+	if err := os.WriteFile(stdin, []byte("set x = from-stdin\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if code := run([]string{"gosh"}, f, &stderr); code != 0 {
+		t.Fatalf("stdin script code = %d stderr=%q", code, stderr.String())
+	}
+}
+
+func TestRunAppliesPolicyFlag(t *testing.T) {
+	t.Setenv("GOSH_PLUGIN_PATH", t.TempDir())
+	t.Setenv("GOSH_HISTORY_DIR", t.TempDir())
+	dir := t.TempDir()
+	target := filepath.Join(dir, "keep.txt")
+	if err := os.WriteFile(target, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if code := run([]string{"gosh", "--policy", "readonly", "-c", "rm " + target}, os.Stdin, &stderr); code != 1 || !strings.Contains(stderr.String(), "rejected by policy") {
+		t.Fatalf("code=%d stderr=%q", code, stderr.String())
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("readonly policy removed file: %v", err)
+	}
+
+	stderr.Reset()
+	t.Setenv("GOSH_POLICY", "readonly")
+	if code := run([]string{"gosh", "-c", "rm " + target}, os.Stdin, &stderr); code != 1 {
+		t.Fatalf("GOSH_POLICY code=%d stderr=%q", code, stderr.String())
+	}
+	if code := run([]string{"gosh", "--policy"}, os.Stdin, &stderr); code != 2 {
+		t.Fatalf("missing policy name code = %d", code)
+	}
+}
+
+func TestRunDeclinesRiskyCommandsWithoutTerminal(t *testing.T) {
+	t.Setenv("GOSH_PLUGIN_PATH", t.TempDir())
+	t.Setenv("GOSH_HISTORY_DIR", t.TempDir())
+	t.Setenv("GOSH_ASSUME_YES", "")
+	stdin, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	var stderr bytes.Buffer
+	if code := run([]string{"gosh", "-c", "true --force"}, stdin, &stderr); code != 1 || !strings.Contains(stderr.String(), "not a terminal") {
+		t.Fatalf("code=%d stderr=%q", code, stderr.String())
+	}
+	stderr.Reset()
+	if code := run([]string{"gosh", "--yes", "-c", "true --force"}, stdin, &stderr); code != 0 {
+		t.Fatalf("--yes code=%d stderr=%q", code, stderr.String())
+	}
+	t.Setenv("GOSH_ASSUME_YES", "true")
+	if code := run([]string{"gosh", "-c", "true --force"}, stdin, &stderr); code != 0 {
+		t.Fatalf("GOSH_ASSUME_YES code=%d stderr=%q", code, stderr.String())
+	}
+}
+
+func TestRunDryRunDoesNotExecute(t *testing.T) {
+	t.Setenv("GOSH_PLUGIN_PATH", t.TempDir())
+	t.Setenv("GOSH_HISTORY_DIR", t.TempDir())
+	dir := t.TempDir()
+	target := filepath.Join(dir, "created")
+
+	var stderr bytes.Buffer
+	if code := run([]string{"gosh", "--dry-run", "--json", "-c", "mkDir " + target + "\ntouch " + target}, os.Stdin, &stderr); code != 0 {
+		t.Fatalf("code=%d stderr=%q", code, stderr.String())
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("dry run created %s: %v", target, err)
+	}
+}
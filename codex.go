@@ -1,12 +1,16 @@
 package gosh
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"text/template"
 )
 
 // CodexBackend sends non-deterministic inputs to `codex exec`.
@@ -19,8 +23,82 @@ type CodexBackend struct {
 	Args     []string
 	Stdout   io.Writer
 	Stderr   io.Writer
+
+	// PromptTemplate is a text/template for the prompt, executed with a
+	// CodexPromptData; PromptFile names a file holding one. The default
+	// template lists the exported tools, explains how the input was routed
+	// and asks Codex to prefer running the tools.
+	PromptTemplate string
+	PromptFile     string
+
+	// InstructionsFile names a file of project instructions to include in
+	// the prompt. Relative paths are resolved against Dir.
+	InstructionsFile string
+
+	// ToolBinary is how Codex should run tools, as `ToolBinary <Tool> args`.
+	// It defaults to the running program.
+	ToolBinary string
+
+	// JSON runs `codex exec --json`, records its events in the session and
+	// prints the agent's messages instead of the raw event stream.
+	JSON bool
+}
+
+// CodexPromptData is what a CodexBackend's prompt template is executed
+// with. Its RouteJSON and ToolsJSON methods format Route and Tools.
+type CodexPromptData struct {
+	Input        string
+	Route        RouteResult
+	Tools        []ToolInfo
+	Dir          string
+	Binary       string
+	Instructions string
+}
+
+// RouteJSON returns Route as indented JSON.
+func (d CodexPromptData) RouteJSON() string {
+	return promptJSON(d.Route)
+}
+
+// ToolsJSON returns Tools as indented JSON.
+func (d CodexPromptData) ToolsJSON() string {
+	return promptJSON(d.Tools)
 }
 
+func promptJSON(value interface{}) string {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, value); err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// defaultCodexPrompt is the prompt template CodexBackend uses when none is
+// configured.
+var defaultCodexPrompt = template.Must(template.New("codex").Parse(`This input did not match a registered gosh command or an executable command on PATH.
+Handle it as the user's request for the current repository or working directory.
+{{- if .Tools}}
+
+This project has deterministic gosh tools. Prefer running one of them over writing new commands or
+scripts, as:
+    {{.Binary}} <Tool> [args...]
+Tools:
+{{.ToolsJSON}}
+{{- end}}
+
+How gosh routed the input:
+{{.RouteJSON}}
+
+Working directory: {{.Dir}}
+{{- if .Instructions}}
+
+Project instructions:
+{{.Instructions}}
+{{- end}}
+
+User input:
+{{.Input}}`))
+
 // DefaultCodexBackend returns a Codex backend configured from the environment.
 //
 // Supported environment variables:
@@ -29,6 +107,9 @@ type CodexBackend struct {
 //   - GOSH_CODEX_SANDBOX
 //   - GOSH_CODEX_APPROVAL
 //   - GOSH_CODEX_ARGS
+//   - GOSH_CODEX_PROMPT_FILE
+//   - GOSH_CODEX_INSTRUCTIONS
+//   - GOSH_CODEX_JSON
 func DefaultCodexBackend() CodexBackend {
 	return CodexBackend{
 		Binary:   envOrDefault("GOSH_CODEX_BIN", "codex"),
@@ -38,24 +119,200 @@ func DefaultCodexBackend() CodexBackend {
 		Args:     splitEnvArgs(os.Getenv("GOSH_CODEX_ARGS")),
 		Stdout:   os.Stdout,
 		Stderr:   os.Stderr,
+
+		PromptFile:       os.Getenv("GOSH_CODEX_PROMPT_FILE"),
+		InstructionsFile: os.Getenv("GOSH_CODEX_INSTRUCTIONS"),
+		JSON:             envTrue("GOSH_CODEX_JSON"),
 	}
 }
 
 // Run invokes Codex for one unmatched input.
 func (b CodexBackend) Run(ctx context.Context, input string) error {
+	return b.RunRouted(ctx, RouteResult{Kind: RouteNeedsAI, Input: input})
+}
+
+// RunRouted invokes Codex for an input with how it was routed.
+func (b CodexBackend) RunRouted(ctx context.Context, result RouteResult) error {
+	_, err := b.RunSession(ctx, result)
+	return err
+}
+
+// RunSession invokes Codex for a routed input and records the session.
+func (b CodexBackend) RunSession(ctx context.Context, result RouteResult) (*AISession, error) {
+	session := newAISession("codex", result)
+	session.Config = map[string]string{
+		"binary":   b.Binary,
+		"model":    b.Model,
+		"sandbox":  b.Sandbox,
+		"approval": b.Approval,
+		"args":     strings.Join(b.Args, " "),
+		"json":     fmt.Sprint(b.JSON),
+	}
+	prompt, err := b.prompt(result.masked(contextSecrets(ctx)))
+	if err != nil {
+		return session, session.finish(err)
+	}
+	session.Prompt = prompt
+	cmd, err := b.command(ctx, prompt)
+	if err != nil {
+		return session, session.finish(err)
+	}
+	session.Dir = cmd.Dir
+
+	stdout, doneStdout := session.capture(cmd.Stdout, &session.Stdout)
+	stderr, doneStderr := session.capture(cmd.Stderr, &session.Stderr)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	var events *codexEvents
+	if b.JSON {
+		events = &codexEvents{session: session, out: stdout}
+		cmd.Stdout = events
+	}
+	err = cmd.Run()
+	if events != nil {
+		events.flush()
+	}
+	doneStdout()
+	doneStderr()
+	return session, session.finish(err)
+}
+
+// codexEvents reads the JSON lines of `codex exec --json`, records each
+// event and writes the text of agent messages to out. Lines that are not
+// JSON are written as they are.
+type codexEvents struct {
+	session *AISession
+	out     io.Writer
+	pending []byte
+}
+
+func (e *codexEvents) Write(p []byte) (int, error) {
+	e.pending = append(e.pending, p...)
+	for {
+		end := bytes.IndexByte(e.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		line := e.pending[:end+1]
+		e.pending = e.pending[end+1:]
+		e.line(line)
+	}
+}
+
+func (e *codexEvents) flush() {
+	if len(e.pending) > 0 {
+		e.line(e.pending)
+		e.pending = nil
+	}
+}
+
+func (e *codexEvents) line(line []byte) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return
+	}
+	var event struct {
+		Type string `json:"type"`
+		Item struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"item"`
+		Msg struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"msg"`
+	}
+	if err := json.Unmarshal(trimmed, &event); err != nil {
+		_, _ = e.out.Write(line)
+		return
+	}
+	e.session.Events = append(e.session.Events, json.RawMessage(append([]byte(nil), trimmed...)))
+	switch {
+	case event.Type == "item.completed" && event.Item.Type == "agent_message":
+		writef(e.out, "%s\n", strings.TrimRight(event.Item.Text, "\n"))
+	case event.Msg.Type == "agent_message":
+		writef(e.out, "%s\n", strings.TrimRight(event.Msg.Message, "\n"))
+	}
+}
+
+// prompt executes the backend's prompt template for a routed input.
+func (b CodexBackend) prompt(result RouteResult) (string, error) {
+	tmpl := defaultCodexPrompt
+	text := b.PromptTemplate
+	if text == "" && b.PromptFile != "" {
+		content, err := os.ReadFile(b.PromptFile)
+		if err != nil {
+			return "", fmt.Errorf("codex prompt template: %w", err)
+		}
+		text = string(content)
+	}
+	if text != "" {
+		parsed, err := template.New("codex").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("codex prompt template: %w", err)
+		}
+		tmpl = parsed
+	}
+
+	masked := result.masked(nil)
+	data := CodexPromptData{Input: masked.Input, Route: masked, Tools: Tools(), Dir: b.Dir, Binary: b.ToolBinary}
+	if data.Dir == "" {
+		data.Dir, _ = os.Getwd()
+	}
+	if data.Binary == "" {
+		data.Binary = toolBinary()
+	}
+	if b.InstructionsFile != "" {
+		path := b.InstructionsFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(data.Dir, path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("codex instructions: %w", err)
+		}
+		data.Instructions = strings.TrimSpace(string(content))
+	}
+
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("codex prompt template: %w", err)
+	}
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+// toolBinary returns how to run the current program: its base name when
+// that is what PATH finds, and otherwise the path it was started with.
+func toolBinary() string {
+	name := filepath.Base(os.Args[0])
+	if found, err := exec.LookPath(name); err == nil {
+		if self, err := os.Executable(); err == nil && sameFile(found, self) {
+			return name
+		}
+	}
+	return os.Args[0]
+}
+
+func sameFile(a string, b string) bool {
+	aInfo, errA := os.Stat(a)
+	bInfo, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(aInfo, bInfo)
+}
+
+// command builds the `codex exec` command for a prompt.
+func (b CodexBackend) command(ctx context.Context, prompt string) (*exec.Cmd, error) {
 	binary := b.Binary
 	if binary == "" {
 		binary = "codex"
 	}
 	if _, err := exec.LookPath(binary); err != nil {
-		return fmt.Errorf("codex backend %q not found: %w", binary, err)
+		return nil, fmt.Errorf("codex backend %q not found: %w", binary, err)
 	}
 
 	dir := b.Dir
 	if dir == "" {
 		workingDir, err := os.Getwd()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		dir = workingDir
 	}
@@ -73,23 +330,27 @@ func (b CodexBackend) Run(ctx context.Context, input string) error {
 	if b.Approval != "" {
 		args = append(args, "-c", fmt.Sprintf("approval_policy=%q", b.Approval))
 	}
+	if b.JSON {
+		args = append(args, "--json")
+	}
 	args = append(args, b.Args...)
-	args = append(args, codexPrompt(input))
+	args = append(args, prompt)
 
 	cmd := exec.CommandContext(ctx, binary, args...)
 	cmd.Stdout = defaultWriter(b.Stdout, os.Stdout)
 	cmd.Stderr = defaultWriter(b.Stderr, os.Stderr)
 	cmd.Stdin = os.Stdin
 	cmd.Dir = dir
-	return cmd.Run()
+	return cmd, nil
 }
 
+// codexPrompt renders the default prompt for an input routed to AI.
 func codexPrompt(input string) string {
-	return strings.TrimSpace(`This input did not match a registered gosh command or an executable command on PATH.
-Handle it as the user's request for the current repository or working directory.
-
-User input:
-` + input)
+	prompt, err := CodexBackend{}.prompt(RouteResult{Kind: RouteNeedsAI, Input: input})
+	if err != nil {
+		return input
+	}
+	return prompt
 }
 
 func envOrDefault(name, fallback string) string {
@@ -113,3 +113,78 @@ func TestCodexPromptAndSplitEnvArgs(t *testing.T) {
 		t.Fatalf("env fallback not used")
 	}
 }
+
+var _ = Tool("GoshCodexTestLint", func() {}, Desc("Lint the project"))
+
+func TestCodexPromptIncludesToolsRouteAndInstructions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "instructions.md"), []byte("Never push to main.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend := CodexBackend{Dir: dir, ToolBinary: "goshfile", InstructionsFile: "instructions.md"}
+	prompt, err := backend.prompt(RouteResult{Kind: RouteNeedsAI, Input: "tidy up", Reason: "no registered gosh command or executable matched"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"goshfile <Tool> [args...]",
+		`"name": "GoshCodexTestLint"`,
+		`"reason": "no registered gosh command or executable matched"`,
+		"Working directory: " + dir,
+		"Project instructions:\nNever push to main.",
+		"User input:\ntidy up",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+
+	backend.InstructionsFile = "missing.md"
+	if _, err := backend.prompt(RouteResult{Input: "x"}); err == nil {
+		t.Fatal("missing instructions file accepted")
+	}
+}
+
+func TestCodexPromptTemplates(t *testing.T) {
+	backend := CodexBackend{Dir: "/work", PromptTemplate: "{{.Input}} in {{.Dir}} ({{.Route.Kind}}, {{len .Tools}} tools)"}
+	prompt, err := backend.prompt(RouteResult{Kind: RouteNeedsAI, Input: "tidy"})
+	if err != nil || !strings.HasPrefix(prompt, "tidy in /work (needs_ai, ") {
+		t.Fatalf("prompt = %q, %v", prompt, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "prompt.tmpl")
+	if err := os.WriteFile(file, []byte("from file: {{.Input}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend = CodexBackend{PromptFile: file}
+	if prompt, err := backend.prompt(RouteResult{Input: "tidy"}); err != nil || prompt != "from file: tidy" {
+		t.Fatalf("file prompt = %q, %v", prompt, err)
+	}
+	backend = CodexBackend{PromptTemplate: "{{.Missing"}
+	if _, err := backend.prompt(RouteResult{Input: "tidy"}); err == nil {
+		t.Fatal("invalid template accepted")
+	}
+}
+
+func TestRouteGivesCodexTheRouteResult(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args.txt")
+	fakeCodex := filepath.Join(dir, "codex")
+	script := "#!/bin/sh\nfor arg in \"$@\"; do printf '%s\\n' \"$arg\" >> \"$GOSH_FAKE_CODEX_ARGS\"; done\n"
+	if err := os.WriteFile(fakeCodex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOSH_FAKE_CODEX_ARGS", argsFile)
+
+	backend := CodexBackend{Binary: fakeCodex, Dir: dir}
+	if err := RouteWithOptions(context.Background(), "goshcodextestlnt now", RouteOptions{Policy: DefaultPolicy(), Backend: backend}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"suggestions": [`) || !strings.Contains(string(raw), `"GoshCodexTestLint"`) {
+		t.Fatalf("prompt lacks the route result:\n%s", raw)
+	}
+}
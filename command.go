@@ -57,6 +57,9 @@ func registerCall(name string, call interface{}, options ...ToolOption) interfac
 	for _, option := range options {
 		option(&tool)
 	}
+	if tool.dryRunHook.IsValid() && tool.dryRunHook.Type() != rv.Type() {
+		panic(fmt.Sprintf("Dry-run hook for '%s' must have the signature %s", name, rv.Type()))
+	}
 	ensureLegacyInputParam(&tool, rv.Type())
 	inferParamTypes(&tool, rv.Type())
 	Calls[key] = Call{Name: name, Func: rv, Exported: exported, Tool: tool}
@@ -0,0 +1,413 @@
+package gosh
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wordPart is one run of characters inside a script word. Quoting is kept so
+// expansion can skip single-quoted and escaped text after tokenization.
+type wordPart struct {
+	text  string
+	quote rune // 0 for bare text, '\'' or '"' for quoted text, '\\' for escapes
+}
+
+// word is one argv token made of adjacent quoted and unquoted parts.
+type word []wordPart
+
+// lexWords splits a script line into words using the same rules as SplitArgs,
+// but keeps enough quoting information to expand variables afterwards.
+//
+// Differences from SplitArgs: `${...}` is kept together even when it contains
+// spaces, `\$` escapes a literal dollar sign, and `\*`, `\?` and `\[` escape
+// glob characters.
+func lexWords(input string) ([]word, error) {
+	runes := []rune(strings.TrimSpace(input))
+	var words []word
+	var current word
+	var text strings.Builder
+	var quote rune
+	argStarted := false
+
+	endPart := func() {
+		if text.Len() > 0 {
+			current = append(current, wordPart{text: text.String(), quote: quote})
+			text.Reset()
+		}
+	}
+	addEscaped := func(ch rune) {
+		endPart()
+		current = append(current, wordPart{text: string(ch), quote: '\\'})
+		argStarted = true
+	}
+	flush := func() {
+		endPart()
+		if argStarted {
+			if len(current) == 0 {
+				current = word{{quote: '"'}}
+			}
+			words = append(words, current)
+			current = nil
+			argStarted = false
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+
+		if ch == '\\' && quote != '\'' {
+			if i+1 >= len(runes) {
+				text.WriteRune('\\')
+				argStarted = true
+				continue
+			}
+
+			next := runes[i+1]
+			if quote == '"' {
+				if next == '"' || next == '\\' || next == '$' {
+					addEscaped(next)
+					i++
+					continue
+				}
+				text.WriteRune('\\')
+				continue
+			}
+
+			if next == '$' || isEscapableDirectArgRune(next) || isGlobRune(next) {
+				addEscaped(next)
+				i++
+				continue
+			}
+
+			text.WriteRune('\\')
+			argStarted = true
+			continue
+		}
+
+		if ch == '$' && quote != '\'' && i+1 < len(runes) && runes[i+1] == '{' {
+			end := matchingBrace(runes, i+1)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ${")
+			}
+			text.WriteString(string(runes[i : end+1]))
+			argStarted = true
+			i = end
+			continue
+		}
+
+		if quote != 0 {
+			if ch == quote {
+				endPart()
+				quote = 0
+				continue
+			}
+			text.WriteRune(ch)
+			continue
+		}
+
+		switch ch {
+		case '\'', '"':
+			endPart()
+			quote = ch
+			argStarted = true
+		case ' ', '\t', '\n', '\r':
+			flush()
+		case '|', ';', '&', '<', '>', '`':
+			return nil, fmt.Errorf("shell operator %q is not supported by direct command routing", ch)
+		default:
+			text.WriteRune(ch)
+			argStarted = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	flush()
+	return words, nil
+}
+
+// matchingBrace returns the index of the `}` closing the `{` at open.
+func matchingBrace(runes []rune, open int) int {
+	depth := 0
+	for i := open; i < len(runes); i++ {
+		switch runes[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// expander resolves shell-style parameter expansions against script state.
+type expander struct {
+	lookup func(name string) (string, bool)
+	assign func(name, value string)
+
+	// args holds $0, $1, ... inside functions and sourced files. Outside of
+	// them it is nil, and `$1` is kept literally.
+	args []string
+
+	// unset, when set, is told about variables expanded without a value
+	// and without a default, such as `$NAME` or `${NAME}`.
+	unset func(name string)
+}
+
+// expandRaw expands a raw argument string for legacy calls, which receive
+// their input unsplit. Quote characters are preserved; text inside a closed
+// pair of single quotes is not expanded, and `\$` yields a literal `$`.
+func (e expander) expandRaw(input string) (string, error) {
+	return e.expandUnsplit(input, true)
+}
+
+// expandHeredoc expands a heredoc body. Quotes are ordinary text there, and
+// `\$` yields a literal `$`.
+func (e expander) expandHeredoc(body string) (string, error) {
+	return e.expandUnsplit(body, false)
+}
+
+func (e expander) expandUnsplit(input string, quotes bool) (string, error) {
+	runes := []rune(input)
+	var out strings.Builder
+	var pending strings.Builder
+
+	flushPending := func() error {
+		expanded, err := e.expand(pending.String())
+		if err != nil {
+			return err
+		}
+		out.WriteString(expanded)
+		pending.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\\' && i+1 < len(runes) && runes[i+1] == '$':
+			if err := flushPending(); err != nil {
+				return "", err
+			}
+			out.WriteRune('$')
+			i++
+		case ch == '$' && i+1 < len(runes) && runes[i+1] == '{':
+			end := matchingBrace(runes, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${")
+			}
+			pending.WriteString(string(runes[i : end+1]))
+			i = end
+		case ch == '\'' && quotes:
+			end := indexRune(runes, '\'', i+1)
+			if end < 0 {
+				pending.WriteRune(ch)
+				continue
+			}
+			if err := flushPending(); err != nil {
+				return "", err
+			}
+			out.WriteString(string(runes[i : end+1]))
+			i = end
+		default:
+			pending.WriteRune(ch)
+		}
+	}
+	if err := flushPending(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func indexRune(runes []rune, ch rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == ch {
+			return i
+		}
+	}
+	return -1
+}
+
+// expand replaces $NAME, ${NAME}, ${NAME:-word}, ${NAME-word}, ${NAME:=word},
+// ${NAME=word}, ${NAME:?message}, ${NAME?message}, ${NAME:+word},
+// ${NAME+word} and $$ in text. A `$` that does not start an expansion is
+// kept literally.
+func (e expander) expand(text string) (string, error) {
+	if !strings.Contains(text, "$") {
+		return text, nil
+	}
+	runes := []rune(text)
+	var out strings.Builder
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		if ch != '$' || i+1 >= len(runes) {
+			out.WriteRune(ch)
+			continue
+		}
+
+		next := runes[i+1]
+		switch {
+		case next == '$':
+			out.WriteString(strconv.Itoa(os.Getpid()))
+			i++
+		case next == '{':
+			end := matchingBrace(runes, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${")
+			}
+			value, err := e.expandBraced(string(runes[i+2 : end]))
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i = end
+		case e.args != nil && (isDigit(next) || next == '#' || next == '@' || next == '*'):
+			value, _ := e.special(string(next))
+			out.WriteString(value)
+			i++
+		case isNameStart(next):
+			end := i + 1
+			for end < len(runes) && isNameRune(runes[end]) {
+				end++
+			}
+			name := string(runes[i+1 : end])
+			value, set := e.lookup(name)
+			if !set && e.unset != nil {
+				e.unset(name)
+			}
+			out.WriteString(value)
+			i = end - 1
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	return out.String(), nil
+}
+
+func (e expander) expandBraced(body string) (string, error) {
+	name := body
+	op := ""
+	operand := ""
+	for i, ch := range body {
+		if isNameRune(ch) {
+			continue
+		}
+		name = body[:i]
+		rest := body[i:]
+		for _, candidate := range []string{":-", ":=", ":?", ":+", "-", "=", "?", "+"} {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				operand = rest[len(candidate):]
+				break
+			}
+		}
+		if op == "" && !(i == 0 && len(body) == 1) {
+			return "", fmt.Errorf("bad substitution: ${%s}", body)
+		}
+		break
+	}
+	value, set := "", false
+	switch {
+	case allDigits(name):
+		value, set = e.special(name)
+	case e.args != nil && (body == "#" || body == "@" || body == "*"):
+		value, _ = e.special(body)
+		return value, nil
+	case name == "" || !isNameStart([]rune(name)[0]):
+		return "", fmt.Errorf("bad substitution: ${%s}", body)
+	default:
+		value, set = e.lookup(name)
+	}
+	useOperand := !set
+	if strings.HasPrefix(op, ":") {
+		useOperand = !set || value == ""
+	}
+
+	switch op {
+	case "":
+		if !set && e.unset != nil && !allDigits(name) {
+			e.unset(name)
+		}
+		return value, nil
+	case ":-", "-":
+		if useOperand {
+			return e.expand(operand)
+		}
+		return value, nil
+	case ":=", "=":
+		if useOperand {
+			expanded, err := e.expand(operand)
+			if err != nil {
+				return "", err
+			}
+			if e.assign != nil {
+				e.assign(name, expanded)
+			}
+			return expanded, nil
+		}
+		return value, nil
+	case ":?", "?":
+		if useOperand {
+			message, err := e.expand(operand)
+			if err != nil {
+				return "", err
+			}
+			if message == "" {
+				message = "parameter null or not set"
+			}
+			return "", fmt.Errorf("%s: %s", name, message)
+		}
+		return value, nil
+	default: // ":+", "+"
+		if useOperand {
+			return "", nil
+		}
+		return e.expand(operand)
+	}
+}
+
+// special resolves positional parameters and $#, $@ and $*.
+func (e expander) special(name string) (string, bool) {
+	switch name {
+	case "#":
+		return strconv.Itoa(len(e.args) - 1), true
+	case "@", "*":
+		if len(e.args) < 2 {
+			return "", true
+		}
+		return strings.Join(e.args[1:], " "), true
+	}
+	n, err := strconv.Atoi(name)
+	if err != nil || n < 0 || n >= len(e.args) {
+		return "", false
+	}
+	return e.args[n], true
+}
+
+func isDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func allDigits(text string) bool {
+	for _, ch := range text {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return text != ""
+}
+
+func isNameStart(ch rune) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isNameRune(ch rune) bool {
+	return isNameStart(ch) || (ch >= '0' && ch <= '9')
+}
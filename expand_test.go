@@ -0,0 +1,153 @@
+package gosh
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testExpander(env map[string]string) expander {
+	return expander{
+		lookup: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		assign: func(name, value string) {
+			env[name] = value
+		},
+	}
+}
+
+func TestExpandParameterForms(t *testing.T) {
+	env := map[string]string{"set": "value", "empty": ""}
+	e := testExpander(env)
+
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"$set", "value"},
+		{"${set}", "value"},
+		{"pre-${set}-post", "pre-value-post"},
+		{"${missing:-fallback}", "fallback"},
+		{"${empty:-fallback}", "fallback"},
+		{"${empty-fallback}", ""},
+		{"${set:-fallback}", "value"},
+		{"${missing:+alt}", ""},
+		{"${set:+alt}", "alt"},
+		{"${empty+alt}", "alt"},
+		{"${missing:-${set}}", "value"},
+		{"${missing:-two words}", "two words"},
+		{"cost $5", "cost $5"},
+		{"trailing $", "trailing $"},
+		{"$$", strconv.Itoa(os.Getpid())},
+		{"${assigned:=first}", "first"},
+		{"${assigned:=second}", "first"},
+	}
+	for _, tc := range cases {
+		got, err := e.expand(tc.input)
+		if err != nil {
+			t.Fatalf("expand(%q) returned error: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Fatalf("expand(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+	if env["assigned"] != "first" {
+		t.Fatalf("assigned = %q", env["assigned"])
+	}
+}
+
+func TestExpandRequiredAndBadSubstitution(t *testing.T) {
+	e := testExpander(map[string]string{"empty": ""})
+
+	_, err := e.expand("${missing:?set missing first}")
+	if err == nil || err.Error() != "missing: set missing first" {
+		t.Fatalf("required error = %v", err)
+	}
+	_, err = e.expand("${empty:?}")
+	if err == nil || !strings.Contains(err.Error(), "parameter null or not set") {
+		t.Fatalf("required empty error = %v", err)
+	}
+	if _, err := e.expand("${empty?}"); err != nil {
+		t.Fatalf("set-but-empty should satisfy ?: %v", err)
+	}
+	for _, input := range []string{"${}", "${a b}", "${1x}", "${open"} {
+		if _, err := e.expand(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
+
+func TestExpandArgsKeepsExpandedValuesWhole(t *testing.T) {
+	script := testScript(t.TempDir())
+	script.env["path"] = "my documents/report final.txt"
+	script.env["name"] = "gosh"
+
+	args, err := script.expandArgs(`cp ${path} "${name} copy" '${name}' \${name} ${missing:-a b}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cp", "my documents/report final.txt", "gosh copy", "${name}", "${name}", "a b"}
+	if strings.Join(args, "\x00") != strings.Join(want, "\x00") {
+		t.Fatalf("args = %#v, want %#v", args, want)
+	}
+
+	if _, err := script.expandArgs(`echo "unterminated`); err == nil {
+		t.Fatalf("expected unterminated quote error")
+	}
+	if _, err := script.expandArgs(`echo ${x} | wc`); err == nil {
+		t.Fatalf("expected shell operator error")
+	}
+}
+
+func TestExpandRawPreservesQuotesForLegacyCalls(t *testing.T) {
+	e := testExpander(map[string]string{"name": "World"})
+
+	cases := map[string]string{
+		`Hello ${name}`:           `Hello World`,
+		`"Hello ${name}"`:         `"Hello World"`,
+		`'Hello ${name}'`:         `'Hello ${name}'`,
+		`It's ${name}`:            `It's World`,
+		`cost \$5 for $name`:      `cost $5 for World`,
+		`${missing:-a 'b' c}`:     `a 'b' c`,
+		`literal \${name} escape`: `literal ${name} escape`,
+	}
+	for input, want := range cases {
+		got, err := e.expandRaw(input)
+		if err != nil {
+			t.Fatalf("expandRaw(%q) returned error: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("expandRaw(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestRunCmdsReportsRequiredVariableErrors(t *testing.T) {
+	var gotErrs []error
+	script := testScript(t.TempDir())
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+	script.cmds = []string{
+		"echo ${GOSH_TEST_REQUIRED:?must be set}",
+		"set greeting = ${GOSH_TEST_GREETING:-hi there}",
+	}
+
+	output, err := captureStdout(func() error {
+		script.RunCmds()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(output) != "" {
+		t.Fatalf("failed line should not print: %q", output)
+	}
+	if len(gotErrs) != 1 || !strings.Contains(gotErrs[0].Error(), "must be set") {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+	if script.env["greeting"] != "hi there" {
+		t.Fatalf("greeting = %q", script.env["greeting"])
+	}
+}
@@ -0,0 +1,227 @@
+package gosh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxScriptDepth bounds nested function calls and sourced files.
+const maxScriptDepth = 64
+
+// scriptFunc is a `func name [params...]` ... `end` block defined by a script.
+type scriptFunc struct {
+	name   string
+	params []string
+	body   []scriptLine
+	file   string
+}
+
+// groupFuncs folds `func` ... `end` blocks into single definition lines.
+func groupFuncs(lines []scriptLine) []scriptLine {
+	var out []scriptLine
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		fields := strings.Fields(line.text)
+		if len(fields) == 0 || line.err != nil {
+			out = append(out, line)
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "end":
+			if len(fields) == 1 {
+				line.err = fmt.Errorf("end without func")
+			}
+			out = append(out, line)
+			continue
+		case "func":
+		default:
+			out = append(out, line)
+			continue
+		}
+
+		def := &scriptFunc{}
+		if len(fields) < 2 {
+			line.err = fmt.Errorf("func requires a name")
+		} else {
+			def.name = fields[1]
+			def.params = fields[2:]
+			for _, name := range fields[1:] {
+				if !validName(name) {
+					line.err = fmt.Errorf("invalid func name or parameter %q", name)
+					break
+				}
+			}
+		}
+
+		depth := 1
+		start := i + 1
+		for i+1 < len(lines) && depth > 0 {
+			i++
+			inner := strings.Fields(lines[i].text)
+			if len(inner) == 0 {
+				continue
+			}
+			switch strings.ToLower(inner[0]) {
+			case "func":
+				depth++
+			case "end":
+				if len(inner) == 1 {
+					depth--
+				}
+			}
+		}
+		if depth > 0 {
+			if line.err == nil {
+				line.err = incompleteError{fmt.Sprintf("func %s is missing end", def.name)}
+			}
+			def.body = groupFuncs(lines[start:])
+		} else {
+			def.body = groupFuncs(lines[start:i])
+		}
+		line.def = def
+		out = append(out, line)
+	}
+	return out
+}
+
+func validName(name string) bool {
+	for i, ch := range name {
+		if !isNameRune(ch) || (i == 0 && !isNameStart(ch)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// define records a script function for the rest of the script.
+func (s *Script) define(def *scriptFunc) {
+	if s.funcs == nil {
+		s.funcs = map[string]*scriptFunc{}
+	}
+	def.file = s.file
+	s.funcs[strings.ToLower(def.name)] = def
+}
+
+// callFunc runs a script function with positional and named arguments. Like
+// shell functions, it shares the script's directories and variables; named
+// parameters are restored when the function returns.
+func (s *Script) callFunc(def *scriptFunc, args []string) error {
+	if s.depth >= maxScriptDepth {
+		return fmt.Errorf("func %s: maximum script depth %d exceeded", def.name, maxScriptDepth)
+	}
+	if s.check != nil {
+		// Check walks each body once, when the function is defined.
+		if s.check.walked[def] {
+			return nil
+		}
+		s.check.walked[def] = true
+	}
+	if s.env == nil {
+		s.env = map[string]string{}
+	}
+
+	type saved struct {
+		value string
+		set   bool
+	}
+	previous := map[string]saved{}
+	for i, name := range def.params {
+		value, set := s.env[name]
+		previous[name] = saved{value: value, set: set}
+		if i < len(args) {
+			s.env[name] = args[i]
+		} else {
+			delete(s.env, name)
+		}
+	}
+	oldArgs, oldFile := s.args, s.file
+	s.args = append([]string{def.name}, args...)
+	s.file = def.file
+	s.depth++
+	defer func() {
+		s.depth--
+		s.args, s.file = oldArgs, oldFile
+		for name, old := range previous {
+			if old.set {
+				s.env[name] = old.value
+			} else {
+				delete(s.env, name)
+			}
+		}
+	}()
+
+	for _, line := range def.body {
+		s.runLine(line)
+	}
+	return nil
+}
+
+// lineRef names a line for error messages, including the sourced file.
+func (s *Script) lineRef(lineNum int) string {
+	if s.file != "" {
+		return fmt.Sprintf("line %d of %s", lineNum, s.file)
+	}
+	return fmt.Sprintf("line %d", lineNum)
+}
+
+// Source runs a script file. Relative paths in the file, including `cd`,
+// start from the file's own directory; functions and variables it defines
+// remain available afterwards.
+func (s *Script) source(input string) error {
+	args, err := rawArgs(input)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: source path [args...]")
+	}
+	if s.depth >= maxScriptDepth {
+		return fmt.Errorf("source %s: maximum script depth %d exceeded", args[0], maxScriptDepth)
+	}
+
+	path, err := s.resolvePath(args[0])
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	oldDirs := append([]string{}, s.dirs...)
+	oldArgs, oldFile := s.args, s.file
+	s.dirs = append([]string{filepath.Dir(path)}, s.dirs...)
+	s.args = args
+	s.file = path
+	s.depth++
+	defer func() {
+		s.depth--
+		s.dirs = oldDirs
+		s.args, s.file = oldArgs, oldFile
+	}()
+
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	for _, line := range parseScriptLines(lines) {
+		s.runLine(line)
+	}
+	return nil
+}
+
+// rawArgs splits a legacy command's already-expanded input into arguments.
+func rawArgs(input string) ([]string, error) {
+	words, err := lexWords(input)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(words))
+	for _, w := range words {
+		literal, err := buildWord(w, nil)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, literal.value)
+	}
+	return args, nil
+}
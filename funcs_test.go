@@ -0,0 +1,140 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScriptFuncsTakeNamedAndPositionalArgs(t *testing.T) {
+	var gotErrs []error
+	script := testScript(t.TempDir())
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+	script.env["who"] = "outer"
+
+	output, err := captureStdout(func() error {
+		script.Run(`
+			func greet who
+				echo hello ${who} from $0 with $# args: $@
+				echo second=${2:-none}
+			end
+			Greet "big world"
+			greet gosh extra
+			echo who=${who} args=$1
+		`)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotErrs) != 0 {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+	want := []string{
+		"hello big world from greet with 1 args: big world",
+		"second=none",
+		"hello gosh from greet with 2 args: gosh extra",
+		"second=extra",
+		"who=outer args=$1",
+	}
+	if strings.TrimSpace(output) != strings.Join(want, "\n") {
+		t.Fatalf("output = %q", output)
+	}
+}
+
+func TestScriptFuncsAreDefinedInOrderAndCanNest(t *testing.T) {
+	var gotErrs []error
+	script := testScript(t.TempDir())
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+
+	output, err := captureStdout(func() error {
+		script.Run(`
+			goshTestTooEarly
+			func outer
+				func inner
+					echo inner ran
+				end
+				inner
+			end
+			outer
+			inner
+		`)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(output, "inner ran") != 2 {
+		t.Fatalf("output = %q", output)
+	}
+	if len(gotErrs) != 1 || !strings.Contains(gotErrs[0].Error(), "goshTestTooEarly") {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+}
+
+func TestScriptFuncParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"func broken\necho never":    "missing end",
+		"end":                        "end without func",
+		"func":                       "requires a name",
+		"func bad-name\nend":         "invalid func name",
+		"func loop\nloop\nend\nloop": "maximum script depth",
+	}
+	for input, want := range cases {
+		var gotErrs []error
+		script := testScript(t.TempDir())
+		script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+		script.Run(input)
+		if len(gotErrs) == 0 || !strings.Contains(gotErrs[len(gotErrs)-1].Error(), want) {
+			t.Fatalf("script %q errors = %v, want %q", input, gotErrs, want)
+		}
+	}
+}
+
+func TestSourceRunsFilesFromTheirOwnDirectory(t *testing.T) {
+	dir := t.TempDir()
+	recipes := filepath.Join(dir, "shared", "recipes")
+	if err := os.MkdirAll(filepath.Join(recipes, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	recipe := `#!/usr/bin/env gosh
+set shared = from-${1}
+func mark name
+	mkdir ${name}
+end
+cd out
+mark sourced-dir
+missing-command-in-recipe
+`
+	if err := os.WriteFile(filepath.Join(recipes, "lib.gosh"), []byte(recipe), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotErrs []error
+	script := testScript(dir)
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+	script.Run(`
+		source shared/recipes/lib.gosh caller
+		mark caller-dir
+		source missing.gosh
+	`)
+
+	if script.env["shared"] != "from-caller" {
+		t.Fatalf("shared = %q", script.env["shared"])
+	}
+	if _, err := os.Stat(filepath.Join(recipes, "out", "sourced-dir")); err != nil {
+		t.Fatalf("sourced mkdir should be relative to the file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "caller-dir")); err != nil {
+		t.Fatalf("caller dir should be restored after source: %v", err)
+	}
+	if script.getwd() != dir {
+		t.Fatalf("getwd = %q", script.getwd())
+	}
+	if len(gotErrs) != 2 ||
+		!strings.Contains(gotErrs[0].Error(), "line 7 of "+filepath.Join(recipes, "lib.gosh")) ||
+		!strings.Contains(gotErrs[1].Error(), "missing.gosh") {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+}
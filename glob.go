@@ -0,0 +1,223 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandedWord is a script word after variable expansion.
+type expandedWord struct {
+	value   string
+	pattern string // value with quoted glob characters escaped
+	glob    bool   // an unquoted part contains a glob character
+}
+
+// buildWord joins the parts of a word, passing unquoted and double-quoted
+// text through expand.
+func buildWord(w word, expand func(string) (string, error)) (expandedWord, error) {
+	var out expandedWord
+	var value, pattern strings.Builder
+	for _, part := range w {
+		text := part.text
+		if part.quote != '\'' && part.quote != '\\' && expand != nil {
+			expanded, err := expand(text)
+			if err != nil {
+				return expandedWord{}, err
+			}
+			text = expanded
+		}
+		value.WriteString(text)
+		if part.quote == 0 {
+			pattern.WriteString(text)
+			if strings.ContainsAny(text, "*?[") {
+				out.glob = true
+			}
+		} else {
+			pattern.WriteString(escapeGlob(text))
+		}
+	}
+	out.value = value.String()
+	out.pattern = pattern.String()
+	return out, nil
+}
+
+func escapeGlob(text string) string {
+	var out strings.Builder
+	for _, ch := range text {
+		switch ch {
+		case '*', '?', '[', '\\':
+			out.WriteRune('\\')
+		}
+		out.WriteRune(ch)
+	}
+	return out.String()
+}
+
+// globArgs expands w against dir. Words without unquoted glob characters,
+// and patterns without matches, are returned as-is unless nullGlob is set.
+func globArgs(dir string, w expandedWord, nullGlob bool) ([]string, error) {
+	if !w.glob {
+		return []string{w.value}, nil
+	}
+	matches, err := expandGlob(dir, w.pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 && !nullGlob {
+		return []string{w.value}, nil
+	}
+	return matches, nil
+}
+
+// expandGlob returns the sorted paths matching pattern. Relative patterns are
+// resolved against dir and returned relative to it. `*`, `?` and `[...]` match
+// within one path element and skip dotfiles unless the element starts with a
+// dot; a `**` element matches zero or more directories.
+func expandGlob(dir, pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	base := dir
+	prefix := ""
+	if strings.HasPrefix(pattern, "/") {
+		base = "/"
+		prefix = "/"
+		pattern = strings.TrimLeft(pattern, "/")
+	} else if vol := filepath.VolumeName(pattern); vol != "" {
+		base = vol + string(filepath.Separator)
+		prefix = vol + "/"
+		pattern = strings.TrimLeft(pattern[len(vol):], "/")
+	}
+
+	g := globber{seen: map[string]bool{}}
+	if err := g.match(base, prefix, strings.Split(pattern, "/")); err != nil {
+		return nil, err
+	}
+	sort.Strings(g.matches)
+	return g.matches, nil
+}
+
+type globber struct {
+	matches []string
+	seen    map[string]bool
+}
+
+func (g *globber) match(base, rel string, segments []string) error {
+	if len(segments) == 0 {
+		if rel != "" && !g.seen[rel] {
+			g.seen[rel] = true
+			g.matches = append(g.matches, filepath.FromSlash(rel))
+		}
+		return nil
+	}
+
+	segment, rest := segments[0], segments[1:]
+	switch {
+	case segment == "":
+		// a trailing slash only matches directories
+		if len(rest) == 0 {
+			if info, err := os.Stat(base); err == nil && info.IsDir() && rel != "" {
+				return g.match(base, strings.TrimSuffix(rel, "/")+"/", nil)
+			}
+			return nil
+		}
+		return g.match(base, rel, rest)
+	case segment == "**":
+		if len(rest) == 0 {
+			// a final ** matches everything below base
+			rest = []string{"*"}
+			segments = []string{"**", "*"}
+		}
+		if err := g.match(base, rel, rest); err != nil {
+			return err
+		}
+		entries, err := readDirNames(base)
+		if err != nil {
+			return nil
+		}
+		for _, name := range entries {
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			path := filepath.Join(base, name)
+			info, err := os.Lstat(path)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			if err := g.match(path, rel+name+"/", segments); err != nil {
+				return err
+			}
+		}
+		return nil
+	case !strings.ContainsAny(segment, "*?["):
+		name := unescapeGlob(segment)
+		path := filepath.Join(base, name)
+		if name != "." && name != ".." {
+			if _, err := os.Lstat(path); err != nil {
+				return nil
+			}
+		}
+		return g.match(path, joinGlobRel(rel, name, rest), rest)
+	default:
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return err
+		}
+		entries, err := readDirNames(base)
+		if err != nil {
+			return nil
+		}
+		for _, name := range entries {
+			if strings.HasPrefix(name, ".") && !strings.HasPrefix(segment, ".") {
+				continue
+			}
+			if ok, _ := filepath.Match(segment, name); ok {
+				if err := g.match(filepath.Join(base, name), joinGlobRel(rel, name, rest), rest); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func joinGlobRel(rel, name string, rest []string) string {
+	if len(rest) == 0 {
+		return rel + name
+	}
+	return rel + name + "/"
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	names, err := f.Readdirnames(-1)
+	sort.Strings(names)
+	return names, err
+}
+
+func unescapeGlob(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		out.WriteRune(runes[i])
+	}
+	return out.String()
+}
+
+func isGlobRune(ch rune) bool {
+	switch ch {
+	case '*', '?', '[':
+		return true
+	default:
+		return false
+	}
+}
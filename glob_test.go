@@ -0,0 +1,134 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGlobTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandGlobPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeGlobTree(t, dir,
+		"a.tmp", "b.tmp", "c.txt", ".hidden.tmp",
+		"pkg/one/x.go", "pkg/two/y.go", "pkg/two/deep/z.go", "pkg/.git/config")
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.tmp", []string{"a.tmp", "b.tmp"}},
+		{".*.tmp", []string{".hidden.tmp"}},
+		{"?.t[xy]t", []string{"c.txt"}},
+		{"./pkg/*/", []string{"./pkg/one/", "./pkg/two/"}},
+		{"pkg/**/*.go", []string{"pkg/one/x.go", "pkg/two/deep/z.go", "pkg/two/y.go"}},
+		{"pkg/**", []string{"pkg/one", "pkg/one/x.go", "pkg/two", "pkg/two/deep", "pkg/two/deep/z.go", "pkg/two/y.go"}},
+		{"*.none", nil},
+	}
+	for _, tc := range cases {
+		got, err := expandGlob(dir, tc.pattern)
+		if err != nil {
+			t.Fatalf("expandGlob(%q) returned error: %v", tc.pattern, err)
+		}
+		want := make([]string, len(tc.want))
+		for i := range tc.want {
+			want[i] = filepath.FromSlash(tc.want[i])
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expandGlob(%q) = %v, want %v", tc.pattern, got, want)
+		}
+	}
+
+	abs, err := expandGlob("/", filepath.ToSlash(dir)+"/*.txt")
+	if err != nil || len(abs) != 1 || abs[0] != filepath.Join(dir, "c.txt") {
+		t.Fatalf("absolute glob = %v, %v", abs, err)
+	}
+	if _, err := expandGlob(dir, "[.tmp"); err == nil {
+		t.Fatalf("expected bad pattern error")
+	}
+}
+
+func TestExpandArgsGlobsOnlyWhenEnabled(t *testing.T) {
+	dir := t.TempDir()
+	writeGlobTree(t, dir, "a.tmp", "b.tmp")
+	script := testScript(dir)
+
+	args, err := script.expandArgs(`ls *.tmp`)
+	if err != nil || strings.Join(args, " ") != "ls *.tmp" {
+		t.Fatalf("glob disabled args = %v, %v", args, err)
+	}
+
+	script.options.Glob = true
+	script.env["ext"] = "tmp"
+	cases := map[string]string{
+		`ls *.${ext}`: "ls a.tmp b.tmp",
+		`ls "*.tmp"`:  "ls *.tmp",
+		`ls '*'.tmp`:  "ls *.tmp",
+		`ls \*.tmp`:   "ls *.tmp",
+		`ls *.none`:   "ls *.none",
+	}
+	for input, want := range cases {
+		args, err := script.expandArgs(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(args, " ") != want {
+			t.Fatalf("expandArgs(%q) = %v, want %q", input, args, want)
+		}
+	}
+
+	script.options.NullGlob = true
+	args, err = script.expandArgs(`ls *.none`)
+	if err != nil || strings.Join(args, " ") != "ls" {
+		t.Fatalf("nullglob args = %v, %v", args, err)
+	}
+}
+
+func TestBuiltinsExpandGlobsWithShopt(t *testing.T) {
+	dir := t.TempDir()
+	writeGlobTree(t, dir, "a.tmp", "b.tmp", "keep.txt", "old/one/x", "old/two/y")
+	var gotErrs []error
+	script := testScript(dir)
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+
+	script.Run(`
+		rm *.tmp
+		shopt -s glob
+		rm *.tmp
+		rmdir old/*
+		mkdir "new dir" other
+		shopt -s nullglob
+		rm *.none
+		shopt -u glob nullglob
+		shopt -s bogus
+	`)
+	if len(gotErrs) != 2 || !strings.Contains(gotErrs[0].Error(), "*.tmp") || !strings.Contains(gotErrs[1].Error(), "bogus") {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+	if script.options.Glob || script.options.NullGlob {
+		t.Fatalf("options = %+v", script.options)
+	}
+	entries, err := readDirNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(entries, ",") != "keep.txt,new dir,old,other" {
+		t.Fatalf("entries = %v", entries)
+	}
+	if left, _ := readDirNames(filepath.Join(dir, "old")); len(left) != 0 {
+		t.Fatalf("rmdir glob left %v", left)
+	}
+}
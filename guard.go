@@ -0,0 +1,174 @@
+package gosh
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PolicyError reports a script line that was rejected by policy before it
+// ran.
+type PolicyError struct {
+	Line   int
+	File   string
+	Input  string
+	Result RouteResult
+}
+
+func (e *PolicyError) Error() string {
+	where := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		where += " of " + e.File
+	}
+	return fmt.Sprintf("rejected by policy, %s\n[%s]\n%s", where, e.Input, e.Result.Reason)
+}
+
+// guard classifies one expanded script line under the script's policy and
+// returns a *PolicyError if it must not run. Lines that need approval are
+// then put to the script's Approver, and a refusal is an *ApprovalError.
+func (s *Script) guard(lineNum int, input string, argv []string) error {
+	policy, approver := s.options.Policy, s.options.Approver
+	if (policy == nil && approver == nil) || len(argv) == 0 {
+		return nil
+	}
+	result := s.classify(input, argv)
+	input = maskRoute(result, s.secrets)(input)
+	if policy != nil && result.Kind == RouteRejected {
+		return &PolicyError{Line: lineNum, File: s.file, Input: input, Result: result.masked(s.secrets)}
+	}
+	if err := approve(s.ctx, approver, result); err != nil {
+		return &ApprovalError{Line: lineNum, File: s.file, Input: input, Result: result.masked(s.secrets), Err: err}
+	}
+	return nil
+}
+
+// classify routes one expanded script line under the script's policy, or
+// DefaultPolicy without one.
+func (s *Script) classify(input string, argv []string) RouteResult {
+	policy := DefaultPolicy()
+	if s.options.Policy != nil {
+		policy = *s.options.Policy
+	}
+	result := classifyCommand(input, argv[0], argv[1:], policy)
+	if s.options.Policy != nil && result.Kind == RouteNeedsAI && !policy.externalAllowed(argv[0]) {
+		result.Kind = RouteRejected
+		result.Reason = "external command is not allowed by policy"
+	}
+	return result
+}
+
+// policyKey and approverKey are the context keys of the policy and the
+// Approver scripts started with that context inherit.
+type (
+	policyKey   struct{}
+	approverKey struct{}
+)
+
+// withPolicy returns ctx carrying policy for the scripts started with it.
+func withPolicy(ctx context.Context, policy *Policy) context.Context {
+	if policy == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// contextPolicy returns the policy carried by ctx, if any.
+func contextPolicy(ctx context.Context) *Policy {
+	policy, _ := ctx.Value(policyKey{}).(*Policy)
+	return policy
+}
+
+// withApprover returns ctx carrying approver for the scripts started with
+// it.
+func withApprover(ctx context.Context, approver Approver) context.Context {
+	if approver == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, approverKey{}, approver)
+}
+
+// contextApprover returns the Approver carried by ctx, if any.
+func contextApprover(ctx context.Context) Approver {
+	approver, _ := ctx.Value(approverKey{}).(Approver)
+	return approver
+}
+
+// callGuard is the policy and Approver of a script whose Go call is
+// running.
+type callGuard struct {
+	policy   *Policy
+	approver Approver
+}
+
+// callGuards holds the guard of each script whose Go call is running, by
+// the goroutine running it. Scripts the call starts on that goroutine with
+// Run or RunE, which take no context, inherit the guard; scripts running
+// concurrently on other goroutines do not see it.
+var callGuards struct {
+	sync.Mutex
+	byGoroutine map[uint64]callGuard
+}
+
+// callGo calls a Go command or tool of the script, with the script's
+// policy and Approver inherited by the scripts it starts.
+func (s *Script) callGo(fn reflect.Value, in []reflect.Value) error {
+	guard := callGuard{policy: s.options.Policy, approver: s.options.Approver}
+	if guard.policy == nil && guard.approver == nil {
+		return collectCallError(fn.Call(in))
+	}
+	id := goroutineID()
+	callGuards.Lock()
+	if callGuards.byGoroutine == nil {
+		callGuards.byGoroutine = map[uint64]callGuard{}
+	}
+	outer, nested := callGuards.byGoroutine[id]
+	callGuards.byGoroutine[id] = guard
+	callGuards.Unlock()
+	defer func() {
+		callGuards.Lock()
+		defer callGuards.Unlock()
+		if nested {
+			callGuards.byGoroutine[id] = outer
+		} else {
+			delete(callGuards.byGoroutine, id)
+		}
+	}()
+	return collectCallError(fn.Call(in))
+}
+
+// currentCallGuard returns the guard of the Go call running on this
+// goroutine, if any.
+func currentCallGuard() callGuard {
+	callGuards.Lock()
+	defer callGuards.Unlock()
+	if len(callGuards.byGoroutine) == 0 {
+		return callGuard{}
+	}
+	return callGuards.byGoroutine[goroutineID()]
+}
+
+// goroutineID returns the ID of the calling goroutine, read from the
+// `goroutine <id> [...]` header of its stack trace.
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	if i := strings.IndexByte(header, ' '); i > 0 {
+		header = header[:i]
+	}
+	id, _ := strconv.ParseUint(header, 10, 64)
+	return id
+}
+
+// legacyArgv splits a legacy command's raw input for classification only;
+// the command itself still receives the raw input.
+func legacyArgv(name, input string) []string {
+	args, err := rawArgs(input)
+	if err != nil {
+		args = strings.Fields(input)
+	}
+	return append([]string{name}, args...)
+}
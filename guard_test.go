@@ -0,0 +1,175 @@
+package gosh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var guardNestedErr error
+
+var _ = Cmd("goshGuardTestNested", func(dir string) {
+	guardNestedErr = RunE("pushd " + dir + "\ntouch nested.txt")
+})
+
+func TestScriptPolicyRejectsEachLineBeforeExecution(t *testing.T) {
+	dir := t.TempDir()
+	policy := SafePolicy()
+	var gotErrs []error
+	script := testScript(dir)
+	script.options.Policy = &policy
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+
+	output, err := captureStdout(func() error {
+		script.Run(`
+			ls .
+			touch first.txt
+			set tool = touch
+			${tool} second.txt
+			func make name
+				touch ${name}
+			end
+			make third.txt
+			git push origin main
+			echo still-runs
+		`)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "still-runs") {
+		t.Fatalf("output = %q", output)
+	}
+	for _, name := range []string{"first.txt", "second.txt", "third.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not have been created: %v", name, err)
+		}
+	}
+	if len(gotErrs) != 4 {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+
+	var policyErr *PolicyError
+	if !errors.As(gotErrs[0], &policyErr) {
+		t.Fatalf("expected *PolicyError, got %T", gotErrs[0])
+	}
+	if policyErr.Line != 1 || policyErr.Input != "touch first.txt" || policyErr.Result.Kind != RouteRejected {
+		t.Fatalf("policy error = %+v", policyErr)
+	}
+	if !strings.Contains(gotErrs[0].Error(), "rejected by policy, line 1") {
+		t.Fatalf("error text = %q", gotErrs[0].Error())
+	}
+	if !errors.As(gotErrs[1], &policyErr) || policyErr.Input != "${tool} second.txt" {
+		t.Fatalf("expanded command should be checked: %v", gotErrs[1])
+	}
+	if !errors.As(gotErrs[3], &policyErr) || policyErr.Result.Risk != RiskHigh {
+		t.Fatalf("git push should be rejected as high risk: %v", gotErrs[3])
+	}
+}
+
+var guardNestedApprovalErrs []error
+
+var _ = Cmd("goshGuardTestNestedApproval", func(s *Script) {
+	guardNestedApprovalErrs = append(guardNestedApprovalErrs,
+		RunWithOptions(s.Context(), "true --force", ScriptOptions{}),
+		RunE("true --force"))
+})
+
+func TestScriptApproverIsInheritedByNestedScripts(t *testing.T) {
+	var asked []string
+	approver := ApproverFunc(func(ctx context.Context, result RouteResult) error {
+		asked = append(asked, result.Input)
+		return ErrNotApproved
+	})
+	script := testScript(t.TempDir())
+	script.options.Approver = approver
+
+	guardNestedApprovalErrs = nil
+	script.Run("goshGuardTestNestedApproval")
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	if len(asked) != 2 {
+		t.Fatalf("approver asked %q, want both nested scripts", asked)
+	}
+	for _, err := range guardNestedApprovalErrs {
+		var approvalErr *ApprovalError
+		if !errors.As(err, &approvalErr) {
+			t.Fatalf("nested script error = %v", err)
+		}
+	}
+	if currentCallGuard().approver != nil {
+		t.Fatalf("inherited approver should be cleared after the call")
+	}
+}
+
+var guardOtherGoroutinePolicy, guardSameGoroutinePolicy *Policy
+
+var _ = Cmd("goshGuardTestGoroutines", func() {
+	guardSameGoroutinePolicy = currentCallGuard().policy
+	done := make(chan struct{})
+	go func() {
+		guardOtherGoroutinePolicy = currentCallGuard().policy
+		close(done)
+	}()
+	<-done
+})
+
+func TestCallPolicyStaysOnItsGoroutine(t *testing.T) {
+	policy := SafePolicy()
+	script := testScript(t.TempDir())
+	script.options.Policy = &policy
+	script.Run("goshGuardTestGoroutines")
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	if guardSameGoroutinePolicy != &policy || guardOtherGoroutinePolicy != nil {
+		t.Fatalf("same goroutine = %v, other goroutine = %v", guardSameGoroutinePolicy, guardOtherGoroutinePolicy)
+	}
+}
+
+func TestScriptPolicyIsInheritedByNestedScripts(t *testing.T) {
+	dir := t.TempDir()
+	policy := SafePolicy()
+	script := testScript(dir)
+	script.options.Policy = &policy
+
+	guardNestedErr = nil
+	script.Run("goshGuardTestNested " + dir)
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	var policyErr *PolicyError
+	if !errors.As(guardNestedErr, &policyErr) {
+		t.Fatalf("nested script error = %v", guardNestedErr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nested.txt")); !os.IsNotExist(err) {
+		t.Fatalf("nested command should not run: %v", err)
+	}
+	if currentCallGuard().policy != nil {
+		t.Fatalf("inherited policy should be cleared after the call")
+	}
+
+	guardNestedErr = nil
+	err := RouteWithOptions(context.Background(), "goshGuardTestNested "+dir, RouteOptions{Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.As(guardNestedErr, &policyErr) {
+		t.Fatalf("routed nested script error = %v", guardNestedErr)
+	}
+
+	guardNestedErr = nil
+	plain := testScript(dir)
+	plain.Run("goshGuardTestNested " + dir)
+	if guardNestedErr != nil {
+		t.Fatalf("scripts without policy should not be restricted: %v", guardNestedErr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nested.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package gosh
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// RunFile runs a script file, such as a `.gosh` file with a
+// `#!/usr/bin/env gosh` line. The script starts in the process working
+// directory; `$0` is the file path and args are available as `$1`, `$2`, ...
+func RunFile(ctx context.Context, path string, args []string, options ScriptOptions) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	script := newScript(ctx, options)
+	script.args = append([]string{path}, args...)
+	script.file = path
+	script.cmds = strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	script.RunCmds()
+	return script.firstErr
+}
+
+// REPL reads commands from in and runs them as one long-lived script, so
+// variables, functions and the working directory carry over between
+// commands. Prompts and errors are written to prompt; a command that is not
+// finished yet (an open quote, a trailing `\`, a heredoc or a func block)
+// keeps reading on a continuation prompt.
+func REPL(ctx context.Context, in io.Reader, prompt io.Writer, options ScriptOptions) error {
+	script := newScript(ctx, options)
+	script.onErr = func(err error) {
+		writef(prompt, "%v\n", err)
+	}
+
+	reader := bufio.NewReader(in)
+	var pending []string
+	writef(prompt, "gosh> ")
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" || err == nil {
+			pending = append(pending, strings.TrimRight(line, "\r\n"))
+			if !replComplete(pending) && err == nil {
+				writef(prompt, "...> ")
+				continue
+			}
+			script.firstErr = nil
+			for _, parsed := range parseScriptLines(pending) {
+				script.runLine(parsed)
+			}
+			pending = nil
+		}
+		if errors.Is(err, io.EOF) {
+			writef(prompt, "\n")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if scriptContext(script.ctx).Err() != nil {
+			return script.ctx.Err()
+		}
+		writef(prompt, "gosh> ")
+	}
+}
+
+// replComplete reports whether lines form complete commands.
+func replComplete(lines []string) bool {
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if strings.HasSuffix(last, `\`) && !strings.HasSuffix(last, `\\`) {
+		return false
+	}
+	for _, line := range parseScriptLines(lines) {
+		if errors.Is(line.err, errIncomplete) {
+			return false
+		}
+	}
+	return true
+}
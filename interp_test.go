@@ -0,0 +1,72 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFilePassesArgsAndSkipsShebang(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.gosh")
+	content := "#!/usr/bin/env gosh\r\nset greeting = hello\r\necho ${greeting} ${1} ($#)\r\n"
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureStdout(func() error {
+		return RunFile(context.Background(), path, []string{"world"}, ScriptOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(output) != "hello world (1)" {
+		t.Fatalf("output = %q", output)
+	}
+
+	if err := os.WriteFile(path, []byte("missing-command-for-run-file\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err = RunFile(context.Background(), path, nil, ScriptOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 0 of "+path) {
+		t.Fatalf("RunFile error = %v", err)
+	}
+	if err := RunFile(context.Background(), filepath.Join(dir, "missing.gosh"), nil, ScriptOptions{}); err == nil {
+		t.Fatalf("expected missing file error")
+	}
+}
+
+func TestREPLKeepsStateAndReadsContinuations(t *testing.T) {
+	input := strings.Join([]string{
+		"set name = gosh",
+		"func greet who",
+		"echo hi ${who}",
+		"end",
+		"greet \\",
+		"  ${name}",
+		`printf "%s|" "multi`,
+		`line"`,
+		"missing-command-in-repl",
+		"echo done",
+	}, "\n")
+
+	var prompts bytes.Buffer
+	output, err := captureStdout(func() error {
+		return REPL(context.Background(), strings.NewReader(input), &prompts, ScriptOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "hi gosh\n") || !strings.Contains(output, "multi\nline|") || !strings.HasSuffix(output, "done\n") {
+		t.Fatalf("output = %q", output)
+	}
+	if strings.Count(prompts.String(), "...> ") != 4 {
+		t.Fatalf("prompts = %q", prompts.String())
+	}
+	if !strings.Contains(prompts.String(), "missing-command-in-repl") {
+		t.Fatalf("errors should be written to the prompt writer: %q", prompts.String())
+	}
+}
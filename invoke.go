@@ -229,22 +229,23 @@ func invokeLegacyCall(script *Script, call Call, rawArgs string) error {
 
 	switch classifyLegacyCall(rt) {
 	case legacyNoArgs:
-		return collectCallError(call.Func.Call(in))
+		return script.callGo(call.Func, in)
 	case legacyScriptOnly:
 		in = append(in, reflect.ValueOf(script))
-		return collectCallError(call.Func.Call(in))
+		return script.callGo(call.Func, in)
 	case legacyScriptRawInput:
 		in = append(in, reflect.ValueOf(script), reflect.ValueOf(rawArgs))
-		return collectCallError(call.Func.Call(in))
+		return script.callGo(call.Func, in)
 	case legacyRawInput:
 		in = append(in, reflect.ValueOf(rawArgs))
-		return collectCallError(call.Func.Call(in))
+		return script.callGo(call.Func, in)
 	default:
 		return fmt.Errorf("legacy command %s has unsupported signature; use Tool params for typed binding", call.Name)
 	}
 }
 
 func invokeStructuredCall(script *Script, call Call, args []string) error {
+	script.secrets.addArgs(call.Tool, args)
 	rt := call.Func.Type()
 	in := []reflect.Value{}
 	start := 0
@@ -269,7 +270,7 @@ func invokeStructuredCall(script *Script, call Call, args []string) error {
 		}
 		in = append(in, value)
 	}
-	return collectCallError(call.Func.Call(in))
+	return script.callGo(call.Func, in)
 }
 
 func zeroValueString(param ParamSpec) string {
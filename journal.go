@@ -0,0 +1,479 @@
+package gosh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Callers recorded in JournalEntry.Caller.
+const (
+	CallerCLI    = "cli"
+	CallerScript = "script"
+	CallerMCP    = "mcp"
+)
+
+// HistoryRetentionEnv names the environment variable that bounds the
+// journal: a number of entries such as `500`, or an age such as `30d` or
+// `72h`. The default keeps the last 1000 entries.
+const HistoryRetentionEnv = "GOSH_HISTORY_RETENTION"
+
+const (
+	journalFileName       = "journal.jsonl"
+	defaultJournalEntries = 1000
+)
+
+// JournalEntry records one run: a routed input, a script line or an MCP
+// tool call.
+type JournalEntry struct {
+	ID       string      `json:"id"`
+	Input    string      `json:"input"`
+	Route    RouteResult `json:"route"`
+	Caller   string      `json:"caller"`
+	Dir      string      `json:"dir,omitempty"`
+	Started  time.Time   `json:"started"`
+	Ended    time.Time   `json:"ended"`
+	ExitCode int         `json:"exit_code"`
+	Error    string      `json:"error,omitempty"`
+
+	// OutputDigest is the sha256 of the run's stdout, as `sha256:<hex>`,
+	// and OutputBytes its length. They are recorded when gosh captures the
+	// output, as for MCP tool calls, and for external programs when stdout
+	// is not a terminal; programs writing to a terminal are left attached
+	// to it.
+	OutputDigest string `json:"output_digest,omitempty"`
+	OutputBytes  int64  `json:"output_bytes,omitempty"`
+
+	// Session is the ID of the AISession recorded when the input went to
+	// the AI backend.
+	Session string `json:"session,omitempty"`
+}
+
+// Journal is an append-only JSONL file of JournalEntry lines. A nil
+// *Journal records nothing.
+type Journal struct {
+	Path string
+
+	// MaxEntries and MaxAge bound the entries kept. Older entries, and the
+	// AI sessions they link to, are removed when NewJournal opens the
+	// journal; Append only ever appends. Zero means no bound.
+	MaxEntries int
+	MaxAge     time.Duration
+
+	mu sync.Mutex
+}
+
+// NewJournal returns the journal in dir, bounded by HistoryRetentionEnv,
+// after removing the entries outside those bounds. It returns nil when dir
+// is "".
+func NewJournal(dir string) (*Journal, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	journal := &Journal{Path: filepath.Join(dir, journalFileName), MaxEntries: defaultJournalEntries}
+	if value := strings.TrimSpace(os.Getenv(HistoryRetentionEnv)); value != "" {
+		entries, age, err := parseRetention(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", HistoryRetentionEnv, err)
+		}
+		journal.MaxEntries, journal.MaxAge = entries, age
+	}
+	if err := journal.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// DefaultJournal returns the journal in the directory HistoryDirEnv names.
+// Journaling is opt-in: it returns nil when HistoryDirEnv is unset or `off`.
+func DefaultJournal() (*Journal, error) {
+	if value := os.Getenv(HistoryDirEnv); value == "" || strings.EqualFold(value, "off") {
+		return nil, nil
+	}
+	return NewJournal(DefaultHistoryDir())
+}
+
+// parseRetention reads a retention setting: an entry count, or an age in
+// days (`30d`) or as a Go duration (`72h`).
+func parseRetention(value string) (int, time.Duration, error) {
+	if entries, err := strconv.Atoi(value); err == nil && entries >= 0 {
+		return entries, 0, nil
+	}
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return 0, time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age > 0 {
+		return 0, age, nil
+	}
+	return 0, 0, fmt.Errorf("invalid retention %q: expected an entry count, or an age such as 30d or 72h", value)
+}
+
+// dir returns the directory holding the journal and its AI sessions.
+func (j *Journal) dir() string {
+	return filepath.Dir(j.Path)
+}
+
+// Append adds an entry to the end of the journal.
+func (j *Journal) Append(entry JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+	if entry.ID == "" {
+		started := entry.Started
+		if started.IsZero() {
+			started = time.Now()
+		}
+		entry.ID = newSessionID(started)
+	}
+	line, err := json.Marshal(entry.masked(nil))
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(j.dir(), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// prune rewrites the journal without the entries outside its bounds and
+// removes their AI sessions.
+func (j *Journal) prune(now time.Time) error {
+	if j.MaxEntries <= 0 && j.MaxAge <= 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+	first := 0
+	if j.MaxEntries > 0 && len(entries) > j.MaxEntries {
+		first = len(entries) - j.MaxEntries
+	}
+	for j.MaxAge > 0 && first < len(entries) && now.Sub(entries[first].Started) > j.MaxAge {
+		first++
+	}
+	if first == 0 {
+		return nil
+	}
+
+	var kept bytes.Buffer
+	for _, entry := range entries[first:] {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		kept.Write(append(line, '\n'))
+	}
+	temp := j.Path + ".tmp"
+	if err := os.WriteFile(temp, kept.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, j.Path); err != nil {
+		return err
+	}
+	for _, entry := range entries[:first] {
+		if entry.Session != "" && !strings.ContainsAny(entry.Session, `/\`) {
+			_ = os.Remove(filepath.Join(j.dir(), entry.Session+".json"))
+		}
+	}
+	return nil
+}
+
+// Entries returns the journal's entries, oldest first. Lines that are not
+// entries, such as one cut short by a crash, are skipped.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.read()
+}
+
+func (j *Journal) read() ([]JournalEntry, error) {
+	file, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Entry returns the entry whose ID is id or, if only one matches, starts
+// with id.
+func (j *Journal) Entry(id string) (JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	var found []JournalEntry
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+		if id != "" && strings.HasPrefix(entry.ID, id) {
+			found = append(found, entry)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return JournalEntry{}, fmt.Errorf("no run %q in the journal", id)
+	case 1:
+		return found[0], nil
+	}
+	return JournalEntry{}, fmt.Errorf("run id %q is ambiguous: %d runs match", id, len(found))
+}
+
+// run calls fn as the run entry describes and appends the entry with its
+// timing, exit status and output digest. fn's context carries the digest
+// for the external programs it runs. A failure to write the journal is
+// reported on stderr; fn's error is returned.
+func (j *Journal) run(ctx context.Context, entry *JournalEntry, fn func(ctx context.Context) error) error {
+	if j == nil {
+		return fn(ctx)
+	}
+	entry.Started = time.Now()
+	if entry.Dir == "" {
+		entry.Dir, _ = os.Getwd()
+	}
+	digest := newOutputDigest()
+	err := fn(withOutputDigest(ctx, digest))
+	if digest.attached {
+		digest.record(entry)
+	}
+	j.finish(entry, err, contextSecrets(ctx))
+	return err
+}
+
+// finish records how a run ended and appends it, with the values in
+// secrets masked.
+func (j *Journal) finish(entry *JournalEntry, err error, secrets *secretSet) {
+	if j == nil {
+		return
+	}
+	entry.Ended = time.Now()
+	entry.ExitCode = exitCode(err)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if appendErr := j.Append(entry.masked(secrets)); appendErr != nil {
+		writef(os.Stderr, "gosh: journal: %v\n", appendErr)
+	}
+}
+
+// outputDigest hashes and counts output.
+type outputDigest struct {
+	hash  hash.Hash
+	bytes int64
+
+	// attached is set once a program's stdout is written to the digest.
+	attached bool
+}
+
+// outputDigestKey is the context key of the digest that the external
+// programs of a journaled run write their stdout to.
+type outputDigestKey struct{}
+
+func withOutputDigest(ctx context.Context, digest *outputDigest) context.Context {
+	return context.WithValue(ctx, outputDigestKey{}, digest)
+}
+
+// contextOutputDigest returns the digest carried by ctx, if any.
+func contextOutputDigest(ctx context.Context) *outputDigest {
+	digest, _ := ctx.Value(outputDigestKey{}).(*outputDigest)
+	return digest
+}
+
+// tee returns stdout writing to the digest as well, unless stdout is a
+// terminal, which programs are left attached to.
+func (d *outputDigest) tee(stdout *os.File) io.Writer {
+	if d == nil || isTerminal(stdout) {
+		return stdout
+	}
+	d.attached = true
+	return io.MultiWriter(stdout, d)
+}
+
+func newOutputDigest() *outputDigest {
+	return &outputDigest{hash: sha256.New()}
+}
+
+func (d *outputDigest) Write(p []byte) (int, error) {
+	d.bytes += int64(len(p))
+	return d.hash.Write(p)
+}
+
+func (d *outputDigest) record(entry *JournalEntry) {
+	entry.OutputDigest = "sha256:" + hex.EncodeToString(d.hash.Sum(nil))
+	entry.OutputBytes = d.bytes
+}
+
+// digestOutput records the digest of captured output in entry.
+func digestOutput(entry *JournalEntry, output string) {
+	digest := newOutputDigest()
+	_, _ = io.WriteString(digest, output)
+	digest.record(entry)
+}
+
+// runHistory implements the `history [--sessions] [--json]` and
+// `history show <id> [--json]` meta commands. `--sessions` lists the AI
+// sessions saved in dir instead of the journal. Show accepts a run or an
+// AI session ID, or a unique prefix of one.
+func runHistory(w io.Writer, args []string, dir string, journal *Journal) error {
+	asJSON, listSessions := false, false
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "--sessions":
+			listSessions = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if listSessions && len(rest) == 0 {
+		return listAISessions(w, dir, asJSON)
+	}
+	if journal == nil {
+		return fmt.Errorf("history: the journal is off; set %s", HistoryDirEnv)
+	}
+
+	switch {
+	case len(rest) == 0 && !listSessions:
+		entries, err := journal.Entries()
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			if entries == nil {
+				entries = []JournalEntry{}
+			}
+			return writeJSON(w, entries)
+		}
+		for _, entry := range entries {
+			writef(w, "%s  %s  %-6s  exit %-3d  %s\n", entry.ID, entry.Started.Local().Format("2006-01-02 15:04"),
+				entry.Caller, entry.ExitCode, entry.Input)
+		}
+		return nil
+	case len(rest) == 2 && rest[0] == "show" && !listSessions:
+		entry, err := journal.Entry(rest[1])
+		if err != nil {
+			session, sessionErr := LoadSession(journal.dir(), rest[1])
+			if sessionErr != nil {
+				return err
+			}
+			if asJSON {
+				return writeJSON(w, session)
+			}
+			writeSession(w, session)
+			return nil
+		}
+		var session *AISession
+		if entry.Session != "" {
+			if loaded, err := LoadSession(journal.dir(), entry.Session); err == nil {
+				session = &loaded
+			}
+		}
+		if asJSON {
+			return writeJSON(w, struct {
+				JournalEntry
+				AISession *AISession `json:"ai_session,omitempty"`
+			}{entry, session})
+		}
+		writeJournalEntry(w, entry)
+		if session != nil {
+			writef(w, "\n")
+			writeSession(w, *session)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid meta command: expected `history [--sessions] [--json]` or `history show <id> [--json]`")
+}
+
+// listAISessions prints the AI sessions saved in dir, newest first.
+func listAISessions(w io.Writer, dir string, asJSON bool) error {
+	if dir == "" {
+		return fmt.Errorf("history: AI session recording is off; set %s", HistoryDirEnv)
+	}
+	sessions, err := Sessions(dir)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if sessions == nil {
+			sessions = []AISession{}
+		}
+		return writeJSON(w, sessions)
+	}
+	for _, session := range sessions {
+		writef(w, "%s  %s  %-8s  exit %-3d  %6s  %s\n", session.ID, session.Started.Local().Format("2006-01-02 15:04"),
+			sessionBackendName(session.Backend), session.ExitCode, session.Duration.Round(time.Second), session.Input)
+	}
+	return nil
+}
+
+// writeJournalEntry prints an entry for people.
+func writeJournalEntry(w io.Writer, entry JournalEntry) {
+	writef(w, "run:      %s\n", entry.ID)
+	writef(w, "input:    %s\n", entry.Input)
+	writef(w, "caller:   %s\n", entry.Caller)
+	writef(w, "route:    %s\n", entry.Route.Kind)
+	if entry.Route.Reason != "" {
+		writef(w, "reason:   %s\n", entry.Route.Reason)
+	}
+	writef(w, "dir:      %s\n", entry.Dir)
+	writef(w, "started:  %s\n", entry.Started.Local().Format(time.RFC3339))
+	writef(w, "duration: %s\n", entry.Ended.Sub(entry.Started))
+	writef(w, "exit:     %d\n", entry.ExitCode)
+	if entry.Error != "" {
+		writef(w, "error:    %s\n", entry.Error)
+	}
+	if entry.OutputDigest != "" {
+		writef(w, "output:   %s (%d bytes)\n", entry.OutputDigest, entry.OutputBytes)
+	}
+	if entry.Session != "" {
+		writef(w, "session:  %s\n", entry.Session)
+	}
+}
@@ -0,0 +1,250 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var goshJournalTestCalls []string
+
+var _ = Tool("GoshJournalTestEcho", func(text string) {
+	goshJournalTestCalls = append(goshJournalTestCalls, text)
+	_, _ = os.Stdout.WriteString(text + "\n")
+},
+	Desc("Echo text for journal tests"),
+	Param("text"),
+)
+
+func testJournal(t *testing.T) *Journal {
+	t.Helper()
+	return &Journal{Path: filepath.Join(t.TempDir(), journalFileName)}
+}
+
+func TestJournalRecordsScriptLines(t *testing.T) {
+	journal := testJournal(t)
+	err := RunWithOptions(context.Background(), "set x = hello there\nGoshJournalTestEcho ${x}\nprintf ${x}\ngosh-journal-test-missing", ScriptOptions{Journal: journal})
+	if err == nil {
+		t.Fatal("missing command ran")
+	}
+	entries, err := journal.Entries()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	echo, printf, missing := entries[0], entries[1], entries[2]
+	if echo.Input != "GoshJournalTestEcho 'hello there'" || echo.Caller != CallerScript || echo.Route.Kind != RouteGoshCommand ||
+		echo.ExitCode != 0 || echo.Ended.Before(echo.Started) || echo.Dir == "" {
+		t.Fatalf("echo entry = %+v", echo)
+	}
+	// The digest is taken from the stdout of external programs; Go calls
+	// write to the process's stdout, which is not swapped out.
+	if echo.OutputDigest != "" {
+		t.Fatalf("Go call output was digested: %+v", echo)
+	}
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello there"))); printf.OutputDigest != want || printf.OutputBytes != 11 {
+		t.Fatalf("printf entry = %+v", printf)
+	}
+	if missing.ExitCode != 1 || !strings.Contains(missing.Error, "not found") {
+		t.Fatalf("missing entry = %+v", missing)
+	}
+}
+
+func TestJournalSkipsDryRuns(t *testing.T) {
+	journal := testJournal(t)
+	planToolRuns, planHookRuns = nil, nil
+	if _, err := Plan(context.Background(), "goshPlanTestDeploy staging", ScriptOptions{Journal: journal}); err != nil {
+		t.Fatal(err)
+	}
+	if planToolRuns != nil || len(planHookRuns) != 1 {
+		t.Fatalf("tool runs = %q, hook runs = %q", planToolRuns, planHookRuns)
+	}
+	if entries, err := journal.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+}
+
+func TestJournalRecordsMCPCalls(t *testing.T) {
+	journal := testJournal(t)
+	if _, rpcErr := callMCPToolWithOptions("GoshJournalTestEcho", map[string]interface{}{"text": "from mcp"}, MCPOptions{Journal: journal}); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	entries, _ := journal.Entries()
+	if len(entries) != 1 || entries[0].Caller != CallerMCP || entries[0].Input != "GoshJournalTestEcho 'from mcp'" ||
+		entries[0].Route.Kind != RouteGoshCommand || entries[0].OutputBytes != 9 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("from mcp\n"))); entries[0].OutputDigest != want {
+		t.Fatalf("digest = %q, want %q", entries[0].OutputDigest, want)
+	}
+}
+
+func TestJournalRetention(t *testing.T) {
+	journal := testJournal(t)
+	journal.MaxEntries = 2
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		session := AISession{ID: newSessionID(now.Add(time.Duration(i) * time.Second))}
+		if err := SaveSession(journal.dir(), session); err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Append(JournalEntry{Input: string(rune('a' + i)), Started: now.Add(time.Duration(i) * time.Second), Session: session.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, _ := journal.Entries(); len(entries) != 3 {
+		t.Fatalf("Append pruned the journal: %+v", entries)
+	}
+
+	t.Setenv(HistoryRetentionEnv, "2")
+	journal, err := NewJournal(journal.dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := journal.Entries()
+	if len(entries) != 2 || entries[0].Input != "b" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if sessions, _ := Sessions(journal.dir()); len(sessions) != 2 {
+		t.Fatalf("sessions kept = %d", len(sessions))
+	}
+
+	journal.MaxEntries, journal.MaxAge = 0, time.Hour
+	if err := journal.Append(JournalEntry{Input: "new", Started: now.Add(2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.prune(now.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := journal.Entries(); len(entries) != 1 || entries[0].Input != "new" {
+		t.Fatalf("entries after age bound = %+v", entries)
+	}
+
+	cases := map[string][2]interface{}{
+		"500": {500, time.Duration(0)},
+		"30d": {0, 30 * 24 * time.Hour},
+		"72h": {0, 72 * time.Hour},
+	}
+	for value, want := range cases {
+		entries, age, err := parseRetention(value)
+		if err != nil || entries != want[0] || age != want[1] {
+			t.Fatalf("parseRetention(%q) = %d, %s, %v", value, entries, age, err)
+		}
+	}
+	if _, _, err := parseRetention("forever"); err == nil {
+		t.Fatal("invalid retention accepted")
+	}
+	t.Setenv(HistoryRetentionEnv, "-1d")
+	if _, err := NewJournal(t.TempDir()); err == nil {
+		t.Fatal("NewJournal accepted an invalid retention")
+	}
+}
+
+func TestDefaultJournalIsOptIn(t *testing.T) {
+	for _, value := range []string{"", "off"} {
+		t.Setenv(HistoryDirEnv, value)
+		if journal, err := DefaultJournal(); journal != nil || err != nil {
+			t.Fatalf("%s=%q: journal = %+v, %v", HistoryDirEnv, value, journal, err)
+		}
+	}
+	dir := t.TempDir()
+	t.Setenv(HistoryDirEnv, dir)
+	if journal, err := DefaultJournal(); err != nil || journal == nil || journal.Path != filepath.Join(dir, journalFileName) {
+		t.Fatalf("journal = %+v, %v", journal, err)
+	}
+}
+
+func TestMenuHistoryAndRerun(t *testing.T) {
+	oldArgs := os.Args
+	oldDefaultErr := defaultErr
+	defer func() {
+		os.Args = oldArgs
+		defaultErr = oldDefaultErr
+	}()
+	var gotErr error
+	defaultErr = func(err error) { gotErr = err }
+	goshJournalTestCalls = nil
+	historyDir := t.TempDir()
+
+	os.Args = []string{"goshfile", "GoshJournalTestEcho", "first"}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir, Stdout: &bytes.Buffer{}})
+	if gotErr != nil {
+		t.Fatal(gotErr)
+	}
+
+	var out bytes.Buffer
+	os.Args = []string{"goshfile", "--json", "history"}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir, Stdout: &out})
+	var entries []JournalEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil || gotErr != nil || len(entries) != 1 || entries[0].Caller != CallerCLI {
+		t.Fatalf("history = %q, %v, %v", out.String(), err, gotErr)
+	}
+
+	out.Reset()
+	os.Args = []string{"goshfile", "history", "show", entries[0].ID}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir, Stdout: &out})
+	if gotErr != nil || !strings.Contains(out.String(), "input:    GoshJournalTestEcho first") || !strings.Contains(out.String(), "route:    gosh_command") {
+		t.Fatalf("history show = %q, %v", out.String(), gotErr)
+	}
+
+	var stderr bytes.Buffer
+	os.Args = []string{"goshfile", "rerun", entries[0].ID}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir, Stdout: &bytes.Buffer{}, Stderr: &stderr})
+	if gotErr != nil || !reflect.DeepEqual(goshJournalTestCalls, []string{"first", "first"}) || !strings.Contains(stderr.String(), "gosh: rerun") {
+		t.Fatalf("rerun: calls=%v stderr=%q err=%v", goshJournalTestCalls, stderr.String(), gotErr)
+	}
+
+	os.Args = []string{"goshfile", "rerun", "nope"}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir})
+	if gotErr == nil || !strings.Contains(gotErr.Error(), "no run") {
+		t.Fatalf("unknown rerun id = %v", gotErr)
+	}
+	gotErr = nil
+	os.Args = []string{"goshfile", "history", "bogus"}
+	MenuWithOptions(MenuOptions{HistoryDir: historyDir})
+	if gotErr == nil {
+		t.Fatal("invalid history command accepted")
+	}
+}
+
+func TestRouteJournalLinksAISession(t *testing.T) {
+	journal := testJournal(t)
+	var session AISession
+	err := RouteWithOptions(context.Background(), "do something clever", RouteOptions{
+		Policy:     DefaultPolicy(),
+		Backend:    &recordingBackend{},
+		OnSession:  func(s AISession) { session = s },
+		HistoryDir: journal.dir(),
+		Journal:    journal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := journal.Entries()
+	if len(entries) != 1 || entries[0].Session == "" || entries[0].Session != session.ID || entries[0].Route.Kind != RouteNeedsAI {
+		t.Fatalf("entries = %+v, session %q", entries, session.ID)
+	}
+
+	var out bytes.Buffer
+	if err := runHistory(&out, []string{"show", session.ID}, journal.dir(), journal); err != nil || !strings.Contains(out.String(), "session:  "+session.ID) {
+		t.Fatalf("show by session id = %q, %v", out.String(), err)
+	}
+}
+
+func TestRouteJournalDigestsProgramOutput(t *testing.T) {
+	journal := testJournal(t)
+	if err := RouteWithOptions(context.Background(), "printf routed", RouteOptions{Policy: DefaultPolicy(), Journal: journal}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := journal.Entries()
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("routed"))); len(entries) != 1 || entries[0].OutputDigest != want {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
@@ -0,0 +1,189 @@
+package gosh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCPULimit reports an external command stopped for using more CPU
+	// time than Limits.CPUSeconds.
+	ErrCPULimit = errors.New("cpu time limit exceeded")
+
+	// ErrOutputLimit reports an external command stopped for writing more
+	// than Limits.OutputBytes.
+	ErrOutputLimit = errors.New("output limit exceeded")
+
+	// ErrLimitsUnsupported is returned when resource limits are set on a
+	// system that cannot apply them.
+	ErrLimitsUnsupported = errors.New("resource limits are not supported on this system")
+)
+
+// SecretEnvPatterns match environment variable names that commonly hold
+// credentials. SafePolicy and ReadOnlyPolicy strip them from external
+// commands.
+var SecretEnvPatterns = []string{
+	"*_TOKEN", "*_TOKEN_*", "*_SECRET", "*_SECRET_*", "*_PASSWORD", "*_PASSWD",
+	"*_API_KEY", "*_APIKEY", "*_ACCESS_KEY", "*_ACCESS_KEY_ID", "*_PRIVATE_KEY", "*_CREDENTIALS",
+	"AWS_*", "AZURE_*", "GOOGLE_APPLICATION_CREDENTIALS", "GH_TOKEN", "GITHUB_TOKEN", "NPM_TOKEN",
+}
+
+// Limits bounds the resources of each external command a script runs.
+// Zero fields are unlimited. CPU time, address space, open files and
+// processes are Linux rlimits, applied as soon as the command starts;
+// elsewhere commands fail with ErrLimitsUnsupported when they are set.
+// Processes counts every process of the user, as RLIMIT_NPROC does.
+type Limits struct {
+	CPUSeconds   uint64 `json:"cpu_seconds,omitempty"`
+	AddressSpace uint64 `json:"address_space_bytes,omitempty"`
+	OpenFiles    uint64 `json:"open_files,omitempty"`
+	Processes    uint64 `json:"processes,omitempty"`
+	OutputBytes  int64  `json:"output_bytes,omitempty"`
+}
+
+// LimitError reports an external command stopped for exceeding a limit.
+// It wraps ErrCPULimit or ErrOutputLimit.
+type LimitError struct {
+	Command string
+	Limit   string
+	Value   int64
+	Err     error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %v (%s limit %d)", e.Command, e.Err, e.Limit, e.Value)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+func (l Limits) rlimited() bool {
+	return l.CPUSeconds > 0 || l.AddressSpace > 0 || l.OpenFiles > 0 || l.Processes > 0
+}
+
+// tighter combines two sets of limits, keeping the smaller non-zero value of
+// each.
+func (l Limits) tighter(other Limits) Limits {
+	minUint := func(a, b uint64) uint64 {
+		if a == 0 || (b != 0 && b < a) {
+			return b
+		}
+		return a
+	}
+	output := l.OutputBytes
+	if output == 0 || (other.OutputBytes != 0 && other.OutputBytes < output) {
+		output = other.OutputBytes
+	}
+	return Limits{
+		CPUSeconds:   minUint(l.CPUSeconds, other.CPUSeconds),
+		AddressSpace: minUint(l.AddressSpace, other.AddressSpace),
+		OpenFiles:    minUint(l.OpenFiles, other.OpenFiles),
+		Processes:    minUint(l.Processes, other.Processes),
+		OutputBytes:  output,
+	}
+}
+
+// limits returns the script's limits combined with its policy's.
+func (s *Script) limits() Limits {
+	limits := s.options.Limits
+	if s.options.Policy != nil {
+		limits = limits.tighter(s.options.Policy.Limits)
+	}
+	return limits
+}
+
+// childEnv returns the environment for external commands, filtered by the
+// script's and the policy's EnvAllow and EnvDeny patterns.
+func (s *Script) childEnv() []string {
+	filters := [][2][]string{{s.options.EnvAllow, s.options.EnvDeny}}
+	if s.options.Policy != nil {
+		filters = append(filters, [2][]string{s.options.Policy.EnvAllow, s.options.Policy.EnvDeny})
+	}
+	env := make([]string, 0, len(s.env))
+	for name, value := range s.env {
+		if envPassed(name, filters) {
+			env = append(env, name+"="+value)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+func envPassed(name string, filters [][2][]string) bool {
+	for _, filter := range filters {
+		allow, deny := filter[0], filter[1]
+		if matchEnvName(deny, name) || (len(allow) > 0 && !matchEnvName(allow, name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchEnvName(patterns []string, name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(strings.ToUpper(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// outputLimit counts the bytes a command writes to stdout and stderr and
+// stops it once they exceed the limit.
+type outputLimit struct {
+	mu        sync.Mutex
+	remaining int64
+	exceeded  bool
+	stop      func()
+}
+
+func (o *outputLimit) writer(w io.Writer) io.Writer {
+	return outputLimitWriter{limit: o, w: w}
+}
+
+type outputLimitWriter struct {
+	limit *outputLimit
+	w     io.Writer
+}
+
+func (lw outputLimitWriter) Write(p []byte) (int, error) {
+	o := lw.limit
+	o.mu.Lock()
+	allowed := int64(len(p))
+	if allowed > o.remaining {
+		allowed = o.remaining
+	}
+	o.remaining -= allowed
+	exceeded := allowed < int64(len(p))
+	first := exceeded && !o.exceeded
+	if exceeded {
+		o.exceeded = true
+	}
+	o.mu.Unlock()
+
+	if allowed > 0 {
+		if _, err := lw.w.Write(p[:allowed]); err != nil {
+			return 0, err
+		}
+	}
+	if first {
+		o.stop()
+	}
+	if exceeded {
+		return int(allowed), ErrOutputLimit
+	}
+	return len(p), nil
+}
+
+func (o *outputLimit) wasExceeded() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.exceeded
+}
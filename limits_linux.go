@@ -0,0 +1,131 @@
+//go:build linux
+// +build linux
+
+package gosh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	rlimitsSupported = true
+	rlimitNproc      = 6
+)
+
+// startLimited starts cmd with limits already in place when it begins to
+// run. The command is started traced, so it stops at exec; the limits are
+// set with prlimit(2) and the tracer detaches. Tracing is tied to the OS
+// thread that starts the command, so callers must lock theirs. As with the
+// sandbox, set-user-ID programs run without their privileges.
+func startLimited(cmd *exec.Cmd, limits Limits) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	var status syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &status, 0, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			abandonStart(cmd)
+			return fmt.Errorf("starting %s: %w", cmd.Path, err)
+		}
+		break
+	}
+	if !status.Stopped() {
+		abandonStart(cmd)
+		return fmt.Errorf("starting %s: process did not stop at exec", cmd.Path)
+	}
+	if err := applyRlimits(pid, limits); err != nil {
+		abandonStart(cmd)
+		return err
+	}
+	if err := syscall.PtraceDetach(pid); err != nil {
+		abandonStart(cmd)
+		return fmt.Errorf("starting %s: %w", cmd.Path, err)
+	}
+	return nil
+}
+
+// abandonStart kills and reaps a command that could not be started
+// properly, so it is not left stopped under the tracer or unreaped.
+func abandonStart(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+}
+
+// setProcessGroup starts cmd in a process group of its own, so
+// killProcessGroup also stops the programs it starts.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessGroup kills a command started with setProcessGroup and
+// everything in its group.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// applyRlimits sets limits on a process with prlimit(2).
+func applyRlimits(pid int, limits Limits) error {
+	settings := []struct {
+		resource int
+		name     string
+		value    uint64
+		hard     uint64
+	}{
+		// The hard CPU limit is one second later, so the command first gets
+		// SIGXCPU and only then SIGKILL.
+		{syscall.RLIMIT_CPU, "cpu", limits.CPUSeconds, limits.CPUSeconds + 1},
+		{syscall.RLIMIT_AS, "address space", limits.AddressSpace, limits.AddressSpace},
+		{syscall.RLIMIT_NOFILE, "open files", limits.OpenFiles, limits.OpenFiles},
+		{rlimitNproc, "processes", limits.Processes, limits.Processes},
+	}
+	for _, setting := range settings {
+		if setting.value == 0 {
+			continue
+		}
+		limit := syscall.Rlimit{Cur: setting.value, Max: setting.hard}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(setting.resource), uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("setting %s limit: %w", setting.name, errno)
+		}
+	}
+	return nil
+}
+
+// cpuLimitExceeded reports whether a command was stopped by its CPU limit.
+func cpuLimitExceeded(state *os.ProcessState, limits Limits) bool {
+	if state == nil || limits.CPUSeconds == 0 {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+	if status.Signal() == syscall.SIGXCPU {
+		return true
+	}
+	used := state.UserTime() + state.SystemTime()
+	return status.Signal() == syscall.SIGKILL && used >= time.Duration(limits.CPUSeconds)*time.Second
+}
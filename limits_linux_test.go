@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package gosh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCPULimitStopsCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not on PATH")
+	}
+	err := RunWithOptions(context.Background(), `sh -c "while :; do :; done"`, ScriptOptions{Limits: Limits{CPUSeconds: 1}})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrCPULimit) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOpenFilesLimitApplies(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not on PATH")
+	}
+	err := RunWithOptions(context.Background(), `sh -c "test $(ulimit -n) = 32"`, ScriptOptions{Limits: Limits{OpenFiles: 32}})
+	if err != nil {
+		t.Fatalf("open files limit not applied: %v", err)
+	}
+}
+
+func TestOutputLimitStopsChildProcesses(t *testing.T) {
+	for _, name := range []string{"sh", "sleep", "yes"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not on PATH", name)
+		}
+	}
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	start := time.Now()
+	_, err := captureStdout(func() error {
+		return RunWithOptions(context.Background(), `sh -c "sleep 60 & echo $! > `+pidFile+`; yes"`, ScriptOptions{Limits: Limits{OutputBytes: 64}})
+	})
+	if !errors.Is(err, ErrOutputLimit) || time.Since(start) > 30*time.Second {
+		t.Fatalf("err = %v after %s", err, time.Since(start))
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatal("a child of a command over its output limit kept running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
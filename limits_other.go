@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package gosh
+
+import (
+	"os"
+	"os/exec"
+)
+
+const rlimitsSupported = false
+
+func startLimited(cmd *exec.Cmd, limits Limits) error {
+	return ErrLimitsUnsupported
+}
+
+// setProcessGroup does nothing where process groups are not used.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command itself.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+func cpuLimitExceeded(state *os.ProcessState, limits Limits) bool {
+	return false
+}
@@ -0,0 +1,78 @@
+package gosh
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestChildEnvFilters(t *testing.T) {
+	script := testScript(t.TempDir())
+	script.env = map[string]string{
+		"PATH":         "/bin",
+		"HOME":         "/home/me",
+		"GITHUB_TOKEN": "t",
+		"aws_region":   "x",
+		"DB_PASSWORD":  "p",
+		"EDITOR":       "vi",
+	}
+	if got := strings.Join(script.childEnv(), " "); got != "DB_PASSWORD=p EDITOR=vi GITHUB_TOKEN=t HOME=/home/me PATH=/bin aws_region=x" {
+		t.Fatalf("unfiltered env = %s", got)
+	}
+
+	policy := SafePolicy()
+	script.options.Policy = &policy
+	if got := strings.Join(script.childEnv(), " "); got != "EDITOR=vi HOME=/home/me PATH=/bin" {
+		t.Fatalf("safe policy env = %s", got)
+	}
+
+	script.options.EnvAllow = []string{"PATH", "HOME", "*_TOKEN"}
+	if got := strings.Join(script.childEnv(), " "); got != "HOME=/home/me PATH=/bin" {
+		t.Fatalf("allowlisted env = %s", got)
+	}
+}
+
+func TestLimitsTighter(t *testing.T) {
+	got := Limits{CPUSeconds: 10, OpenFiles: 64, OutputBytes: 100}.tighter(Limits{CPUSeconds: 5, Processes: 8, OutputBytes: 1000})
+	want := Limits{CPUSeconds: 5, OpenFiles: 64, Processes: 8, OutputBytes: 100}
+	if got != want {
+		t.Fatalf("tighter = %+v", got)
+	}
+}
+
+func TestOutputLimitStopsCommand(t *testing.T) {
+	if _, err := exec.LookPath("yes"); err != nil {
+		t.Skip("yes is not on PATH")
+	}
+	var runErr error
+	output, err := captureStdout(func() error {
+		runErr = RunWithOptions(context.Background(), "yes", ScriptOptions{Limits: Limits{OutputBytes: 64}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limitErr *LimitError
+	if !errors.As(runErr, &limitErr) || !errors.Is(runErr, ErrOutputLimit) || limitErr.Command != "yes" {
+		t.Fatalf("err = %v", runErr)
+	}
+	if len(output) != 64 {
+		t.Fatalf("output = %d bytes", len(output))
+	}
+}
+
+func TestPolicyLimitsApplyToScripts(t *testing.T) {
+	if _, err := exec.LookPath("yes"); err != nil {
+		t.Skip("yes is not on PATH")
+	}
+	policy := DefaultPolicy()
+	policy.Limits.OutputBytes = 10
+	_, err := captureStdout(func() error {
+		return RunWithOptions(context.Background(), "yes", ScriptOptions{Policy: &policy})
+	})
+	if !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("err = %v", err)
+	}
+}
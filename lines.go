@@ -0,0 +1,240 @@
+package gosh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errIncomplete marks parse errors caused by input that ends too early, such
+// as an open quote or a heredoc without its delimiter. An interactive reader
+// can keep reading when it sees one.
+var errIncomplete = errors.New("incomplete input")
+
+type incompleteError struct {
+	msg string
+}
+
+func (e incompleteError) Error() string { return e.msg }
+
+func (e incompleteError) Is(target error) bool { return target == errIncomplete }
+
+// scriptLine is one logical command, assembled from one or more physical
+// script lines.
+type scriptLine struct {
+	num     int     // index of the first physical line
+	text    string  // command text, with continuations joined
+	heredoc *string // heredoc body bound to the command, if any
+	literal bool    // heredoc delimiter was quoted, so the body is not expanded
+	def     *scriptFunc
+	err     error // parse error for this line
+}
+
+// parseScriptLines joins physical lines into logical commands.
+//
+// A trailing unquoted `\` continues a command on the next line. Executables
+// and structured commands may also leave a quote open across lines; legacy
+// commands receive their input unsplit, so their quotes never span lines.
+// A final `<<DELIM` (or `<<-DELIM`, `<<'DELIM'`) reads the following lines
+// up to DELIM as the command's heredoc.
+func parseScriptLines(lines []string) []scriptLine {
+	var out []scriptLine
+	for i := 0; i < len(lines); i++ {
+		text := strings.TrimSpace(lines[i])
+		if text == "" || strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		line := scriptLine{num: i}
+		raw := legacyLine(text)
+		spansLines := false
+		for {
+			quote, continued := lineContinues(text, raw)
+			if !continued && quote == 0 {
+				break
+			}
+			if i+1 >= len(lines) {
+				if quote != 0 {
+					line.err = incompleteError{"unterminated quote"}
+				}
+				text = strings.TrimSuffix(text, `\`)
+				break
+			}
+			i++
+			if quote != 0 {
+				text += "\n" + lines[i]
+				spansLines = true
+			} else {
+				text = strings.TrimSpace(strings.TrimSuffix(text, `\`)) + " " + strings.TrimSpace(lines[i])
+			}
+		}
+
+		if line.err == nil {
+			if command, delim, stripTabs, literal, ok := heredocMarker(text); ok {
+				text = command
+				line.literal = literal
+				var body []string
+				found := false
+				for i+1 < len(lines) {
+					i++
+					if strings.TrimSpace(lines[i]) == delim {
+						found = true
+						break
+					}
+					body = append(body, lines[i])
+				}
+				if !found {
+					line.err = incompleteError{fmt.Sprintf("heredoc delimited by %q was not terminated", delim)}
+				}
+				content := heredocBody(body, stripTabs)
+				line.heredoc = &content
+			}
+		}
+
+		if !spansLines {
+			text = strings.ReplaceAll(text, "\t", " ")
+		}
+		line.text = strings.TrimSpace(text)
+		out = append(out, line)
+	}
+	return groupFuncs(out)
+}
+
+// legacyLine reports whether a line starts with a legacy command, whose raw
+// input is passed through unsplit.
+func legacyLine(text string) bool {
+	first := text
+	if end := strings.IndexAny(text, " \t"); end != -1 {
+		first = text[:end]
+	}
+	if strings.Contains(first, "$") {
+		return false
+	}
+	call, ok := Calls[strings.ToLower(first)]
+	return ok && !call.Tool.Structured
+}
+
+// lineContinues reports the quote left open at the end of text, and whether
+// text ends with an unquoted line-continuation backslash.
+func lineContinues(text string, raw bool) (rune, bool) {
+	if raw {
+		return 0, strings.HasSuffix(text, `\`) && !strings.HasSuffix(text, `\\`)
+	}
+	runes := []rune(text)
+	var quote rune
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\\' && quote != '\'':
+			if i+1 >= len(runes) {
+				return quote, quote == 0
+			}
+			i++
+		case ch == '$' && quote != '\'' && i+1 < len(runes) && runes[i+1] == '{':
+			if end := matchingBrace(runes, i+1); end >= 0 {
+				i = end
+			}
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		}
+	}
+	return quote, false
+}
+
+// heredocMarker finds a `<<DELIM` at the end of a command line. A `<<`
+// inside quotes or escaped is part of an argument.
+func heredocMarker(text string) (command, delim string, stripTabs, literal, ok bool) {
+	idx := lastUnquotedHeredoc(text)
+	if idx == -1 {
+		return "", "", false, false, false
+	}
+	marker := strings.TrimSpace(text[idx+2:])
+	if strings.HasPrefix(marker, "-") {
+		stripTabs = true
+		marker = strings.TrimSpace(marker[1:])
+	}
+	if len(marker) >= 2 && (marker[0] == '\'' || marker[0] == '"') && marker[len(marker)-1] == marker[0] {
+		literal = true
+		marker = marker[1 : len(marker)-1]
+	}
+	if marker == "" {
+		return "", "", false, false, false
+	}
+	for _, ch := range marker {
+		if !isNameRune(ch) {
+			return "", "", false, false, false
+		}
+	}
+	return strings.TrimSpace(text[:idx]), marker, stripTabs, literal, true
+}
+
+// lastUnquotedHeredoc returns the byte offset of the last `<<` outside
+// quotes in text, or -1. It follows the quoting rules of lineContinues.
+func lastUnquotedHeredoc(text string) int {
+	runes := []rune(text)
+	var quote rune
+	last := -1
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\\' && quote != '\'':
+			i++
+		case ch == '$' && quote != '\'' && i+1 < len(runes) && runes[i+1] == '{':
+			if end := matchingBrace(runes, i+1); end >= 0 {
+				i = end
+			}
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '<' && i+1 < len(runes) && runes[i+1] == '<':
+			last = len(string(runes[:i]))
+			i++
+		}
+	}
+	return last
+}
+
+// heredocBody joins heredoc lines. `<<-` strips all leading tabs like a
+// shell; plain `<<` removes the indentation shared by every non-blank line,
+// since scripts embedded in Go source are usually indented.
+func heredocBody(lines []string, stripTabs bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	if stripTabs {
+		out := make([]string, len(lines))
+		for i, line := range lines {
+			out[i] = strings.TrimLeft(line, "\t")
+		}
+		return strings.Join(out, "\n") + "\n"
+	}
+
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix = indent
+			first = false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
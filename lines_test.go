@@ -0,0 +1,143 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var heredocTestInput string
+
+var _ = Cmd("goshHeredocTestRaw", func(input string) {
+	heredocTestInput = input
+})
+
+var _ = Tool("goshHeredocTestWrite", func(s *Script, name string, content string) error {
+	return os.WriteFile(filepath.Join(s.getwd(), name), []byte(content), 0o644)
+}, Param("name"), Param("content"))
+
+func TestParseScriptLinesJoinsContinuationsAndQuotes(t *testing.T) {
+	lines := parseScriptLines(strings.Split(`
+		# comment
+		docker run \
+			--rm \
+			alpine
+		echo one \
+			two
+		printf "%s" "first
+		second"
+		echo It's fine
+		echo after`, "\n"))
+
+	if len(lines) != 5 {
+		t.Fatalf("lines = %#v", lines)
+	}
+	if lines[0].text != "docker run --rm alpine" || lines[0].num != 2 {
+		t.Fatalf("continuation line = %+v", lines[0])
+	}
+	if lines[1].text != "echo one two" {
+		t.Fatalf("legacy continuation = %q", lines[1].text)
+	}
+	if lines[2].text != "printf \"%s\" \"first\n\t\tsecond\"" {
+		t.Fatalf("quoted line = %q", lines[2].text)
+	}
+	if lines[3].text != "echo It's fine" || lines[4].text != "echo after" {
+		t.Fatalf("legacy quote should not span lines: %q, %q", lines[3].text, lines[4].text)
+	}
+}
+
+func TestParseScriptLinesReadsHeredocs(t *testing.T) {
+	lines := parseScriptLines(strings.Split(`
+		cat <<EOF
+			indented
+		  body ${name}
+		EOF
+		cat <<-'END'
+			tabs
+		END
+		echo done`, "\n"))
+
+	if len(lines) != 3 {
+		t.Fatalf("lines = %#v", lines)
+	}
+	if lines[0].text != "cat" || lines[0].heredoc == nil || *lines[0].heredoc != "\tindented\n  body ${name}\n" || lines[0].literal {
+		t.Fatalf("heredoc line = %+v body=%q", lines[0], *lines[0].heredoc)
+	}
+	if lines[1].heredoc == nil || *lines[1].heredoc != "tabs\n" || !lines[1].literal {
+		t.Fatalf("quoted heredoc = %+v", lines[1])
+	}
+	if lines[2].text != "echo done" {
+		t.Fatalf("after heredoc = %+v", lines[2])
+	}
+
+	quoted := parseScriptLines([]string{`echo "a << b"`, `echo a \<<EOF`, `printf "%s" 'x <<EOF'`, "echo after"})
+	if len(quoted) != 4 || quoted[0].heredoc != nil || quoted[1].heredoc != nil || quoted[2].heredoc != nil || quoted[3].text != "echo after" {
+		t.Fatalf("quoted or escaped << started a heredoc: %+v", quoted)
+	}
+
+	unterminated := parseScriptLines([]string{"cat <<EOF", "never closed"})
+	if len(unterminated) != 1 || unterminated[0].err == nil {
+		t.Fatalf("expected unterminated heredoc error: %+v", unterminated)
+	}
+	unclosed := parseScriptLines([]string{`printf "%s" "never closed`})
+	if len(unclosed) != 1 || unclosed[0].err == nil {
+		t.Fatalf("expected unterminated quote error: %+v", unclosed)
+	}
+}
+
+func TestRunCmdsBindsHeredocs(t *testing.T) {
+	dir := t.TempDir()
+	var gotErrs []error
+	script := testScript(dir)
+	script.onErr = func(err error) { gotErrs = append(gotErrs, err) }
+	script.env["name"] = "gosh"
+	script.Run(`
+		cat <<EOF
+			hello ${name}
+		EOF
+		goshHeredocTestRaw <<'EOF'
+			raw ${name}
+		EOF
+		goshHeredocTestWrite out.txt <<EOF
+			written by ${name}
+		EOF
+		printf "%s|" one \
+			"two
+		three"
+	`)
+	if len(gotErrs) != 0 {
+		t.Fatalf("errors = %v", gotErrs)
+	}
+	if heredocTestInput != "raw ${name}\n" {
+		t.Fatalf("legacy heredoc input = %q", heredocTestInput)
+	}
+	written, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "written by gosh\n" {
+		t.Fatalf("structured heredoc arg = %q", written)
+	}
+}
+
+func TestExecArgsUsesHeredocAsStdin(t *testing.T) {
+	dir := t.TempDir()
+	script := testScript(dir)
+	script.env["name"] = "gosh"
+	script.Run(`
+		sh -c "cat > stdin.txt" <<EOF
+			hello ${name}
+		EOF
+	`)
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "stdin.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello gosh\n" {
+		t.Fatalf("stdin = %q", got)
+	}
+}
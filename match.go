@@ -0,0 +1,432 @@
+package gosh
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultMatchThreshold is the confidence above which a natural-language
+// input is routed to the tool it matched when Policy.MatchThreshold is zero.
+const defaultMatchThreshold = 0.8
+
+// maxMatchConfidence keeps matched routes below the confidence of commands
+// that were typed exactly.
+const maxMatchConfidence = 0.95
+
+// matchStopwords are query words that say nothing about which tool to run.
+var matchStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "at": true, "by": true, "for": true, "from": true,
+	"i": true, "in": true, "into": true, "it": true, "me": true, "my": true, "of": true,
+	"on": true, "please": true, "the": true, "then": true, "this": true, "to": true,
+	"using": true, "with": true,
+}
+
+// toolDocument is the bag of terms a tool is matched by: words from its name,
+// which count twice, its description, and its parameters' names,
+// descriptions and enum values.
+type toolDocument struct {
+	call  Call
+	terms map[string]int
+	names map[string]bool // terms from the tool name
+	size  int
+}
+
+// toolMatch is one tool scored against a query.
+type toolMatch struct {
+	doc        toolDocument
+	score      float64
+	terms      []string
+	args       []string
+	filled     bool
+	confidence float64
+}
+
+// matchWord is one word of a query, with its position for argument
+// extraction.
+type matchWord struct {
+	text  string   // as typed, without surrounding punctuation
+	terms []string // from matchTerms; none for stopwords
+	used  bool
+}
+
+// matchTools scores exported tools against a natural-language input with
+// BM25 over their names, descriptions and parameters, fills parameters from
+// enum values, numbers and `name value` pairs in the input, and returns each
+// candidate classified under policy, best first. Candidates whose required
+// parameters could not be filled are returned rejected, with their
+// validation errors.
+func matchTools(input string, policy Policy) []RouteResult {
+	docs := toolDocuments()
+	words := matchWords(input)
+	var queryTerms []string
+	for _, word := range words {
+		queryTerms = append(queryTerms, word.terms...)
+	}
+	if len(docs) == 0 || len(queryTerms) == 0 {
+		return nil
+	}
+
+	var matches []toolMatch
+	for _, doc := range docs {
+		match := scoreTool(doc, docs, queryTerms)
+		if match.score <= 0 {
+			continue
+		}
+		match.args, match.filled = extractToolArgs(doc.call, append([]matchWord(nil), words...))
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	for i := range matches {
+		matches[i].confidence = matchConfidence(matches, i, queryTerms)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].confidence > matches[j].confidence
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	results := make([]RouteResult, 0, len(matches))
+	for _, match := range matches {
+		name := match.doc.call.Name
+		result := classifyCommand(commandLine(name, match.args), name, match.args, policy)
+		result.Input = input
+		result.Confidence = math.Round(match.confidence*100) / 100
+		result.MatchedTerms = match.terms
+		if result.Kind == RouteGoshCommand {
+			result.Reason = "matched tool by keywords: " + strings.Join(match.terms, ", ")
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// withToolMatches offers tools matching input when it did not route to a
+// command: it returns the best match if its confidence reaches the policy's
+// threshold, and otherwise the result with the matches as Candidates. A
+// registered command given invalid arguments is only replaced by a match for
+// that same command.
+func withToolMatches(input string, result RouteResult, policy Policy) RouteResult {
+	candidates := matchTools(input, policy)
+	if len(candidates) == 0 {
+		return result
+	}
+	best := candidates[0]
+	sameCommand := result.Kind == RouteNeedsAI || strings.EqualFold(best.Command, result.Command)
+	if best.Kind == RouteGoshCommand && sameCommand && best.Confidence >= policy.matchThreshold() {
+		return best
+	}
+	result.Candidates = candidates
+	return result
+}
+
+// describeCandidates lists matched tools for error messages.
+func describeCandidates(candidates []RouteResult) string {
+	lines := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		candidate = candidate.masked(nil)
+		lines[i] = fmt.Sprintf("%s (%.2f)", commandLine(candidate.Command, candidate.Args), candidate.Confidence)
+	}
+	return "closest tools: " + strings.Join(lines, ", ")
+}
+
+func (p Policy) matchThreshold() float64 {
+	if p.MatchThreshold == 0 {
+		return defaultMatchThreshold
+	}
+	return p.MatchThreshold
+}
+
+func toolDocuments() []toolDocument {
+	var docs []toolDocument
+	for _, info := range Tools() {
+		call, ok := Calls[strings.ToLower(info.Name)]
+		if !ok {
+			continue
+		}
+		doc := toolDocument{call: call, terms: map[string]int{}, names: map[string]bool{}}
+		add := func(text string, weight int) {
+			for _, term := range matchTerms(text) {
+				doc.terms[term] += weight
+				doc.size += weight
+			}
+		}
+		add(info.Name, 2)
+		for _, term := range matchTerms(info.Name) {
+			doc.names[term] = true
+		}
+		add(info.Description, 1)
+		for _, param := range info.Params {
+			add(param.Name, 1)
+			add(param.Description, 1)
+			for _, value := range param.Enum {
+				add(value, 1)
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// scoreTool computes the BM25 score of a tool for the query terms.
+func scoreTool(doc toolDocument, docs []toolDocument, queryTerms []string) toolMatch {
+	const k1, b = 1.2, 0.75
+	average := 0.0
+	for _, other := range docs {
+		average += float64(other.size)
+	}
+	average /= float64(len(docs))
+
+	match := toolMatch{doc: doc}
+	seen := map[string]bool{}
+	for _, term := range queryTerms {
+		freq := float64(doc.terms[term])
+		if freq == 0 || seen[term] {
+			continue
+		}
+		seen[term] = true
+		containing := 0
+		for _, other := range docs {
+			if other.terms[term] > 0 {
+				containing++
+			}
+		}
+		idf := math.Log(1 + (float64(len(docs)-containing)+0.5)/(float64(containing)+0.5))
+		match.score += idf * freq * (k1 + 1) / (freq + k1*(1-b+b*float64(doc.size)/average))
+		match.terms = append(match.terms, term)
+	}
+	return match
+}
+
+// matchConfidence turns a match into a confidence between 0 and
+// maxMatchConfidence: the share of query words the tool explains, halved
+// when required parameters are missing, lowered when the tool's name is not
+// mentioned, and lowered when the next tool scores almost as well.
+func matchConfidence(matches []toolMatch, i int, queryTerms []string) float64 {
+	match := matches[i]
+	explained := 0
+	for _, term := range queryTerms {
+		if match.doc.terms[term] > 0 || usedTerm(match, term) {
+			explained++
+		}
+	}
+	confidence := float64(explained) / float64(len(queryTerms))
+	if !match.filled {
+		confidence *= 0.5
+	}
+	named := false
+	for _, term := range match.terms {
+		named = named || match.doc.names[term]
+	}
+	if !named {
+		confidence *= 0.8
+	}
+	for j, other := range matches {
+		if j != i && other.score >= match.score*0.9 {
+			confidence *= 0.75
+			break
+		}
+	}
+	return math.Min(confidence, maxMatchConfidence)
+}
+
+// usedTerm reports whether a query term was taken as an argument value.
+func usedTerm(match toolMatch, term string) bool {
+	for _, arg := range match.args {
+		for _, argTerm := range matchTerms(arg) {
+			if argTerm == term {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractToolArgs fills a structured tool's parameters, in order, from the
+// query words: enum values, numbers next to the parameter's name or else the
+// first unused number, `name value` pairs, and `true` for a boolean whose name
+// appears. It stops at the first parameter it cannot fill and reports whether
+// every required parameter was filled.
+func extractToolArgs(call Call, words []matchWord) ([]string, bool) {
+	if !call.Tool.Structured {
+		return nil, true
+	}
+	var args []string
+	for _, param := range call.Tool.Params {
+		value, ok := extractParam(param, words)
+		if !ok {
+			return args, !param.Required && !laterRequired(call.Tool.Params, param)
+		}
+		args = append(args, value)
+	}
+	return args, true
+}
+
+func laterRequired(params []ParamSpec, from ParamSpec) bool {
+	after := false
+	for _, param := range params {
+		if after && param.Required {
+			return true
+		}
+		after = after || param.Name == from.Name
+	}
+	return false
+}
+
+func extractParam(param ParamSpec, words []matchWord) (string, bool) {
+	nameTerms := map[string]bool{}
+	for _, term := range matchTerms(param.Name) {
+		nameTerms[term] = true
+	}
+	isName := func(i int) bool {
+		if i < 0 || i >= len(words) {
+			return false
+		}
+		for _, term := range words[i].terms {
+			if nameTerms[term] {
+				return true
+			}
+		}
+		return false
+	}
+	take := func(i int) (string, bool) {
+		words[i].used = true
+		return words[i].text, true
+	}
+
+	if len(param.Enum) > 0 {
+		for i, word := range words {
+			for _, value := range param.Enum {
+				if !word.used && strings.EqualFold(word.text, value) {
+					words[i].used = true
+					return value, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	switch param.Type {
+	case "integer", "number":
+		valid := func(i int) bool {
+			if i < 0 || i >= len(words) || words[i].used {
+				return false
+			}
+			if param.Type == "integer" {
+				_, err := strconv.ParseInt(words[i].text, 10, 64)
+				return err == nil
+			}
+			_, err := strconv.ParseFloat(words[i].text, 64)
+			return err == nil
+		}
+		for i := range words {
+			if isName(i) {
+				if valid(i - 1) {
+					return take(i - 1)
+				}
+				if valid(i + 1) {
+					return take(i + 1)
+				}
+			}
+		}
+		for i := range words {
+			if valid(i) {
+				return take(i)
+			}
+		}
+	case "boolean":
+		for i := range words {
+			if isName(i) {
+				return "true", true
+			}
+		}
+	default:
+		for i := range words {
+			if isName(i) && i+1 < len(words) && !words[i+1].used && len(words[i+1].terms) > 0 {
+				return take(i + 1)
+			}
+		}
+	}
+	return "", false
+}
+
+// matchWords splits a query into words, dropping surrounding punctuation and
+// splitting `name=value` pairs. Words containing quotes are skipped, so
+// extracted values never need escaping.
+func matchWords(input string) []matchWord {
+	var words []matchWord
+	for _, field := range strings.Fields(input) {
+		for _, part := range strings.SplitN(field, "=", 2) {
+			text := strings.TrimRight(strings.TrimLeft(part, "([{"), ".,;:!?)]}")
+			if text == "" || strings.ContainsAny(text, `'"`) {
+				continue
+			}
+			words = append(words, matchWord{text: text, terms: matchTerms(text)})
+		}
+	}
+	return words
+}
+
+// matchTerms splits text into lower-cased, lightly stemmed terms, breaking
+// camelCase names and dropping stopwords.
+func matchTerms(text string) []string {
+	var terms []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			word := strings.ToLower(string(current))
+			if !matchStopwords[word] {
+				terms = append(terms, stemTerm(word))
+			}
+			current = current[:0]
+		}
+	}
+	runes := []rune(text)
+	for i, ch := range runes {
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+			flush()
+			continue
+		}
+		if i > 0 && unicode.IsUpper(ch) && unicode.IsLower(runes[i-1]) {
+			flush()
+		}
+		current = append(current, ch)
+	}
+	flush()
+	return terms
+}
+
+// stemTerm removes common English suffixes, so `replicas`, `deploying` and
+// `deployed` match `replica` and `deploy`.
+func stemTerm(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		return word[:len(word)-3]
+	case len(word) > 4 && strings.HasSuffix(word, "ed"):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// commandLine joins a command and its arguments into a script line,
+// single-quoting arguments that would otherwise be split or expanded.
+func commandLine(command string, args []string) string {
+	parts := []string{command}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t$\\") {
+			arg = "'" + arg + "'"
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
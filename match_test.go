@@ -0,0 +1,111 @@
+package gosh
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var goshMatchTestCalls []string
+
+var _ = Tool("GoshMatchTestRollout", func(env string, replicas int) {
+	goshMatchTestCalls = append(goshMatchTestCalls, env, strings.Repeat("r", replicas))
+},
+	Desc("Roll out the service to a cluster"),
+	Param("env", Enum("canary", "production")),
+	Param("replicas", Type("integer")),
+)
+
+var _ = Tool("GoshMatchTestBackup", func(bucket string) {},
+	Desc("Back up the database to a storage bucket"),
+	Param("bucket"),
+)
+
+func TestMatchTermsAndCommandLine(t *testing.T) {
+	if got := matchTerms("GoshMatchTestRollout the Replicas, deploying"); !reflect.DeepEqual(got, []string{"gosh", "match", "test", "rollout", "replica", "deploy"}) {
+		t.Fatalf("matchTerms = %v", got)
+	}
+	if got := commandLine("Deploy", []string{"staging", "a b", "$HOME", ""}); got != `Deploy staging 'a b' '$HOME' ''` {
+		t.Fatalf("commandLine = %q", got)
+	}
+}
+
+func TestResolveMatchesNaturalLanguage(t *testing.T) {
+	result := Resolve("rollout to canary with 3 replicas")
+	if result.Kind != RouteGoshCommand || result.Command != "GoshMatchTestRollout" ||
+		!reflect.DeepEqual(result.Args, []string{"canary", "3"}) || result.Confidence < defaultMatchThreshold ||
+		result.Confidence >= 1 || result.Input != "rollout to canary with 3 replicas" ||
+		!strings.HasPrefix(result.Reason, "matched tool by keywords") {
+		t.Fatalf("rollout = %+v", result)
+	}
+
+	result = Resolve("back up the nightly database, bucket nightly-db")
+	if result.Kind != RouteGoshCommand || result.Command != "GoshMatchTestBackup" || !reflect.DeepEqual(result.Args, []string{"nightly-db"}) {
+		t.Fatalf("backup = %+v", result)
+	}
+
+	result = Resolve("rollout to canary")
+	if result.Kind != RouteNeedsAI || len(result.Candidates) == 0 {
+		t.Fatalf("missing replicas = %+v", result)
+	}
+	candidate := result.Candidates[0]
+	if candidate.Command != "GoshMatchTestRollout" || candidate.Kind != RouteRejected ||
+		len(candidate.ValidationErrors) == 0 || candidate.Confidence >= defaultMatchThreshold {
+		t.Fatalf("missing replicas candidate = %+v", candidate)
+	}
+
+	if result := Resolve("qqqq zzzz"); len(result.Candidates) != 0 || result.Kind != RouteNeedsAI {
+		t.Fatalf("unrelated input = %+v", result)
+	}
+}
+
+func TestResolveMatchesInvalidArgumentsToSameTool(t *testing.T) {
+	result := Resolve("GoshMatchTestRollout canary 2 replicas")
+	if result.Kind != RouteGoshCommand || !reflect.DeepEqual(result.Args, []string{"canary", "2"}) {
+		t.Fatalf("invalid args rematched = %+v", result)
+	}
+}
+
+func TestMatchThresholdAndPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MatchThreshold = 2
+	result := ResolveWithPolicy("rollout to canary with 3 replicas", policy)
+	if result.Kind != RouteNeedsAI || len(result.Candidates) == 0 || result.Candidates[0].Kind != RouteGoshCommand {
+		t.Fatalf("threshold above 1 = %+v", result)
+	}
+
+	policy = DefaultPolicy()
+	policy.Rules = []PolicyRule{DenyRule("GoshMatchTestRollout", "**")}
+	result = ResolveWithPolicy("rollout to canary with 3 replicas", policy)
+	if result.Kind != RouteNeedsAI || len(result.Candidates) == 0 || result.Candidates[0].Kind != RouteRejected {
+		t.Fatalf("denied match = %+v", result)
+	}
+
+	policy.MatchThreshold = -1
+	if err := policy.validate(); err == nil {
+		t.Fatal("negative match threshold accepted")
+	}
+}
+
+func TestRouteRunsMatchedTool(t *testing.T) {
+	goshMatchTestCalls = nil
+	backend := &recordingBackend{}
+	err := RouteWithOptions(context.Background(), "rollout to canary with 3 replicas", RouteOptions{Policy: DefaultPolicy(), Backend: backend})
+	if err != nil || backend.called || !reflect.DeepEqual(goshMatchTestCalls, []string{"canary", "rrr"}) {
+		t.Fatalf("err=%v backend called=%v calls=%v", err, backend.called, goshMatchTestCalls)
+	}
+
+	// run_command runs the tool call it reports, not the original text.
+	goshMatchTestCalls = nil
+	policy := DefaultPolicy()
+	output, isError := runCommandCall(t, "rollout to canary with 2 replicas", MCPOptions{RunCommand: true, RunCommandPolicy: &policy})
+	if isError || output.Route.Command != "GoshMatchTestRollout" || !reflect.DeepEqual(goshMatchTestCalls, []string{"canary", "rr"}) {
+		t.Fatalf("run_command = %+v, isError %v, calls %v", output, isError, goshMatchTestCalls)
+	}
+
+	err = RouteWithOptions(context.Background(), "rollout to canary", RouteOptions{Policy: DefaultPolicy(), Backend: failingBackend{err: context.Canceled}})
+	if err == nil || !strings.Contains(err.Error(), "closest tools: GoshMatchTestRollout canary") {
+		t.Fatalf("unmatched route error = %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const mcpProtocolVersion = "2025-06-18"
@@ -51,6 +52,35 @@ type MCPOptions struct {
 
 	// AllowHighRisk permits tools marked RiskHigh to run through MCP.
 	AllowHighRisk bool
+
+	// Policy, when set, classifies each tool call like a script line and
+	// governs the lines the tool runs.
+	Policy *Policy
+
+	// Approver, when set, is also asked before tools that require approval
+	// or have high risk run, once AllowApprovalRequired and AllowHighRisk
+	// permit them; it never lifts those gates. It is asked about the lines
+	// those tools run as well. Over stdio the client owns stdin, so a
+	// TTYApprover needs the terminal opened separately.
+	Approver Approver
+
+	// RunCommand adds a run_command tool that runs one command line, a
+	// registered gosh command or an executable, if RunCommandPolicy allows
+	// it, and returns its stdout, stderr and exit code. Rejected lines return
+	// their RouteResult instead. RunCommandPolicy defaults to SafePolicy.
+	RunCommand       bool
+	RunCommandPolicy *Policy
+
+	// Journal, when set, records each tool call that runs as an MCP run.
+	Journal *Journal
+
+	// Audit, when set, receives an MCPAuditEvent for every tool call,
+	// including the ones rejected before they run. See AuditLog.
+	Audit MCPAuditor
+
+	client  MCPClientInfo // from the initialize request
+	logs    io.Writer
+	secrets *secretSet // secret values seen in this session
 }
 
 // ServeMCP serves exported Gosh tools over the MCP stdio transport.
@@ -63,6 +93,8 @@ func ServeMCPWithOptions(in io.Reader, out io.Writer, logs io.Writer, options MC
 	if logs == nil {
 		logs = os.Stderr
 	}
+	options.logs = logs
+	options.secrets = &secretSet{}
 
 	reader := bufio.NewReader(in)
 
@@ -93,6 +125,9 @@ func ServeMCPWithOptions(in io.Reader, out io.Writer, logs io.Writer, options MC
 			continue
 		}
 
+		if req.Method == "initialize" {
+			options.client = mcpClientInfo(req.Params)
+		}
 		result, rpcErr := handleMCPRequest(req, options)
 		if rpcErr != nil {
 			if err := writeMCPError(out, req.ID, rpcErr.Code, rpcErr.Message, rpcErr.Data); err != nil {
@@ -113,6 +148,24 @@ func (r mcpRequest) IDOrNull() json.RawMessage {
 	return r.ID
 }
 
+// mcpClientInfo reads the client's name, version and protocol version from
+// initialize parameters.
+func mcpClientInfo(params json.RawMessage) MCPClientInfo {
+	var initialize struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ClientInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"clientInfo"`
+	}
+	_ = json.Unmarshal(params, &initialize)
+	return MCPClientInfo{
+		Name:            initialize.ClientInfo.Name,
+		Version:         initialize.ClientInfo.Version,
+		ProtocolVersion: initialize.ProtocolVersion,
+	}
+}
+
 func handleMCPNotification(req mcpRequest, logs io.Writer) {
 	if req.Method != "notifications/initialized" {
 		writef(logs, "gosh mcp ignored notification %s\n", req.Method)
@@ -139,7 +192,11 @@ func handleMCPRequest(req mcpRequest, options MCPOptions) (interface{}, *mcpErro
 	case "ping":
 		return map[string]interface{}{}, nil
 	case "tools/list":
-		return map[string]interface{}{"tools": mcpTools()}, nil
+		tools := mcpTools()
+		if options.RunCommand {
+			tools = append(tools, runCommandTool())
+		}
+		return map[string]interface{}{"tools": tools}, nil
 	case "tools/call":
 		var params struct {
 			Name      string                 `json:"name"`
@@ -150,6 +207,9 @@ func handleMCPRequest(req mcpRequest, options MCPOptions) (interface{}, *mcpErro
 		if err := decoder.Decode(&params); err != nil {
 			return nil, &mcpError{Code: -32602, Message: "Invalid params", Data: err.Error()}
 		}
+		if options.RunCommand && params.Name == runCommandToolName {
+			return callRunCommand(params.Arguments, options)
+		}
 		return callMCPToolWithOptions(params.Name, params.Arguments, options)
 	default:
 		return nil, &mcpError{Code: -32601, Message: "Method not found", Data: req.Method}
@@ -187,6 +247,18 @@ func callMCPTool(name string, arguments map[string]interface{}) (interface{}, *m
 }
 
 func callMCPToolWithOptions(name string, arguments map[string]interface{}, options MCPOptions) (interface{}, *mcpError) {
+	if options.secrets == nil {
+		options.secrets = &secretSet{}
+	}
+	event := newMCPAuditEvent(name, arguments, options)
+	result, rpcErr := callMCPToolChecked(name, arguments, options, &event)
+	options.audit(&event, result, rpcErr)
+	return result, rpcErr
+}
+
+// callMCPToolChecked validates, checks and runs one tool call, noting
+// approvals in event.
+func callMCPToolChecked(name string, arguments map[string]interface{}, options MCPOptions, event *MCPAuditEvent) (interface{}, *mcpError) {
 	call, ok := Calls[strings.ToLower(name)]
 	if !ok || !call.Exported {
 		return nil, &mcpError{Code: -32602, Message: "Unknown tool", Data: name}
@@ -197,7 +269,7 @@ func callMCPToolWithOptions(name string, arguments map[string]interface{}, optio
 
 	rawArgs, argv, err := mcpArgs(call.Tool, arguments)
 	if err != nil {
-		return nil, &mcpError{Code: -32602, Message: "Invalid arguments", Data: err.Error()}
+		return nil, &mcpError{Code: -32602, Message: "Invalid arguments", Data: options.secrets.mask(err.Error())}
 	}
 	if validation := validateMCPCallArgs(call, arguments); !validation.Valid {
 		return nil, &mcpError{Code: -32602, Message: "Invalid arguments", Data: validation.Errors}
@@ -208,12 +280,43 @@ func callMCPToolWithOptions(name string, arguments map[string]interface{}, optio
 	if call.Tool.Risk == RiskHigh && !options.AllowHighRisk {
 		return nil, &mcpError{Code: -32000, Message: "High-risk tool disabled", Data: name}
 	}
+	policyArgv := argv
+	if !call.Tool.Structured {
+		policyArgv = legacyArgv(call.Name, rawArgs)[1:]
+	}
+	input := strings.TrimSpace(call.Name + " " + strings.Join(policyArgv, " "))
+	var result RouteResult
+	if options.Policy != nil || options.Approver != nil || options.Journal != nil {
+		policy := DefaultPolicy()
+		if options.Policy != nil {
+			policy = *options.Policy
+		}
+		result = classifyCommand(input, call.Name, policyArgv, policy)
+	}
+	if options.Policy != nil || options.Approver != nil {
+		if result.Kind == RouteRejected {
+			return nil, &mcpError{Code: -32000, Message: "Rejected by policy", Data: result.masked(options.secrets).Reason}
+		}
+		if needsApproval(result) {
+			if err := approve(options.context(), options.Approver, result); err != nil {
+				return nil, &mcpError{Code: -32000, Message: "Tool not approved", Data: maskRoute(result, options.secrets)(err.Error())}
+			}
+			if options.Approver != nil {
+				event.Decision, event.Reason = AuditApproved, "approved by the approver"
+			}
+		}
+	}
 
+	entry := JournalEntry{Input: commandLine(call.Name, policyArgv), Route: result, Caller: CallerMCP, Started: time.Now()}
+	entry.Dir, _ = os.Getwd()
 	output, callErr := captureStdout(func() error {
 		script, err := newScriptContext()
 		if err != nil {
 			return err
 		}
+		script.options.Policy = options.Policy
+		script.options.Approver = options.Approver
+		script.ctx, script.secrets = withSecrets(options.context())
 		if call.Tool.Structured {
 			if err := invokeStructuredCall(script, call, argv); err != nil {
 				return err
@@ -225,11 +328,14 @@ func callMCPToolWithOptions(name string, arguments map[string]interface{}, optio
 		}
 		return script.firstErr
 	})
+	digestOutput(&entry, output)
+	options.Journal.finish(&entry, callErr, options.secrets)
+	output = options.secrets.mask(output)
 	if callErr != nil {
 		return map[string]interface{}{
 			"content": []map[string]string{{
 				"type": "text",
-				"text": callErr.Error(),
+				"text": options.secrets.mask(callErr.Error()),
 			}},
 			"isError": true,
 		}, nil
@@ -398,6 +504,16 @@ func looksLikeMCPJSON(line string) bool {
 	return strings.HasPrefix(line, "{") || strings.HasPrefix(line, "[")
 }
 
+// context returns a context carrying the session's secret set, so the
+// scripts a call starts share it.
+func (o MCPOptions) context() context.Context {
+	ctx := context.Background()
+	if o.secrets != nil {
+		ctx = context.WithValue(ctx, secretsKey{}, o.secrets)
+	}
+	return ctx
+}
+
 func newScriptContext() (*Script, error) {
 	workingDir, err := os.Getwd()
 	if err != nil {
@@ -416,16 +532,22 @@ func newScriptContext() (*Script, error) {
 }
 
 func captureStdout(fn func() error) (string, error) {
+	var buffer bytes.Buffer
+	err := redirectStdout(&buffer, fn)
+	return buffer.String(), err
+}
+
+// redirectStdout calls fn with os.Stdout writing to w.
+func redirectStdout(w io.Writer, fn func() error) error {
 	oldStdout := os.Stdout
 	reader, writer, err := os.Pipe()
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	var buffer bytes.Buffer
 	done := make(chan error, 1)
 	go func() {
-		_, copyErr := io.Copy(&buffer, reader)
+		_, copyErr := io.Copy(w, reader)
 		done <- copyErr
 	}()
 
@@ -448,5 +570,5 @@ func captureStdout(fn func() error) (string, error) {
 	if panicValue != nil {
 		panic(panicValue)
 	}
-	return buffer.String(), callErr
+	return callErr
 }
@@ -0,0 +1,169 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommandToolName is the MCP name of the built-in tool MCPOptions.RunCommand
+// adds.
+const runCommandToolName = "run_command"
+
+// runCommandOutput is the structured result of a run_command call.
+type runCommandOutput struct {
+	Route    RouteResult `json:"route"`
+	ExitCode int         `json:"exit_code"`
+	Stdout   string      `json:"stdout"`
+	Stderr   string      `json:"stderr"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func runCommandTool() mcpTool {
+	return mcpTool{
+		Name: runCommandToolName,
+		Description: "Run one command line, a registered gosh command or an executable, if the server's policy allows it. " +
+			"Returns stdout, stderr and the exit code, or the route explaining why the line was rejected.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"command": map[string]interface{}{
+					"type":        "string",
+					"description": "A single command line, such as `git status` or `ls -la`.",
+				},
+			},
+			"required":             []string{"command"},
+			"additionalProperties": false,
+		},
+		Annotations: map[string]interface{}{
+			"readOnlyHint":    false,
+			"destructiveHint": false,
+			"openWorldHint":   true,
+		},
+	}
+}
+
+// callRunCommand classifies a run_command line with the run command policy,
+// runs it when allowed and returns its output.
+func callRunCommand(arguments map[string]interface{}, options MCPOptions) (interface{}, *mcpError) {
+	if options.secrets == nil {
+		options.secrets = &secretSet{}
+	}
+	event := newMCPAuditEvent(runCommandToolName, arguments, options)
+	result, rpcErr := runCommandChecked(arguments, options, &event)
+	if response, ok := result.(map[string]interface{}); ok {
+		if output, ok := response["structuredContent"].(runCommandOutput); ok {
+			// The routed input has the command's secret arguments masked,
+			// even when it was rejected before it ran.
+			if event.Arguments != nil {
+				event.Arguments["command"] = output.Route.Input
+			}
+			event.Risk = output.Route.Risk
+			if output.ExitCode == -1 {
+				event.Decision, event.Reason = AuditRejected, output.Error
+			}
+		}
+	}
+	options.audit(&event, result, rpcErr)
+	return result, rpcErr
+}
+
+// runCommandChecked classifies, checks and runs one run_command line,
+// noting approvals in event.
+func runCommandChecked(arguments map[string]interface{}, options MCPOptions, event *MCPAuditEvent) (interface{}, *mcpError) {
+	command, ok := arguments["command"].(string)
+	if !ok || len(arguments) != 1 {
+		return nil, &mcpError{Code: -32602, Message: "Invalid arguments", Data: "run_command takes one string argument, command"}
+	}
+	policy := SafePolicy()
+	if options.RunCommandPolicy != nil {
+		policy = *options.RunCommandPolicy
+	}
+
+	result := ResolveWithPolicy(command, policy)
+	if result.Kind != RouteGoshCommand && result.Kind != RouteExternalCLI {
+		if result.Kind == RouteNeedsAI {
+			result.Reason = "command is not allowed by policy"
+		}
+		return runCommandResult(runCommandOutput{Route: result, ExitCode: -1, Error: result.Reason}, true, options.secrets), nil
+	}
+	if err := options.runCommandGate(result); err != nil {
+		return runCommandResult(runCommandOutput{Route: result, ExitCode: -1, Error: err.Error()}, true, options.secrets), nil
+	}
+
+	// The line is classified again once the script has expanded it, since
+	// `git ${A:-commit}` only becomes a high-risk command then. The gates
+	// and the Approver are applied to every expanded line through the
+	// script's approver.
+	approved := false
+	approver := ApproverFunc(func(ctx context.Context, line RouteResult) error {
+		if err := options.runCommandGate(line); err != nil {
+			return err
+		}
+		if options.Approver == nil {
+			return nil
+		}
+		if err := options.Approver.Approve(ctx, line); err != nil {
+			return err
+		}
+		approved = true
+		return nil
+	})
+
+	entry := JournalEntry{Input: result.Input, Route: result, Caller: CallerMCP, Started: time.Now()}
+	entry.Dir, _ = os.Getwd()
+	var stderr bytes.Buffer
+	stdout, runErr := captureStdout(func() error {
+		script := newScript(options.context(), ScriptOptions{Policy: &policy, Approver: approver})
+		script.stderr = &stderr
+		script.Run(routedInput(command, result))
+		return script.firstErr
+	})
+	if approved {
+		event.Decision, event.Reason = AuditApproved, "approved by the approver"
+	}
+	digestOutput(&entry, stdout)
+	options.Journal.finish(&entry, runErr, options.secrets)
+	output := runCommandOutput{Route: result, ExitCode: exitCode(runErr), Stdout: stdout, Stderr: stderr.String()}
+	var refused *ApprovalError
+	switch {
+	case errors.As(runErr, &refused):
+		output.ExitCode, output.Error = -1, refused.Err.Error()
+	case runErr != nil:
+		output.Error = runErr.Error()
+	}
+	return runCommandResult(output, output.ExitCode != 0, options.secrets), nil
+}
+
+// runCommandGate refuses a run_command line that requires approval or is
+// high risk, unless the options allow it.
+func (o MCPOptions) runCommandGate(result RouteResult) error {
+	if result.RequiresApproval && !o.AllowApprovalRequired {
+		return errors.New("command requires approval")
+	}
+	if result.Risk == RiskHigh && !o.AllowHighRisk {
+		return errors.New("high-risk command disabled")
+	}
+	return nil
+}
+
+func runCommandResult(output runCommandOutput, isError bool, secrets *secretSet) map[string]interface{} {
+	mask := maskRoute(output.Route, secrets)
+	output.Route = output.Route.masked(secrets)
+	output.Stdout = mask(output.Stdout)
+	output.Stderr = mask(output.Stderr)
+	output.Error = mask(output.Error)
+	var text bytes.Buffer
+	_ = writeJSON(&text, output)
+	return map[string]interface{}{
+		"content": []map[string]string{{
+			"type": "text",
+			"text": strings.TrimSpace(text.String()),
+		}},
+		"structuredContent": output,
+		"isError":           isError,
+	}
+}
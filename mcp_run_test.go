@@ -0,0 +1,131 @@
+package gosh
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCommandCall(t *testing.T, command string, options MCPOptions) (runCommandOutput, bool) {
+	t.Helper()
+	params, err := json.Marshal(map[string]interface{}{
+		"name":      runCommandToolName,
+		"arguments": map[string]interface{}{"command": command},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, mcpErr := handleMCPRequest(mcpRequest{Method: "tools/call", Params: params}, options)
+	if mcpErr != nil {
+		t.Fatalf("run_command %q error = %+v", command, mcpErr)
+	}
+	response := result.(map[string]interface{})
+	return response["structuredContent"].(runCommandOutput), response["isError"].(bool)
+}
+
+func TestRunCommandToolIsOptIn(t *testing.T) {
+	listed := func(options MCPOptions) bool {
+		result, _ := handleMCPRequest(mcpRequest{Method: "tools/list"}, options)
+		for _, tool := range result.(map[string]interface{})["tools"].([]mcpTool) {
+			if tool.Name == runCommandToolName {
+				return true
+			}
+		}
+		return false
+	}
+	if listed(MCPOptions{}) {
+		t.Fatal("run_command listed without RunCommand")
+	}
+	if !listed(MCPOptions{RunCommand: true}) {
+		t.Fatal("run_command not listed with RunCommand")
+	}
+
+	params := json.RawMessage(`{"name":"run_command","arguments":{"command":"pwd"}}`)
+	if _, mcpErr := handleMCPRequest(mcpRequest{Method: "tools/call", Params: params}, MCPOptions{}); mcpErr == nil || mcpErr.Message != "Unknown tool" {
+		t.Fatalf("run_command without RunCommand error = %+v", mcpErr)
+	}
+	params = json.RawMessage(`{"name":"run_command","arguments":{"command":"pwd","cwd":"/"}}`)
+	if _, mcpErr := handleMCPRequest(mcpRequest{Method: "tools/call", Params: params}, MCPOptions{RunCommand: true}); mcpErr == nil || mcpErr.Message != "Invalid arguments" {
+		t.Fatalf("run_command extra argument error = %+v", mcpErr)
+	}
+}
+
+func TestRunCommandRunsAllowedCommands(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	output, isError := runCommandCall(t, "pwd", MCPOptions{RunCommand: true})
+	if isError || output.ExitCode != 0 || strings.TrimSpace(output.Stdout) != dir || output.Route.Kind != RouteExternalCLI {
+		t.Fatalf("pwd = %+v, isError %v", output, isError)
+	}
+
+	output, isError = runCommandCall(t, "ls "+dir+"/missing", MCPOptions{RunCommand: true})
+	if !isError || output.ExitCode != 2 || !strings.Contains(output.Stderr, "missing") || output.Error == "" {
+		t.Fatalf("ls missing = %+v, isError %v", output, isError)
+	}
+
+	output, isError = runCommandCall(t, "echo hello", MCPOptions{RunCommand: true})
+	if isError || strings.TrimSpace(output.Stdout) != "hello" || output.Route.Kind != RouteGoshCommand {
+		t.Fatalf("echo = %+v, isError %v", output, isError)
+	}
+}
+
+func TestRunCommandReturnsRouteWhenRejected(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	output, isError := runCommandCall(t, "touch created", MCPOptions{RunCommand: true})
+	if !isError || output.ExitCode != -1 || output.Route.Kind != RouteRejected || output.Route.Reason == "" {
+		t.Fatalf("touch = %+v, isError %v", output, isError)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "created")); !os.IsNotExist(err) {
+		t.Fatalf("rejected command ran: %v", err)
+	}
+
+	output, isError = runCommandCall(t, "touch created", MCPOptions{RunCommand: true, RunCommandPolicy: &Policy{AllowExternal: true}})
+	if isError || output.ExitCode != 0 {
+		t.Fatalf("touch with default policy = %+v, isError %v", output, isError)
+	}
+
+	policy := DefaultPolicy()
+	output, isError = runCommandCall(t, "true --force", MCPOptions{RunCommand: true, RunCommandPolicy: &policy})
+	if !isError || output.Error != "high-risk command disabled" {
+		t.Fatalf("high-risk = %+v, isError %v", output, isError)
+	}
+	approved := false
+	approver := ApproverFunc(func(ctx context.Context, result RouteResult) error {
+		approved = true
+		return nil
+	})
+	output, isError = runCommandCall(t, "true --force", MCPOptions{RunCommand: true, RunCommandPolicy: &policy, Approver: approver, AllowHighRisk: true})
+	if isError || !approved {
+		t.Fatalf("approved high-risk = %+v, isError %v, approved %v", output, isError, approved)
+	}
+}
+
+func TestRunCommandChecksExpandedLines(t *testing.T) {
+	policy := DefaultPolicy()
+
+	// The raw line is low risk; the expanded one is high risk.
+	command := "true ${GOSH_RUN_TEST_UNSET:--rf}"
+	if result := ResolveWithPolicy(command, policy); result.Risk == RiskHigh {
+		t.Fatalf("raw line risk = %s", result.Risk)
+	}
+	output, isError := runCommandCall(t, command, MCPOptions{RunCommand: true, RunCommandPolicy: &policy})
+	if !isError || output.ExitCode != -1 || output.Error != "high-risk command disabled" {
+		t.Fatalf("expanded high-risk = %+v, isError %v", output, isError)
+	}
+
+	var asked []string
+	approver := ApproverFunc(func(ctx context.Context, result RouteResult) error {
+		asked = append(asked, strings.Join(result.Args, " "))
+		return nil
+	})
+	output, isError = runCommandCall(t, command, MCPOptions{RunCommand: true, RunCommandPolicy: &policy, AllowHighRisk: true, Approver: approver})
+	if isError || len(asked) != 1 || asked[0] != "-rf" {
+		t.Fatalf("approved expanded line = %+v, isError %v, asked %q", output, isError, asked)
+	}
+}
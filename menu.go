@@ -14,8 +14,24 @@ type MenuOptions struct {
 	Policy    Policy
 	PolicySet bool
 	Backend   AIBackend
-	Stdout    io.Writer
-	Stderr    io.Writer
+
+	// Approver is asked before commands that require approval or have high
+	// risk run. It defaults to CLIApprover on stdin, except under `serve
+	// mcp`, where only an Approver set here is used.
+	Approver Approver
+
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// HistoryDir is where the sessions of inputs handed to the AI backend
+	// are recorded, and what the history and rerun meta commands read. It
+	// defaults to DefaultHistoryDir.
+	HistoryDir string
+
+	// Journal records every routed input and MCP tool call. It defaults to
+	// the journal in HistoryDir when HistoryDir is set here, or to
+	// DefaultJournal; without either, runs are not journaled.
+	Journal *Journal
 }
 
 // Menu displays usage information or invokes an exported command
@@ -24,12 +40,53 @@ func Menu() {
 }
 
 // MenuWithOptions displays usage information, resolves input, or routes it.
+//
+// A leading `--policy name-or-file` flag, or the GOSH_POLICY environment
+// variable, replaces options.Policy with a preset or a policy file (see
+// LoadPolicy) for every meta command and for routing. Without an Approver in
+// options, a leading `--yes` flag, or GOSH_ASSUME_YES, approves every
+// command without asking. `--dry-run`
+// prints the plan for the command instead of running it, as JSON with
+// `--json`.
 func MenuWithOptions(options MenuOptions) {
+	args, flags, err := ParseCLIFlags(os.Args[1:])
+	if err != nil {
+		defaultErr(err)
+		return
+	}
+	// Under `serve mcp` stdin belongs to the client, so only an Approver the
+	// caller supplied is handed to the MCP server.
+	mcpApprover := options.Approver
+	if options.Approver == nil {
+		options.Approver = CLIApprover(os.Stdin, defaultWriter(options.Stderr, os.Stderr), flags.Yes)
+	}
+	if flags.Policy != "" {
+		policy, err := LoadPolicy(flags.Policy)
+		if err != nil {
+			defaultErr(err)
+			return
+		}
+		options.Policy, options.PolicySet = policy, true
+	}
 	if !options.PolicySet && policyIsZero(options.Policy) {
 		options.Policy = DefaultPolicy()
 	}
+	if options.Journal == nil {
+		journal, err := DefaultJournal()
+		if options.HistoryDir != "" {
+			journal, err = NewJournal(options.HistoryDir)
+		}
+		if err != nil {
+			defaultErr(err)
+			return
+		}
+		options.Journal = journal
+	}
+	if options.HistoryDir == "" {
+		options.HistoryDir = DefaultHistoryDir()
+	}
 	// show usage information if no command specified
-	if len(os.Args) <= 1 {
+	if len(args) == 0 {
 		// if goSrc := determineGoFile(); goSrc != "" {
 		// 	showUsageFromSrc(goSrc)
 		//  return
@@ -38,15 +95,15 @@ func MenuWithOptions(options MenuOptions) {
 		return
 	}
 
-	if os.Args[1] == "--resolve" {
-		input := strings.Join(os.Args[2:], " ")
+	if args[0] == "--resolve" {
+		input := strings.Join(args[1:], " ")
 		result := ResolveWithPolicy(input, options.Policy)
 		if err := writeRouteJSON(defaultWriter(options.Stdout, os.Stdout), result); err != nil {
 			defaultErr(err)
 		}
 	} else {
-		if os.Args[1] == "tools" {
-			if len(os.Args) == 3 && os.Args[2] == "--json" {
+		if args[0] == "tools" {
+			if len(args) == 2 && args[1] == "--json" {
 				if err := writeJSON(defaultWriter(options.Stdout, os.Stdout), Tools()); err != nil {
 					defaultErr(err)
 				}
@@ -55,29 +112,129 @@ func MenuWithOptions(options MenuOptions) {
 			defaultErr(fmt.Errorf("invalid meta command: expected `tools --json`"))
 			return
 		}
-		if os.Args[1] == "serve" {
-			if len(os.Args) == 3 && os.Args[2] == "mcp" {
-				if err := ServeMCP(os.Stdin, defaultWriter(options.Stdout, os.Stdout), defaultWriter(options.Stderr, os.Stderr)); err != nil {
+		if args[0] == "serve" {
+			runCommand := len(args) == 3 && args[2] == "--run-command"
+			if (len(args) == 2 || runCommand) && args[1] == "mcp" {
+				mcpOptions := MCPOptions{Policy: &options.Policy, Approver: mcpApprover, RunCommand: runCommand, Journal: options.Journal}
+				if options.PolicySet {
+					mcpOptions.RunCommandPolicy = &options.Policy
+				}
+				if path := os.Getenv(MCPAuditEnv); path != "" {
+					audit, err := OpenAuditLog(path)
+					if err != nil {
+						defaultErr(err)
+						return
+					}
+					defer func() { _ = audit.Close() }()
+					mcpOptions.Audit = audit
+				}
+				if err := ServeMCPWithOptions(os.Stdin, defaultWriter(options.Stdout, os.Stdout), defaultWriter(options.Stderr, os.Stderr), mcpOptions); err != nil {
 					defaultErr(err)
 				}
 				return
 			}
-			defaultErr(fmt.Errorf("invalid meta command: expected `serve mcp`"))
+			defaultErr(fmt.Errorf("invalid meta command: expected `serve mcp [--run-command]`"))
 			return
 		}
-		err := RouteWithOptions(context.Background(), strings.Join(os.Args[1:], " "), RouteOptions{
-			Policy:    options.Policy,
-			PolicySet: true,
-			Backend:   options.Backend,
-			Stdout:    options.Stdout,
-			Stderr:    options.Stderr,
-		})
-		if err != nil {
+		if args[0] == "policy" {
+			if len(args) == 2 && args[1] == "show" {
+				if err := writeJSON(defaultWriter(options.Stdout, os.Stdout), options.Policy); err != nil {
+					defaultErr(err)
+				}
+				return
+			}
+			defaultErr(fmt.Errorf("invalid meta command: expected `policy show`"))
+			return
+		}
+		if args[0] == "history" {
+			historyArgs := args[1:]
+			if flags.JSON {
+				historyArgs = append(historyArgs, "--json")
+			}
+			if err := runHistory(defaultWriter(options.Stdout, os.Stdout), historyArgs, options.HistoryDir, options.Journal); err != nil {
+				defaultErr(err)
+			}
+			return
+		}
+		if args[0] == "rerun" {
+			if len(args) != 2 {
+				defaultErr(fmt.Errorf("invalid meta command: expected `rerun <id>`"))
+				return
+			}
+			if err := rerun(args[1], options); err != nil {
+				defaultErr(err)
+			}
+			return
+		}
+		if args[0] == "check" {
+			if err := runCheck(defaultWriter(options.Stdout, os.Stdout), args[1:], options.Policy); err != nil {
+				defaultErr(err)
+			}
+			return
+		}
+		if flags.DryRun {
+			if err := writeMenuPlan(strings.Join(args, " "), flags.JSON, options); err != nil {
+				defaultErr(err)
+			}
+			return
+		}
+		if err := RouteWithOptions(context.Background(), strings.Join(args, " "), menuRouteOptions(options)); err != nil {
 			defaultErr(err)
 		}
 	}
 }
 
+// menuRouteOptions returns the options Menu routes input with.
+func menuRouteOptions(options MenuOptions) RouteOptions {
+	return RouteOptions{
+		Policy:    options.Policy,
+		PolicySet: true,
+		Backend:   options.Backend,
+		Approver:  options.Approver,
+		Stdout:    options.Stdout,
+		Stderr:    options.Stderr,
+
+		HistoryDir: options.HistoryDir,
+		Journal:    options.Journal,
+	}
+}
+
+// rerun routes a journaled input again, in the directory it first ran in,
+// under the current policy and approver.
+func rerun(id string, options MenuOptions) error {
+	if options.Journal == nil {
+		return fmt.Errorf("rerun: the journal is off; set %s", HistoryDirEnv)
+	}
+	entry, err := options.Journal.Entry(id)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(entry.Input, secretMask) {
+		return fmt.Errorf("rerun %s: the run took secrets, which the journal does not keep", entry.ID)
+	}
+	if entry.Dir != "" {
+		if err := os.Chdir(entry.Dir); err != nil {
+			return fmt.Errorf("rerun %s: %w", entry.ID, err)
+		}
+	}
+	writef(defaultWriter(options.Stderr, os.Stderr), "gosh: rerun %s: %s\n", entry.ID, entry.Input)
+	return RouteWithOptions(context.Background(), entry.Input, menuRouteOptions(options))
+}
+
+// writeMenuPlan plans a routed command line and writes it as text or JSON.
+func writeMenuPlan(input string, asJSON bool, options MenuOptions) error {
+	steps, err := Plan(context.Background(), input, ScriptOptions{Policy: &options.Policy})
+	if err != nil {
+		return err
+	}
+	w := defaultWriter(options.Stdout, os.Stdout)
+	if asJSON {
+		return writeJSON(w, steps)
+	}
+	WritePlan(w, steps)
+	return nil
+}
+
 // showUsageFromReflection displays what functions are callable from the CLI, using reflection.
 func showUsageFromReflection(w io.Writer) {
 	foundTargets := false
@@ -89,6 +246,18 @@ func showUsageFromReflection(w io.Writer) {
 				continue
 			}
 			writef(w, "    %s ", c.Name)
+			if c.Tool.Structured {
+				for _, param := range c.Tool.Params {
+					if param.Secret {
+						writef(w, "[%s (secret)] ", param.Name)
+					} else {
+						writef(w, "[%s] ", param.Name)
+					}
+				}
+				writef(w, "\n")
+				foundTargets = true
+				continue
+			}
 			rt := c.Func.Type()
 			for p := 0; p < rt.NumIn(); p++ {
 				// todo: see if there's a hack to get parameter names and comments
@@ -105,6 +274,56 @@ func showUsageFromReflection(w io.Writer) {
 	writef(w, "    --resolve [input]    classify input as JSON without executing\n")
 	writef(w, "    tools --json         list exported Gosh tools as JSON\n")
 	writef(w, "    serve mcp            serve exported Gosh tools over MCP stdio\n")
+	writef(w, "      --run-command      also serve a run_command tool checked by the policy\n")
+	writef(w, "    policy show          print the effective policy as JSON\n")
+	writef(w, "    check [file...]      lint scripts, or every registered one; --json for JSON\n")
+	writef(w, "    history [show id]    list or show journaled runs and AI sessions; --json for JSON\n")
+	writef(w, "      --sessions         list the saved AI sessions instead of the journal\n")
+	writef(w, "    rerun id             route a journaled input again, in its directory\n")
+	writef(w, "    --policy [name|file] use a policy preset (%s) or file\n", strings.Join(PolicyPresets(), ", "))
+	writef(w, "    --yes                run commands that need approval without asking\n")
+	writef(w, "    --dry-run [--json]   show how a command would run, without running it\n")
+}
+
+// CLIFlags are the flags gosh programs accept before a command.
+type CLIFlags struct {
+	Policy string // preset name or policy file
+	Yes    bool   // approve commands without asking
+	DryRun bool   // plan instead of running
+	JSON   bool   // write JSON output
+}
+
+// ParseCLIFlags removes leading `--policy name`, `--policy=name`, `--yes`,
+// `--dry-run` and `--json` flags from args. Without the policy flag, the
+// policy comes from PolicyEnv if it is set. Menu and the gosh binary both
+// use it.
+func ParseCLIFlags(args []string) ([]string, CLIFlags, error) {
+	flags := CLIFlags{Policy: os.Getenv(PolicyEnv)}
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--yes" || args[0] == "-y":
+			flags.Yes = true
+			args = args[1:]
+		case args[0] == "--dry-run":
+			flags.DryRun = true
+			args = args[1:]
+		case args[0] == "--json":
+			flags.JSON = true
+			args = args[1:]
+		case args[0] == "--policy":
+			if len(args) < 2 {
+				return nil, flags, fmt.Errorf("--policy requires a preset name or file")
+			}
+			flags.Policy = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--policy="):
+			flags.Policy = strings.TrimPrefix(args[0], "--policy=")
+			args = args[1:]
+		default:
+			return args, flags, nil
+		}
+	}
+	return args, flags, nil
 }
 
 func writef(w io.Writer, format string, args ...interface{}) {
@@ -15,6 +15,11 @@ type ToolSpec struct {
 	Exported         bool        `json:"exported"`
 	Structured       bool        `json:"structured"`
 	Params           []ParamSpec `json:"params,omitempty"`
+
+	// DryRun reports that the tool has a hook that runs in its place during
+	// dry runs.
+	DryRun     bool `json:"dry_run,omitempty"`
+	dryRunHook reflect.Value
 }
 
 // ParamSpec describes one positional tool parameter.
@@ -24,6 +29,7 @@ type ParamSpec struct {
 	Type        string   `json:"type"`
 	Required    bool     `json:"required"`
 	Enum        []string `json:"enum,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
 }
 
 // ToolInfo is the JSON-facing representation of one registered tool.
@@ -83,6 +89,16 @@ func RequiresApproval() ToolOption {
 	}
 }
 
+// DryRun registers a hook that runs in place of the tool during dry runs,
+// so the tool can check its inputs or describe what it would do. The hook
+// must have the same signature as the tool.
+func DryRun(hook interface{}) ToolOption {
+	return func(t *ToolSpec) {
+		t.DryRun = true
+		t.dryRunHook = reflect.ValueOf(hook)
+	}
+}
+
 // Enum restricts a string parameter to a fixed set of values.
 func Enum(values ...string) ParamOption {
 	return func(p *ParamSpec) {
@@ -105,6 +121,16 @@ func Optional() ParamOption {
 	}
 }
 
+// Secret marks a parameter as holding a token, password or other secret.
+// Its values are masked in gosh's output, errors, `--resolve` JSON, MCP
+// audit events and captured MCP results, and its schema is published as
+// writeOnly.
+func Secret() ParamOption {
+	return func(p *ParamSpec) {
+		p.Secret = true
+	}
+}
+
 // Type sets a JSON Schema primitive type for a parameter.
 func Type(name string) ParamOption {
 	return func(p *ParamSpec) {
@@ -263,6 +289,9 @@ func (t ToolSpec) inputSchema() map[string]interface{} {
 		if len(param.Enum) > 0 {
 			property["enum"] = param.Enum
 		}
+		if param.Secret {
+			property["writeOnly"] = true
+		}
 		properties[param.Name] = property
 		if param.Required {
 			required = append(required, param.Name)
@@ -0,0 +1,258 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultOpenAIMaxTurns bounds the requests one OpenAIBackend.Run makes.
+const defaultOpenAIMaxTurns = 8
+
+// openAISystemPrompt is the system message OpenAIBackend.Run sends.
+const openAISystemPrompt = "You handle requests for the current repository or working directory. " +
+	"Use the provided tools to act; they are the only commands you can run."
+
+// OpenAIBackend sends non-deterministic inputs to an OpenAI-compatible chat
+// completions endpoint, such as a local llama.cpp or Ollama server. The model
+// is offered the exported gosh tools as functions; gosh validates, approves
+// and runs each tool call like an MCP call under Policy, and returns the
+// output to the model until it answers without calling a tool.
+type OpenAIBackend struct {
+	BaseURL string // up to /v1; defaults to https://api.openai.com/v1
+	APIKey  string
+	Model   string
+	Client  *http.Client
+
+	// Policy and Approver govern tool calls as in MCPOptions. Without an
+	// Approver, tools that need approval or have high risk are refused.
+	Policy   Policy
+	Approver Approver
+
+	// MaxTurns bounds the requests made for one input; zero means 8.
+	MaxTurns int
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// DefaultOpenAIBackend returns an OpenAI backend configured from the
+// environment.
+//
+// Supported environment variables:
+//   - GOSH_OPENAI_BASE_URL
+//   - GOSH_OPENAI_API_KEY, or OPENAI_API_KEY
+//   - GOSH_OPENAI_MODEL
+func DefaultOpenAIBackend() OpenAIBackend {
+	return OpenAIBackend{
+		BaseURL: envOrDefault("GOSH_OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		APIKey:  envOrDefault("GOSH_OPENAI_API_KEY", os.Getenv("OPENAI_API_KEY")),
+		Model:   envOrDefault("GOSH_OPENAI_MODEL", "gpt-4o-mini"),
+		Policy:  DefaultPolicy(),
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatFunction `json:"function"`
+}
+
+type chatFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model,omitempty"`
+	Messages []chatMessage `json:"messages"`
+	Tools    []chatTool    `json:"tools,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Run asks the model to handle input, running the tools it calls.
+func (b OpenAIBackend) Run(ctx context.Context, input string) error {
+	_, err := b.RunSession(ctx, RouteResult{Kind: RouteNeedsAI, Input: input})
+	return err
+}
+
+// RunSession asks the model to handle a routed input and records the
+// session, with each chat message as an event.
+func (b OpenAIBackend) RunSession(ctx context.Context, result RouteResult) (*AISession, error) {
+	session := newAISession("openai", result)
+	session.Prompt = openAISystemPrompt
+	session.Config = map[string]string{
+		"base_url":  b.BaseURL,
+		"model":     b.Model,
+		"max_turns": fmt.Sprint(b.MaxTurns),
+	}
+	stdout, doneStdout := session.capture(defaultWriter(b.Stdout, os.Stdout), &session.Stdout)
+	stderr, doneStderr := session.capture(defaultWriter(b.Stderr, os.Stderr), &session.Stderr)
+	err := b.run(ctx, result.Input, stdout, stderr, func(message chatMessage) {
+		if raw, err := json.Marshal(message); err == nil {
+			session.Events = append(session.Events, raw)
+		}
+	})
+	doneStdout()
+	doneStderr()
+	return session, session.finish(err)
+}
+
+// run is the tool calling loop of RunSession. record sees every message
+// sent or received.
+func (b OpenAIBackend) run(ctx context.Context, input string, stdout io.Writer, stderr io.Writer, record func(chatMessage)) error {
+	messages := []chatMessage{
+		{Role: "system", Content: openAISystemPrompt},
+		{Role: "user", Content: input},
+	}
+	record(messages[0])
+	record(messages[1])
+	var tools []chatTool
+	for _, info := range Tools() {
+		tools = append(tools, chatTool{Type: "function", Function: chatFunction{
+			Name:        info.Name,
+			Description: info.Description,
+			Parameters:  info.InputSchema,
+		}})
+	}
+
+	maxTurns := b.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = defaultOpenAIMaxTurns
+	}
+	for turn := 0; turn < maxTurns; turn++ {
+		reply, err := b.complete(ctx, chatRequest{Model: b.Model, Messages: messages, Tools: tools})
+		if err != nil {
+			return err
+		}
+		record(reply)
+		if len(reply.ToolCalls) == 0 {
+			if reply.Content != "" {
+				writef(stdout, "%s\n", strings.TrimRight(reply.Content, "\n"))
+			}
+			return nil
+		}
+		messages = append(messages, reply)
+		for _, call := range reply.ToolCalls {
+			writef(stderr, "gosh: %s %s\n", call.Function.Name, call.Function.Arguments)
+			message := chatMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    b.callTool(call),
+			}
+			record(message)
+			messages = append(messages, message)
+		}
+	}
+	return fmt.Errorf("openai backend: no answer after %d turns", maxTurns)
+}
+
+// callTool runs one tool call as an MCP call and returns its output, or
+// the reason it did not run, for the model.
+func (b OpenAIBackend) callTool(call chatToolCall) string {
+	arguments := map[string]interface{}{}
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return "error: arguments are not a JSON object: " + err.Error()
+		}
+	}
+	policy := b.Policy
+	result, mcpErr := callMCPToolWithOptions(call.Function.Name, arguments, MCPOptions{Policy: &policy, Approver: b.Approver})
+	if mcpErr != nil {
+		return fmt.Sprintf("error: %s: %v", mcpErr.Message, mcpErr.Data)
+	}
+	response := result.(map[string]interface{})
+	text := response["content"].([]map[string]string)[0]["text"]
+	if response["isError"] == true {
+		return "error: " + text
+	}
+	return text
+}
+
+// Plan asks the model for a gosh script, so the backend can serve as a
+// PlanBackend's Planner.
+func (b OpenAIBackend) Plan(ctx context.Context, input string, tools []ToolInfo) (string, error) {
+	prompt, err := plannerPrompt(input, tools)
+	if err != nil {
+		return "", err
+	}
+	reply, err := b.complete(ctx, chatRequest{Model: b.Model, Messages: []chatMessage{{Role: "user", Content: prompt}}})
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
+
+// complete makes one chat completions request and returns the first choice.
+func (b OpenAIBackend) complete(ctx context.Context, request chatRequest) (chatMessage, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return chatMessage{}, err
+	}
+	baseURL := b.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return chatMessage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return chatMessage{}, fmt.Errorf("openai backend: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var response chatResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	switch {
+	case response.Error != nil:
+		return chatMessage{}, fmt.Errorf("openai backend: %s: %s", resp.Status, response.Error.Message)
+	case resp.StatusCode != http.StatusOK:
+		return chatMessage{}, fmt.Errorf("openai backend: %s", resp.Status)
+	case decodeErr != nil:
+		return chatMessage{}, fmt.Errorf("openai backend: %w", decodeErr)
+	case len(response.Choices) == 0:
+		return chatMessage{}, fmt.Errorf("openai backend: response has no choices")
+	}
+	return response.Choices[0].Message, nil
+}
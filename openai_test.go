@@ -0,0 +1,105 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var _ = Tool("GoshOpenAITestGreet", func(name string) { fmt.Printf("hello %s\n", name) },
+	Desc("Greet someone"),
+	Param("name"),
+)
+
+var _ = Tool("GoshOpenAITestWipe", func() {}, Desc("Wipe everything"), RequiresApproval())
+
+// fakeChatServer answers chat completions requests with replies in order
+// and records the requests.
+func fakeChatServer(t *testing.T, replies ...string) (*httptest.Server, *[]chatRequest) {
+	t.Helper()
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusUnauthorized)
+			return
+		}
+		var request chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		requests = append(requests, request)
+		if len(requests) > len(replies) {
+			http.Error(w, `{"error":{"message":"too many requests"}}`, http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":%s}]}`, replies[len(requests)-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestOpenAIBackendRunsToolCalls(t *testing.T) {
+	server, requests := fakeChatServer(t,
+		`{"role":"assistant","content":null,"tool_calls":[
+			{"id":"a","type":"function","function":{"name":"GoshOpenAITestGreet","arguments":"{\"name\":\"world\"}"}},
+			{"id":"b","type":"function","function":{"name":"GoshOpenAITestWipe","arguments":"{}"}}]}`,
+		`{"role":"assistant","content":"Greeted world."}`,
+	)
+	var stdout, stderr bytes.Buffer
+	backend := OpenAIBackend{BaseURL: server.URL + "/v1/", APIKey: "test-key", Model: "local", Policy: DefaultPolicy(), Stdout: &stdout, Stderr: &stderr}
+	if err := backend.Run(context.Background(), "greet the world"); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	if stdout.String() != "Greeted world.\n" || !strings.Contains(stderr.String(), "gosh: GoshOpenAITestGreet") {
+		t.Fatalf("stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("requests = %d", len(*requests))
+	}
+	first := (*requests)[0]
+	offered := false
+	for _, tool := range first.Tools {
+		offered = offered || tool.Function.Name == "GoshOpenAITestGreet"
+	}
+	if first.Model != "local" || !offered || first.Messages[1].Content != "greet the world" {
+		t.Fatalf("first request = %+v", first)
+	}
+	messages := (*requests)[1].Messages
+	if len(messages) != 5 || messages[3].ToolCallID != "a" || messages[3].Content != "hello world\n" ||
+		messages[4].ToolCallID != "b" || !strings.HasPrefix(messages[4].Content, "error: Tool requires approval") {
+		t.Fatalf("second request messages = %+v", messages)
+	}
+}
+
+func TestOpenAIBackendErrorsAndTurns(t *testing.T) {
+	server, _ := fakeChatServer(t)
+	backend := OpenAIBackend{BaseURL: server.URL + "/v1", APIKey: "wrong"}
+	if err := backend.Run(context.Background(), "anything"); err == nil || !strings.Contains(err.Error(), "bad request") {
+		t.Fatalf("unauthorized error = %v", err)
+	}
+
+	loop := `{"role":"assistant","tool_calls":[{"id":"a","type":"function","function":{"name":"GoshOpenAITestGreet","arguments":"{\"name\":\"again\"}"}}]}`
+	server, _ = fakeChatServer(t, loop, loop)
+	backend = OpenAIBackend{BaseURL: server.URL + "/v1", APIKey: "test-key", MaxTurns: 2, Stderr: &bytes.Buffer{}}
+	if err := backend.Run(context.Background(), "loop"); err == nil || !strings.Contains(err.Error(), "after 2 turns") {
+		t.Fatalf("turn limit error = %v", err)
+	}
+}
+
+func TestOpenAIBackendPlans(t *testing.T) {
+	server, requests := fakeChatServer(t, `{"role":"assistant","content":"GoshOpenAITestGreet planner"}`)
+	backend := OpenAIBackend{BaseURL: server.URL + "/v1", APIKey: "test-key"}
+	script, err := backend.Plan(context.Background(), "greet the planner", Tools())
+	if err != nil || script != "GoshOpenAITestGreet planner" {
+		t.Fatalf("Plan = %q, %v", script, err)
+	}
+	if request := (*requests)[0]; len(request.Tools) != 0 || !strings.Contains(request.Messages[0].Content, "GoshOpenAITestGreet") {
+		t.Fatalf("plan request = %+v", request)
+	}
+}
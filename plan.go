@@ -0,0 +1,93 @@
+package gosh
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// PlanStep is one line of a dry run: where it would run and how it would be
+// routed after expansion.
+type PlanStep struct {
+	Line int    `json:"line"`
+	File string `json:"file,omitempty"`
+	Dir  string `json:"dir"`
+	RouteResult
+
+	// Executed reports that the line did run: a builtin that only changes
+	// the script's state, such as cd, pushd, set or source, or a tool's
+	// DryRun hook.
+	Executed bool `json:"executed"`
+}
+
+// plannedBuiltins run during dry runs, so later lines see their directory,
+// variables, options and sourced lines. None of them change files.
+var plannedBuiltins = map[string]bool{
+	"cd": true, "getwd": true, "popd": true, "pushd": true, "set": true, "shopt": true, "source": true,
+}
+
+// Plan walks a script like RunWithOptions with options.DryRun set, and
+// returns its steps instead of printing them.
+func Plan(ctx context.Context, cmdScript string, options ScriptOptions) ([]PlanStep, error) {
+	var steps []PlanStep
+	options.DryRun = true
+	options.OnPlan = func(step PlanStep) {
+		steps = append(steps, step)
+	}
+	err := runEContext(ctx, cmdScript, options)
+	return steps, err
+}
+
+// WritePlan writes plan steps one per line: the line number, route kind,
+// risk and expanded command, why the line would not run or needs approval,
+// and the directory it would run in.
+func WritePlan(w io.Writer, steps []PlanStep) {
+	for _, step := range steps {
+		writePlanStep(w, step)
+	}
+}
+
+func writePlanStep(w io.Writer, step PlanStep) {
+	where := step.Dir
+	if step.File != "" {
+		where = step.File
+	}
+	command := step.Input
+	if step.Command != "" {
+		command = strings.Join(append([]string{step.Command}, step.Args...), " ")
+	}
+	writef(w, "%4d  %-12s  %-6s  %s", step.Line, step.Kind, step.Risk, command)
+	switch {
+	case step.Kind == RouteRejected || step.Kind == RouteNeedsAI:
+		writef(w, "  # %s", step.Reason)
+		if len(step.ValidationErrors) > 0 {
+			writef(w, ": %s", strings.Join(step.ValidationErrors, "; "))
+		}
+	case step.RequiresApproval || step.Risk == RiskHigh:
+		writef(w, "  # needs approval")
+	}
+	writef(w, "  (%s)\n", where)
+}
+
+// planLine records a dry-run step for an expanded line, reporting whether
+// the line should still run: planned builtins and tools with a DryRun hook
+// do, with the hook in place of the tool.
+func (s *Script) planLine(lineNum int, input string, argv []string, call *Call) bool {
+	result := s.classify(input, argv)
+	step := PlanStep{Line: lineNum, File: s.file, Dir: s.dirs[0], RouteResult: result.masked(s.secrets)}
+	if call != nil && result.Kind == RouteGoshCommand {
+		if call.Tool.dryRunHook.IsValid() && s.check == nil {
+			call.Func = call.Tool.dryRunHook
+			step.Executed = true
+		} else {
+			step.Executed = plannedBuiltins[strings.ToLower(call.Name)]
+		}
+	}
+	if s.options.OnPlan != nil {
+		s.options.OnPlan(step)
+	} else {
+		writePlanStep(os.Stdout, step)
+	}
+	return step.Executed
+}
@@ -0,0 +1,143 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var planToolRuns, planHookRuns []string
+
+var _ = Tool("goshPlanTestDeploy", func(env string) {
+	planToolRuns = append(planToolRuns, env)
+},
+	Param("env", Enum("staging", "prod")),
+	DryRun(func(env string) {
+		planHookRuns = append(planHookRuns, env)
+	}),
+)
+
+var _ = Tool("goshPlanTestNoHook", func(name string) {
+	planToolRuns = append(planToolRuns, name)
+}, Param("name"))
+
+func TestPlanTracksStateWithoutRunning(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	planToolRuns, planHookRuns = nil, nil
+	script := strings.Join([]string{
+		"set target = " + dir,
+		"pushd $target",
+		"pushd sub",
+		"mkDir made",
+		"goshPlanTestNoHook $target",
+		"goshPlanTestDeploy staging",
+		"goshPlanTestDeploy qa",
+		"popd",
+		"true --force",
+	}, "\n")
+	steps, err := Plan(context.Background(), script, ScriptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 9 {
+		t.Fatalf("steps = %+v", steps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "made")); !os.IsNotExist(err) {
+		t.Fatalf("mkDir ran during dry run: %v", err)
+	}
+	if planToolRuns != nil || strings.Join(planHookRuns, ",") != "staging" {
+		t.Fatalf("tool runs = %q, hook runs = %q", planToolRuns, planHookRuns)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	checks := []struct {
+		dir      string
+		kind     RouteKind
+		executed bool
+	}{
+		{"", RouteGoshCommand, true},
+		{"", RouteGoshCommand, true},
+		{dir, RouteGoshCommand, true},
+		{sub, RouteGoshCommand, false},
+		{sub, RouteGoshCommand, false},
+		{sub, RouteGoshCommand, true},
+		{sub, RouteRejected, false},
+		{sub, RouteGoshCommand, true},
+		{dir, RouteExternalCLI, false},
+	}
+	for i, check := range checks {
+		step := steps[i]
+		if step.Line != i || step.Kind != check.kind || step.Executed != check.executed || (check.dir != "" && step.Dir != check.dir) {
+			t.Fatalf("step %d = %+v, want %+v", i, step, check)
+		}
+	}
+	if steps[4].Args[0] != dir {
+		t.Fatalf("variables not expanded: %+v", steps[4])
+	}
+	if len(steps[6].ValidationErrors) == 0 || steps[8].Risk != RiskHigh {
+		t.Fatalf("steps = %+v / %+v", steps[6], steps[8])
+	}
+}
+
+func TestPlanReportsPolicyRejections(t *testing.T) {
+	policy := ReadOnlyPolicy()
+	steps, err := Plan(context.Background(), "rm file\nls", ScriptOptions{Policy: &policy})
+	if err != nil || len(steps) != 2 {
+		t.Fatalf("steps = %+v, err = %v", steps, err)
+	}
+	if steps[0].Kind != RouteRejected || !strings.Contains(steps[0].Reason, "readonly") || steps[1].Kind != RouteExternalCLI {
+		t.Fatalf("steps = %+v", steps)
+	}
+}
+
+func TestWritePlan(t *testing.T) {
+	var out bytes.Buffer
+	WritePlan(&out, []PlanStep{
+		{Line: 0, Dir: "/src", RouteResult: RouteResult{Kind: RouteExternalCLI, Command: "rm", Args: []string{"-rf", "build"}, Risk: RiskHigh}},
+		{Line: 1, Dir: "/src", RouteResult: RouteResult{Kind: RouteNeedsAI, Input: "frob x", Reason: "no match"}},
+	})
+	want := "   0  external_cli  high    rm -rf build  # needs approval  (/src)\n" +
+		"   1  needs_ai              frob x  # no match  (/src)\n"
+	if out.String() != want {
+		t.Fatalf("plan =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestDryRunHookMustMatchSignature(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	Tool("goshPlanTestBadHook", func(name string) {}, Param("name"), DryRun(func() {}))
+}
+
+func TestMenuDryRunJSON(t *testing.T) {
+	oldArgs := os.Args
+	oldDefaultErr := defaultErr
+	defer func() {
+		os.Args = oldArgs
+		defaultErr = oldDefaultErr
+	}()
+	var gotErr error
+	defaultErr = func(err error) { gotErr = err }
+
+	planToolRuns = nil
+	var out bytes.Buffer
+	os.Args = []string{"goshfile", "--dry-run", "--json", "goshPlanTestNoHook", "x"}
+	MenuWithOptions(MenuOptions{Stdout: &out})
+	var steps []PlanStep
+	if err := json.Unmarshal(out.Bytes(), &steps); err != nil || gotErr != nil {
+		t.Fatalf("plan = %q, %v, %v", out.String(), err, gotErr)
+	}
+	if len(steps) != 1 || steps[0].Command != "goshPlanTestNoHook" || planToolRuns != nil {
+		t.Fatalf("steps = %+v, runs = %q", steps, planToolRuns)
+	}
+}
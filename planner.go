@@ -0,0 +1,278 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// AIModeEnv names the environment variable that picks how RouteWithOptions
+// hands unmatched input to the AI backend when no Backend is set: `exec`
+// (the default) lets the backend act on its own, and `plan` uses it as the
+// Planner of a PlanBackend.
+const AIModeEnv = "GOSH_AI_MODE"
+
+// ErrEmptyPlan is returned when a Planner proposes nothing to run.
+var ErrEmptyPlan = errors.New("planner returned an empty plan")
+
+// Planner proposes a gosh script for a request, using only the given tools.
+// The script may instead be a JSON list of tool calls, such as
+// `[{"tool": "Deploy", "args": {"env": "staging"}}]`.
+type Planner interface {
+	Plan(ctx context.Context, input string, tools []ToolInfo) (string, error)
+}
+
+// PlannerFunc adapts a function to the Planner interface.
+type PlannerFunc func(ctx context.Context, input string, tools []ToolInfo) (string, error)
+
+// Plan calls f.
+func (f PlannerFunc) Plan(ctx context.Context, input string, tools []ToolInfo) (string, error) {
+	return f(ctx, input, tools)
+}
+
+// PlanBackend is an AIBackend that asks a Planner for a gosh script instead
+// of letting a model run commands itself. Every line of the script is routed
+// under Policy in a dry run and must resolve to a command the policy allows;
+// the plan is then shown, approved as a whole and run by gosh.
+type PlanBackend struct {
+	Planner Planner
+
+	// Policy validates and runs the plan. The zero Policy allows only
+	// registered gosh commands.
+	Policy Policy
+
+	// Approver is asked once for the whole plan. It defaults to CLIApprover
+	// on stdin.
+	Approver Approver
+
+	// Stderr receives the plan before approval. It defaults to os.Stderr.
+	Stderr io.Writer
+}
+
+// PlanRejectedError reports plan lines that did not route to an allowed
+// command.
+type PlanRejectedError struct {
+	Script string
+	Steps  []PlanStep
+}
+
+func (e *PlanRejectedError) Error() string {
+	problems := make([]string, len(e.Steps))
+	for i, step := range e.Steps {
+		problems[i] = fmt.Sprintf("line %d: %s", step.Line, step.Reason)
+		if len(step.ValidationErrors) > 0 {
+			problems[i] += ": " + strings.Join(step.ValidationErrors, "; ")
+		}
+	}
+	return "AI plan rejected\n" + strings.Join(problems, "\n")
+}
+
+// Run plans input, validates and shows the plan, and runs it once approved.
+func (b PlanBackend) Run(ctx context.Context, input string) error {
+	if b.Planner == nil {
+		return errors.New("plan backend has no planner")
+	}
+	stderr := defaultWriter(b.Stderr, os.Stderr)
+	text, err := b.Planner.Plan(ctx, input, Tools())
+	if err != nil {
+		return err
+	}
+	script, err := planScript(text)
+	if err != nil {
+		return err
+	}
+
+	policy := b.Policy
+	steps, err := Plan(ctx, script, ScriptOptions{Policy: &policy})
+	if err != nil {
+		return fmt.Errorf("AI plan failed validation: %w", err)
+	}
+	if len(steps) == 0 {
+		return ErrEmptyPlan
+	}
+	var rejected []PlanStep
+	for _, step := range steps {
+		if step.Kind == RouteRejected || step.Kind == RouteNeedsAI {
+			rejected = append(rejected, step)
+		}
+	}
+	writef(stderr, "gosh: plan for %q:\n", input)
+	WritePlan(stderr, steps)
+	if len(rejected) > 0 {
+		return &PlanRejectedError{Script: script, Steps: rejected}
+	}
+
+	approver := b.Approver
+	if approver == nil {
+		approver = CLIApprover(os.Stdin, stderr, false)
+	}
+	if err := approver.Approve(ctx, planApproval(script, steps)); err != nil {
+		return &ApprovalError{Input: script, Result: planApproval(script, steps), Err: err}
+	}
+	return RunWithOptions(ctx, script, ScriptOptions{Policy: &policy})
+}
+
+// planApproval summarizes a plan for an Approver: it carries the highest
+// risk of its lines and always requires approval.
+func planApproval(script string, steps []PlanStep) RouteResult {
+	result := RouteResult{
+		Kind:             RouteGoshCommand,
+		Input:            script,
+		Confidence:       1,
+		Valid:            true,
+		Risk:             RiskLow,
+		RequiresApproval: true,
+		Reason:           fmt.Sprintf("AI-generated plan of %d line(s)", len(steps)),
+	}
+	for _, step := range steps {
+		if riskRank(step.Risk) > riskRank(result.Risk) {
+			result.Risk = step.Risk
+		}
+		for _, reason := range step.RiskReasons {
+			result.RiskReasons = append(result.RiskReasons, step.Command+": "+reason)
+		}
+	}
+	return result
+}
+
+// plannedCall is one tool call in a JSON plan.
+type plannedCall struct {
+	Tool      string                 `json:"tool"`
+	Name      string                 `json:"name"`
+	Args      map[string]interface{} `json:"args"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// planScript turns a planner's reply into a script: code fences are
+// removed, and a JSON list of tool calls becomes one line per call.
+func planScript(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[strings.Index(text, "\n")+1:], "\n")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	if text == "" {
+		return "", ErrEmptyPlan
+	}
+	if !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "{") {
+		return text, nil
+	}
+
+	var calls []plannedCall
+	if strings.HasPrefix(text, "{") {
+		var single plannedCall
+		if err := json.Unmarshal([]byte(text), &single); err != nil {
+			return "", fmt.Errorf("AI plan is not valid JSON: %w", err)
+		}
+		calls = []plannedCall{single}
+	} else if err := json.Unmarshal([]byte(text), &calls); err != nil {
+		return "", fmt.Errorf("AI plan is not valid JSON: %w", err)
+	}
+
+	var lines []string
+	for i, planned := range calls {
+		name := planned.Tool
+		if name == "" {
+			name = planned.Name
+		}
+		arguments := planned.Args
+		if arguments == nil {
+			arguments = planned.Arguments
+		}
+		call, ok := Calls[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("AI plan call %d: unknown tool %q", i+1, name)
+		}
+		if arguments == nil {
+			arguments = map[string]interface{}{}
+		}
+		raw, argv, err := mcpArgs(call.Tool, arguments)
+		if err != nil {
+			return "", fmt.Errorf("AI plan call %d: %w", i+1, err)
+		}
+		if call.Tool.Structured {
+			for len(argv) > 0 && argv[len(argv)-1] == "" {
+				argv = argv[:len(argv)-1]
+			}
+			lines = append(lines, commandLine(call.Name, argv))
+		} else {
+			lines = append(lines, strings.TrimSpace(call.Name+" "+raw))
+		}
+	}
+	if len(lines) == 0 {
+		return "", ErrEmptyPlan
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// CodexPlanner asks `codex exec`, in a read-only sandbox, for a plan.
+type CodexPlanner struct {
+	Codex CodexBackend
+}
+
+// Plan runs Codex with the tool catalog and returns its reply.
+func (p CodexPlanner) Plan(ctx context.Context, input string, tools []ToolInfo) (string, error) {
+	backend := p.Codex
+	backend.Sandbox = "read-only"
+	backend.JSON = false
+	prompt, err := plannerPrompt(input, tools)
+	if err != nil {
+		return "", err
+	}
+	cmd, err := backend.command(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func plannerPrompt(input string, tools []ToolInfo) (string, error) {
+	catalog, err := json.MarshalIndent(tools, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(`Plan the user's request as a gosh script. Do not run any commands yourself.
+Use only the tools below, one command per line, with arguments in parameter order:
+quote arguments that contain spaces, and use no shell syntax such as pipes or redirection.
+Reply with the script alone, or with a JSON array of {"tool": name, "args": {param: value}} objects.
+
+Tools:
+` + string(catalog) + `
+
+User input:
+` + input), nil
+}
+
+// defaultAIBackend returns the backend RouteWithOptions uses when none is
+// set, as chosen by AIBackendEnv and AIModeEnv. In plan mode, plans may use
+// registered gosh commands and the external commands the route policy's
+// rules allow, but nothing the policy admits only through AllowExternal or
+// AllowedExternal.
+func defaultAIBackend(options RouteOptions) AIBackend {
+	backend, planner, err := selectAIBackend(options)
+	if err != nil {
+		return errBackend{err: err}
+	}
+	if strings.EqualFold(os.Getenv(AIModeEnv), "plan") {
+		policy := options.Policy
+		policy.AllowExternal = false
+		policy.AllowedExternal = nil
+		return PlanBackend{
+			Planner:  planner,
+			Policy:   policy,
+			Approver: options.Approver,
+			Stderr:   defaultWriter(options.Stderr, os.Stderr),
+		}
+	}
+	return backend
+}
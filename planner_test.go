@@ -0,0 +1,160 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var goshPlannerTestCalls []string
+
+var _ = Tool("GoshPlannerTestRelease", func(version string, notes string) {
+	goshPlannerTestCalls = append(goshPlannerTestCalls, version, notes)
+},
+	Desc("Tag a release"),
+	Param("version"),
+	Param("notes", Optional()),
+)
+
+func plannerReturning(script string) Planner {
+	return PlannerFunc(func(ctx context.Context, input string, tools []ToolInfo) (string, error) {
+		return script, nil
+	})
+}
+
+func TestPlanScriptAcceptsScriptsAndJSON(t *testing.T) {
+	cases := map[string]string{
+		"GoshPlannerTestRelease 1.2.3\n":                                                           "GoshPlannerTestRelease 1.2.3",
+		"```gosh\nGoshPlannerTestRelease 1.2.3\n```":                                               "GoshPlannerTestRelease 1.2.3",
+		`[{"tool": "GoshPlannerTestRelease", "args": {"version": "1.2.3", "notes": "two words"}}]`: "GoshPlannerTestRelease 1.2.3 'two words'",
+		`{"name": "GoshPlannerTestRelease", "arguments": {"version": "2.0.0"}}`:                    "GoshPlannerTestRelease 2.0.0",
+	}
+	for text, want := range cases {
+		got, err := planScript(text)
+		if err != nil || got != want {
+			t.Fatalf("planScript(%q) = %q, %v; want %q", text, got, err, want)
+		}
+	}
+	if _, err := planScript("  "); !errors.Is(err, ErrEmptyPlan) {
+		t.Fatalf("empty plan error = %v", err)
+	}
+	if _, err := planScript(`[{"tool": "GoshPlannerTestMissing"}]`); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Fatalf("unknown tool error = %v", err)
+	}
+	if _, err := planScript(`[{"tool": "GoshPlannerTestRelease", "args": {"bogus": "x"}}]`); err == nil {
+		t.Fatal("unknown argument accepted")
+	}
+}
+
+func TestPlanBackendRunsApprovedPlans(t *testing.T) {
+	goshPlannerTestCalls = nil
+	var stderr bytes.Buffer
+	var approved RouteResult
+	backend := PlanBackend{
+		Planner: plannerReturning("set version = 1.2.3\nGoshPlannerTestRelease ${version} notes"),
+		Approver: ApproverFunc(func(ctx context.Context, result RouteResult) error {
+			approved = result
+			return nil
+		}),
+		Stderr: &stderr,
+	}
+	if err := backend.Run(context.Background(), "release 1.2.3"); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	if !reflect.DeepEqual(goshPlannerTestCalls, []string{"1.2.3", "notes"}) {
+		t.Fatalf("calls = %v", goshPlannerTestCalls)
+	}
+	if !approved.RequiresApproval || !strings.Contains(approved.Input, "GoshPlannerTestRelease ${version}") {
+		t.Fatalf("approval = %+v", approved)
+	}
+	if !strings.Contains(stderr.String(), `plan for "release 1.2.3"`) || !strings.Contains(stderr.String(), "GoshPlannerTestRelease 1.2.3 notes") {
+		t.Fatalf("plan output = %q", stderr.String())
+	}
+}
+
+func TestPlanBackendRejectsLinesOutsidePolicy(t *testing.T) {
+	goshPlannerTestCalls = nil
+	target := filepath.Join(t.TempDir(), "keep")
+	if err := os.WriteFile(target, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend := PlanBackend{
+		Planner:  plannerReturning("GoshPlannerTestRelease 1.0.0\nrm " + target + "\nunlink " + target),
+		Approver: AssumeYes,
+		Stderr:   &bytes.Buffer{},
+	}
+	err := backend.Run(context.Background(), "clean up")
+	var rejected *PlanRejectedError
+	if !errors.As(err, &rejected) || len(rejected.Steps) != 1 || rejected.Steps[0].Command != "unlink" {
+		t.Fatalf("Run = %v", err)
+	}
+	if len(goshPlannerTestCalls) != 0 {
+		t.Fatalf("rejected plan ran: %v", goshPlannerTestCalls)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("rejected plan removed file: %v", err)
+	}
+
+	backend.Planner = plannerReturning("GoshPlannerTestRelease")
+	if err := backend.Run(context.Background(), "release"); !errors.As(err, &rejected) || len(rejected.Steps[0].ValidationErrors) == 0 {
+		t.Fatalf("invalid arguments = %v", err)
+	}
+}
+
+func TestPlanBackendStopsWhenDeclined(t *testing.T) {
+	goshPlannerTestCalls = nil
+	backend := PlanBackend{
+		Planner: plannerReturning("GoshPlannerTestRelease 1.0.0"),
+		Approver: ApproverFunc(func(context.Context, RouteResult) error {
+			return ErrNotApproved
+		}),
+		Stderr: &bytes.Buffer{},
+	}
+	err := backend.Run(context.Background(), "release")
+	var approvalErr *ApprovalError
+	if !errors.As(err, &approvalErr) || !errors.Is(err, ErrNotApproved) || len(goshPlannerTestCalls) != 0 {
+		t.Fatalf("Run = %v, calls %v", err, goshPlannerTestCalls)
+	}
+}
+
+func TestCodexPlannerRunsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	fakeCodex := filepath.Join(dir, "codex")
+	script := "#!/bin/sh\nfor arg in \"$@\"; do printf '%s\\n' \"$arg\" >> \"$GOSH_FAKE_CODEX_ARGS\"; done\necho GoshPlannerTestRelease 3.0.0\n"
+	if err := os.WriteFile(fakeCodex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	argsFile := filepath.Join(dir, "args.txt")
+	t.Setenv("GOSH_FAKE_CODEX_ARGS", argsFile)
+
+	planner := CodexPlanner{Codex: CodexBackend{Binary: fakeCodex, Dir: dir, Sandbox: "workspace-write"}}
+	text, err := planner.Plan(context.Background(), "release 3", Tools())
+	if err != nil || strings.TrimSpace(text) != "GoshPlannerTestRelease 3.0.0" {
+		t.Fatalf("Plan = %q, %v", text, err)
+	}
+	raw, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := string(raw)
+	if !strings.Contains(args, "--sandbox\nread-only\n") || !strings.Contains(args, "GoshPlannerTestRelease") || !strings.Contains(args, "release 3") {
+		t.Fatalf("codex args = %q", args)
+	}
+}
+
+func TestDefaultAIBackendPlanMode(t *testing.T) {
+	t.Setenv(AIModeEnv, "")
+	if _, ok := defaultAIBackend(RouteOptions{Policy: DefaultPolicy()}).(CodexBackend); !ok {
+		t.Fatal("default mode is not exec")
+	}
+	t.Setenv(AIModeEnv, "plan")
+	backend, ok := defaultAIBackend(RouteOptions{Policy: DefaultPolicy(), Approver: AssumeYes}).(PlanBackend)
+	if !ok || backend.Policy.AllowExternal || backend.Approver == nil {
+		t.Fatalf("plan mode backend = %#v", backend)
+	}
+}
@@ -0,0 +1,167 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// PluginPrefix is the file name prefix LoadPlugins looks for.
+const PluginPrefix = "gosh-"
+
+// LoadPlugins registers the tools of every `gosh-*` executable in dirs.
+//
+// A plugin is any program that prints its tool catalog for
+// `<plugin> tools --json` and runs a tool for `<plugin> <Tool> [args...]`.
+// Any compiled program whose main calls gosh.Menu already does both, so Go
+// commands can be built once and then used by scripts and the gosh
+// interpreter without a Go toolchain.
+//
+// With no dirs, LoadPlugins reads GOSH_PLUGIN_PATH (a list of directories)
+// or falls back to the gosh/plugins directory under os.UserConfigDir.
+// Tools whose names are already registered are skipped and reported in the
+// returned error; the remaining plugins are still loaded.
+func LoadPlugins(dirs ...string) error {
+	if len(dirs) == 0 {
+		dirs = defaultPluginDirs()
+	}
+	var problems []string
+	for _, dir := range dirs {
+		entries, err := readDirNames(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				problems = append(problems, err.Error())
+			}
+			continue
+		}
+		for _, name := range entries {
+			if !strings.HasPrefix(name, PluginPrefix) {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				continue
+			}
+			if err := RegisterPlugin(path); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("loading plugins: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RegisterPlugin registers the tools published by one plugin executable.
+func RegisterPlugin(path string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(path, "tools", "--json")
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("plugin %s: tools --json: %w", path, err)
+	}
+	var specs []ToolSpec
+	if err := json.Unmarshal(out.Bytes(), &specs); err != nil {
+		return fmt.Errorf("plugin %s: invalid tool catalog: %w", path, err)
+	}
+
+	var problems []string
+	for _, spec := range specs {
+		if spec.Name == "" {
+			continue
+		}
+		if _, found := Calls[strings.ToLower(spec.Name)]; found {
+			problems = append(problems, fmt.Sprintf("plugin %s: tool %s is already registered", path, spec.Name))
+			continue
+		}
+		registerCall(spec.Name, pluginFunc(path, spec), pluginOptions(spec)...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func defaultPluginDirs() []string {
+	if value := os.Getenv("GOSH_PLUGIN_PATH"); value != "" {
+		return filepath.SplitList(value)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(configDir, "gosh", "plugins")}
+}
+
+func pluginOptions(spec ToolSpec) []ToolOption {
+	options := []ToolOption{Desc(spec.Description)}
+	if spec.Risk != "" {
+		options = append(options, Risk(spec.Risk))
+	}
+	if spec.RequiresApproval {
+		options = append(options, RequiresApproval())
+	}
+	if !spec.Structured {
+		return options
+	}
+	for _, param := range spec.Params {
+		paramOptions := []ParamOption{Type(param.Type), ParamDesc(param.Description)}
+		if len(param.Enum) > 0 {
+			paramOptions = append(paramOptions, Enum(param.Enum...))
+		}
+		if !param.Required {
+			paramOptions = append(paramOptions, Optional())
+		}
+		if param.Secret {
+			paramOptions = append(paramOptions, Secret())
+		}
+		options = append(options, Param(param.Name, paramOptions...))
+	}
+	return options
+}
+
+// pluginFunc builds a Go function matching the plugin tool's signature, so
+// the usual validation and binding apply. Structured tools receive one
+// string per param; other tools receive their raw input.
+func pluginFunc(path string, spec ToolSpec) interface{} {
+	if !spec.Structured {
+		return func(s *Script, input string) error {
+			args, err := rawArgs(input)
+			if err != nil {
+				return err
+			}
+			return s.execArgs(append([]string{path, spec.Name}, args...), nil)
+		}
+	}
+
+	in := []reflect.Type{reflect.TypeOf(&Script{})}
+	for range spec.Params {
+		in = append(in, reflect.TypeOf(""))
+	}
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	fnType := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+	return reflect.MakeFunc(fnType, func(values []reflect.Value) []reflect.Value {
+		script := values[0].Interface().(*Script)
+		args := make([]string, len(spec.Params))
+		for i, value := range values[1:] {
+			args[i] = value.String()
+		}
+		// Optional args are positional, so omitted ones are passed as their
+		// zero value unless nothing follows them.
+		for len(args) > 0 && !spec.Params[len(args)-1].Required && args[len(args)-1] == zeroValueString(spec.Params[len(args)-1]) {
+			args = args[:len(args)-1]
+		}
+		err := script.execArgs(append([]string{path, spec.Name}, args...), nil)
+		result := reflect.New(errorType).Elem()
+		if err != nil {
+			result.Set(reflect.ValueOf(err))
+		}
+		return []reflect.Value{result}
+	}).Interface()
+}
@@ -0,0 +1,124 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fakePluginCatalog = `[
+  {"name": "GoshPluginTestGreet", "description": "Greet someone", "risk": "low", "structured": true,
+   "params": [{"name": "who", "type": "string", "required": true},
+              {"name": "note", "type": "string", "required": false, "secret": true},
+              {"name": "times", "type": "integer", "required": false}]},
+  {"name": "goshPluginTestRaw", "structured": false, "params": [{"name": "input", "type": "string"}]},
+  {"name": "echo", "structured": false}
+]`
+
+func writeFakePlugin(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "gosh-fake")
+	script := "#!/bin/sh\nif [ \"$1\" = tools ]; then cat <<'EOF'\n" + fakePluginCatalog + "\nEOF\nexit 0; fi\n" +
+		"printf '%s|' \"$@\" > \"$GOSH_FAKE_PLUGIN_OUT\"\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gosh-not-executable"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other-tool"), []byte("x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPluginsRegistersTools(t *testing.T) {
+	dir := t.TempDir()
+	writeFakePlugin(t, dir)
+	out := filepath.Join(dir, "out.txt")
+	t.Setenv("GOSH_FAKE_PLUGIN_OUT", out)
+	t.Setenv("GOSH_PLUGIN_PATH", dir)
+	defer func() {
+		delete(Calls, "goshplugintestgreet")
+		delete(Calls, "goshplugintestraw")
+	}()
+
+	err := LoadPlugins()
+	if err == nil || !strings.Contains(err.Error(), "echo is already registered") {
+		t.Fatalf("LoadPlugins error = %v", err)
+	}
+
+	greet, ok := Calls["goshplugintestgreet"]
+	if !ok || !greet.Exported || greet.Tool.Description != "Greet someone" || len(greet.Tool.Params) != 3 {
+		t.Fatalf("greet call = %+v", greet)
+	}
+	if greet.Tool.Params[2].Type != "integer" || greet.Tool.Params[2].Required || !greet.Tool.Params[1].Secret {
+		t.Fatalf("greet params = %+v", greet.Tool.Params)
+	}
+	properties := greet.Tool.inputSchema()["properties"].(map[string]interface{})
+	if properties["note"].(map[string]interface{})["writeOnly"] != true {
+		t.Fatalf("secret plugin param schema = %+v", properties["note"])
+	}
+
+	script := testScript(dir)
+	script.env["GOSH_FAKE_PLUGIN_OUT"] = out
+	script.Run(`GoshPluginTestGreet "big world" hi 3`)
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	assertPluginArgs(t, out, "GoshPluginTestGreet|big world|hi|3|")
+
+	script.Run(`GoshPluginTestGreet bob "" 2`)
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	assertPluginArgs(t, out, "GoshPluginTestGreet|bob||2|")
+	script.Run(`GoshPluginTestGreet bob`)
+	assertPluginArgs(t, out, "GoshPluginTestGreet|bob|")
+
+	script.Run(`GoshPluginTestGreet bob hi nope`)
+	if script.firstErr == nil || !strings.Contains(script.firstErr.Error(), "times must be integer") {
+		t.Fatalf("expected validation error, got %v", script.firstErr)
+	}
+
+	script = testScript(dir)
+	script.env["GOSH_FAKE_PLUGIN_OUT"] = out
+	script.Run(`goshPluginTestRaw one "two three"`)
+	if script.firstErr != nil {
+		t.Fatal(script.firstErr)
+	}
+	assertPluginArgs(t, out, "goshPluginTestRaw|one|two three|")
+}
+
+func TestRegisterPluginRejectsBadCatalogs(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "gosh-bad")
+	if err := os.WriteFile(bad, []byte("#!/bin/sh\necho not-json\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPlugin(bad); err == nil || !strings.Contains(err.Error(), "invalid tool catalog") {
+		t.Fatalf("RegisterPlugin error = %v", err)
+	}
+	failing := filepath.Join(dir, "gosh-failing")
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\nexit 3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPlugin(failing); err == nil {
+		t.Fatalf("expected failing plugin error")
+	}
+	if err := LoadPlugins(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("missing plugin dirs should be ignored: %v", err)
+	}
+}
+
+func assertPluginArgs(t *testing.T, path string, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("plugin args = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PolicyEnv names the environment variable Menu reads a policy from when no
+// `--policy` flag is given.
+const PolicyEnv = "GOSH_POLICY"
+
+var policyPresets = map[string]func() Policy{
+	"default":  DefaultPolicy,
+	"safe":     SafePolicy,
+	"readonly": ReadOnlyPolicy,
+}
+
+// PolicyPresets returns the names LoadPolicy accepts besides file paths.
+func PolicyPresets() []string {
+	names := make([]string, 0, len(policyPresets))
+	for name := range policyPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPolicy returns the named preset (`default`, `safe` or `readonly`) or
+// reads a policy from a JSON or YAML file. Files use the Policy JSON field
+// names, and may start from a preset with `extends`. Their fields replace
+// the preset's, except rules, which are added after the preset's rules, so
+// the preset's deny rules still decide first:
+//
+//	extends: readonly
+//	max_external_risk: medium
+//	rules:
+//	  - action: allow
+//	    command: go
+//	    args: [vet, "**"]
+//
+// Presets take precedence over files of the same name; use `./safe` to read
+// a file called safe. Unknown fields are errors.
+func LoadPolicy(nameOrPath string) (Policy, error) {
+	if preset, ok := policyPresets[strings.ToLower(nameOrPath)]; ok {
+		return preset(), nil
+	}
+	if _, err := os.Stat(nameOrPath); err != nil {
+		return Policy{}, fmt.Errorf("policy %q is not a preset (%s) or a readable file: %w", nameOrPath, strings.Join(PolicyPresets(), ", "), err)
+	}
+
+	var raw json.RawMessage
+	if err := readConfigFile(nameOrPath, &raw); err != nil {
+		return Policy{}, err
+	}
+	var base struct {
+		Extends string `json:"extends"`
+	}
+	if err := json.Unmarshal(raw, &base); err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", nameOrPath, err)
+	}
+	var policy Policy
+	if base.Extends != "" {
+		preset, ok := policyPresets[strings.ToLower(base.Extends)]
+		if !ok {
+			return Policy{}, fmt.Errorf("%s: unknown preset %q", nameOrPath, base.Extends)
+		}
+		policy = preset()
+	}
+	presetRules := policy.Rules
+	policy.Rules = nil
+
+	file := struct {
+		Extends string `json:"extends,omitempty"`
+		*Policy
+	}{Policy: &policy}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", nameOrPath, err)
+	}
+	policy.Rules = append(presetRules, policy.Rules...)
+	if err := policy.validate(); err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", nameOrPath, err)
+	}
+	return policy, nil
+}
+
+func (p Policy) validate() error {
+	for _, level := range []RiskLevel{p.MaxExternalRisk, p.MaxCallRisk} {
+		switch level {
+		case "", RiskLow, RiskMedium, RiskHigh:
+		default:
+			return fmt.Errorf("invalid risk level %q", level)
+		}
+	}
+	if p.MatchThreshold < 0 {
+		return fmt.Errorf("invalid match threshold %v", p.MatchThreshold)
+	}
+	for i, rule := range p.Rules {
+		if rule.Action != PolicyAllow && rule.Action != PolicyDeny {
+			return fmt.Errorf("policy rule %d: unknown action %q", i+1, rule.Action)
+		}
+		if rule.Command == "" {
+			return fmt.Errorf("policy rule %d: command is required", i+1)
+		}
+		for _, pattern := range append([]string{rule.Command}, rule.Args...) {
+			if _, err := matchPolicyPattern(pattern, ""); err != nil {
+				return fmt.Errorf("policy rule %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicyPresets(t *testing.T) {
+	for _, name := range []string{"default", "safe", "READONLY"} {
+		if _, err := LoadPolicy(name); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if _, err := LoadPolicy("strict"); err == nil || !strings.Contains(err.Error(), "default, readonly, safe") {
+		t.Fatalf("unknown preset error = %v", err)
+	}
+
+	readonly := ReadOnlyPolicy()
+	for input, kind := range map[string]RouteKind{
+		"ls -la":     RouteExternalCLI,
+		"git status": RouteExternalCLI,
+		"git fetch":  RouteRejected,
+		"mkDir tmp":  RouteRejected,
+		"rm file":    RouteRejected,
+		"echo hi":    RouteGoshCommand,
+	} {
+		if got := ResolveWithPolicy(input, readonly); got.Kind != kind {
+			t.Errorf("readonly %s: %s, want %s (%s)", input, got.Kind, kind, got.Reason)
+		}
+	}
+}
+
+func TestLoadPolicyFiles(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(yamlPath, []byte(`extends: readonly
+max_external_risk: medium
+rules:
+  - action: allow
+    command: go
+    args: [vet, "**"]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxExternalRisk != RiskMedium || policy.MaxCallRisk != RiskLow || len(policy.Rules) != 2 || len(policy.AllowedExternal) == 0 {
+		t.Fatalf("policy = %+v", policy)
+	}
+	if got := ResolveWithPolicy("go vet ./...", policy); got.Kind != RouteExternalCLI {
+		t.Fatalf("go vet = %+v", got)
+	}
+	// The preset's deny rules survive the file's rules.
+	if got := ResolveWithPolicy("mkdir y", policy); got.Kind != RouteRejected {
+		t.Fatalf("mkdir under an extended readonly policy = %+v", got)
+	}
+
+	jsonPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"allow_external": true, "denied_external": ["curl"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err = LoadPolicy(jsonPath)
+	if err != nil || !policy.AllowExternal || policy.DeniedExternal[0] != "curl" {
+		t.Fatalf("json policy = %+v, %v", policy, err)
+	}
+
+	for name, content := range map[string]string{
+		"typo.yaml":   "allowed_externals: [ls]\n",
+		"extends.yml": "extends: lax\n",
+		"risk.json":   `{"max_external_risk": "extreme"}`,
+		"rule.yaml":   "rules:\n  - action: block\n    command: ls\n",
+		"regex.yaml":  "rules:\n  - action: deny\n    command: ls\n    args: [\"/[/\"]\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMenuPolicyFlagAndShow(t *testing.T) {
+	oldArgs := os.Args
+	oldDefaultErr := defaultErr
+	defer func() {
+		os.Args = oldArgs
+		defaultErr = oldDefaultErr
+	}()
+	var gotErr error
+	defaultErr = func(err error) { gotErr = err }
+
+	var out bytes.Buffer
+	os.Args = []string{"goshfile", "--policy", "safe", "policy", "show"}
+	MenuWithOptions(MenuOptions{Stdout: &out})
+	var shown Policy
+	if err := json.Unmarshal(out.Bytes(), &shown); err != nil || gotErr != nil {
+		t.Fatalf("policy show = %q, %v, %v", out.String(), err, gotErr)
+	}
+	if shown.MaxExternalRisk != RiskLow || !shown.RejectHighRiskExternal {
+		t.Fatalf("shown = %+v", shown)
+	}
+
+	out.Reset()
+	t.Setenv(PolicyEnv, "readonly")
+	os.Args = []string{"goshfile", "--resolve", "rm", "file"}
+	MenuWithOptions(MenuOptions{Policy: DefaultPolicy(), PolicySet: true, Stdout: &out})
+	var result RouteResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil || result.Kind != RouteRejected {
+		t.Fatalf("resolve under GOSH_POLICY = %q, %v", out.String(), err)
+	}
+
+	os.Args = []string{"goshfile", "--policy=missing-policy-file", "policy", "show"}
+	MenuWithOptions(MenuOptions{Stdout: &bytes.Buffer{}})
+	if gotErr == nil || !strings.Contains(gotErr.Error(), "missing-policy-file") {
+		t.Fatalf("missing policy err = %v", gotErr)
+	}
+	gotErr = nil
+	os.Args = []string{"goshfile", "policy"}
+	MenuWithOptions(MenuOptions{Stdout: &bytes.Buffer{}})
+	if gotErr == nil || !strings.Contains(gotErr.Error(), "invalid meta command") {
+		t.Fatalf("policy err = %v", gotErr)
+	}
+}
+
+func TestMCPPolicyRejectsCalls(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Rules = []PolicyRule{DenyRule("GoshTypedDeployTest", "prod", "**")}
+	options := MCPOptions{AllowApprovalRequired: true, AllowHighRisk: true, Policy: &policy}
+	_, rpcErr := callMCPToolWithOptions("GoshTypedDeployTest", map[string]interface{}{"env": "prod", "count": 1}, options)
+	if rpcErr == nil || rpcErr.Message != "Rejected by policy" {
+		t.Fatalf("rpc error = %+v", rpcErr)
+	}
+	if _, rpcErr := callMCPToolWithOptions("GoshTypedDeployTest", map[string]interface{}{"env": "staging", "count": 1}, options); rpcErr != nil {
+		t.Fatalf("staging rpc error = %+v", rpcErr)
+	}
+}
@@ -0,0 +1,155 @@
+package gosh
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// PolicyAction is what a PolicyRule does with the commands it matches.
+type PolicyAction string
+
+const (
+	PolicyAllow PolicyAction = "allow"
+	PolicyDeny  PolicyAction = "deny"
+)
+
+// PolicyRule allows or denies command lines by command name and arguments.
+//
+// Command is matched against the registered gosh command or the executable
+// base name, case-insensitively. Args are matched against the arguments in
+// order, and the command must have exactly as many arguments as there are
+// patterns, unless the last pattern is `**`, which matches any remaining
+// arguments. Leave Args empty to match any arguments.
+//
+// Patterns use `*` for any text (including `/`) and `?` for one character,
+// and may list alternatives separated by `|`, such as `status|diff|log`.
+// A pattern written as `/.../` is a regular expression that must match the
+// whole value instead.
+type PolicyRule struct {
+	Action  PolicyAction `json:"action"`
+	Command string       `json:"command"`
+	Args    []string     `json:"args,omitempty"`
+	Reason  string       `json:"reason,omitempty"`
+}
+
+// AllowRule returns a PolicyRule allowing command with matching args.
+func AllowRule(command string, args ...string) PolicyRule {
+	return PolicyRule{Action: PolicyAllow, Command: command, Args: args}
+}
+
+// DenyRule returns a PolicyRule denying command with matching args.
+func DenyRule(command string, args ...string) PolicyRule {
+	return PolicyRule{Action: PolicyDeny, Command: command, Args: args}
+}
+
+func (rule PolicyRule) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", rule.Action, rule.Command, strings.Join(rule.Args, " ")))
+}
+
+func (rule PolicyRule) matches(command string, args []string) (bool, error) {
+	matched, err := matchPolicyPattern(strings.ToLower(rule.Command), strings.ToLower(command))
+	if err != nil || !matched || len(rule.Args) == 0 {
+		return matched, err
+	}
+	for i, pattern := range rule.Args {
+		if pattern == "**" && i == len(rule.Args)-1 {
+			return true, nil
+		}
+		if i >= len(args) {
+			return false, nil
+		}
+		matched, err := matchPolicyPattern(pattern, args[i])
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return len(args) == len(rule.Args), nil
+}
+
+// policyVerdict is the outcome of evaluating a policy's rules.
+type policyVerdict struct {
+	// Action is empty when no rule matched.
+	Action PolicyAction
+	Index  int
+	Rule   PolicyRule
+	Err    error
+}
+
+func (v policyVerdict) reason() string {
+	if v.Err != nil {
+		return fmt.Sprintf("invalid policy rule %d (%s): %v", v.Index+1, v.Rule, v.Err)
+	}
+	reason := fmt.Sprintf("%s by policy rule %d (%s)", map[PolicyAction]string{PolicyAllow: "allowed", PolicyDeny: "denied"}[v.Action], v.Index+1, v.Rule)
+	if v.Rule.Reason != "" {
+		reason += ": " + v.Rule.Reason
+	}
+	return reason
+}
+
+// evaluateRules applies the policy's rules to a command line. The first
+// matching rule decides. Commands run through wrappers such as sudo or
+// `bash -c` are checked too: a deny for any of them denies the whole line,
+// while only a rule for the outer command can allow it.
+func (p Policy) evaluateRules(command string, args []string) policyVerdict {
+	if len(p.Rules) == 0 {
+		return policyVerdict{}
+	}
+	var outer policyVerdict
+	for i, argv := range commandChain(command, args) {
+		verdict := p.firstRule(argv[0], argv[1:])
+		if verdict.Err != nil || verdict.Action == PolicyDeny {
+			return verdict
+		}
+		if i == 0 {
+			outer = verdict
+		}
+	}
+	return outer
+}
+
+func (p Policy) firstRule(command string, args []string) policyVerdict {
+	command = filepath.Base(command)
+	for i, rule := range p.Rules {
+		matched, err := rule.matches(command, args)
+		if err != nil {
+			return policyVerdict{Action: PolicyDeny, Index: i, Rule: rule, Err: err}
+		}
+		if !matched {
+			continue
+		}
+		if rule.Action != PolicyAllow && rule.Action != PolicyDeny {
+			return policyVerdict{Action: PolicyDeny, Index: i, Rule: rule, Err: fmt.Errorf("unknown action %q", rule.Action)}
+		}
+		return policyVerdict{Action: rule.Action, Index: i, Rule: rule}
+	}
+	return policyVerdict{}
+}
+
+var policyPatterns sync.Map
+
+func matchPolicyPattern(pattern, value string) (bool, error) {
+	if cached, ok := policyPatterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp).MatchString(value), nil
+	}
+	var expr string
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = "^(?:" + pattern[1:len(pattern)-1] + ")$"
+	} else {
+		alternatives := strings.Split(pattern, "|")
+		for i, alternative := range alternatives {
+			quoted := regexp.QuoteMeta(alternative)
+			quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+			alternatives[i] = strings.ReplaceAll(quoted, `\?`, ".")
+		}
+		expr = "^(?s:" + strings.Join(alternatives, "|") + ")$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false, err
+	}
+	policyPatterns.Store(pattern, re)
+	return re.MatchString(value), nil
+}
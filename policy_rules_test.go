@@ -0,0 +1,123 @@
+package gosh
+
+import (
+	"strings"
+	"testing"
+)
+
+var _ = Cmd("goshPolicyRulesTest", func(target string) {})
+
+func TestPolicyRulesOrderedAllowDeny(t *testing.T) {
+	policy := Policy{
+		Rules: []PolicyRule{
+			AllowRule("git", "status|diff|log", "**"),
+			DenyRule("git"),
+			AllowRule("ls"),
+		},
+	}
+	cases := []struct {
+		input string
+		kind  RouteKind
+	}{
+		{"git status", RouteExternalCLI},
+		{"git log --oneline -5", RouteExternalCLI},
+		{"git push origin main", RouteRejected},
+		{"ls -la", RouteExternalCLI},
+		{"cat README.md", RouteRejected},
+	}
+	for _, c := range cases {
+		if got := ResolveWithPolicy(c.input, policy); got.Kind != c.kind {
+			t.Errorf("%s: %s, want %s (%s)", c.input, got.Kind, c.kind, got.Reason)
+		}
+	}
+
+	denied := ResolveWithPolicy("git push", policy)
+	if !strings.Contains(denied.Reason, "denied by policy rule 2 (deny git)") || denied.Executable == "" || denied.Risk != RiskHigh {
+		t.Fatalf("denied = %+v", denied)
+	}
+}
+
+func TestPolicyRuleArgPatterns(t *testing.T) {
+	cases := []struct {
+		rule PolicyRule
+		argv []string
+		want bool
+	}{
+		{AllowRule("kubectl", "get", "*"), []string{"kubectl", "get", "pods"}, true},
+		{AllowRule("kubectl", "get", "*"), []string{"kubectl", "get", "pods", "-A"}, false},
+		{AllowRule("kubectl", "get", "**"), []string{"kubectl", "get"}, true},
+		{AllowRule("KUBECTL"), []string{"/usr/bin/kubectl", "delete", "pod"}, true},
+		{AllowRule("cat", "docs/*"), []string{"cat", "docs/a/b.md"}, true},
+		{AllowRule("cat", "doc?.md"), []string{"cat", "docs.md"}, true},
+		{AllowRule("git", "checkout", "/v[0-9]+(\\.[0-9]+)*/"), []string{"git", "checkout", "v1.2"}, true},
+		{AllowRule("git", "checkout", "/v[0-9]+/"), []string{"git", "checkout", "xv1"}, false},
+		{AllowRule("git", "a.c"), []string{"git", "abc"}, false},
+	}
+	for _, c := range cases {
+		policy := Policy{Rules: []PolicyRule{c.rule}}
+		got := policy.firstRule(c.argv[0], c.argv[1:])
+		if (got.Action == PolicyAllow) != c.want || got.Err != nil {
+			t.Errorf("%s on %q: %+v, want match %v", c.rule, c.argv, got, c.want)
+		}
+	}
+}
+
+func TestPolicyRulesCoverCallsAndWrappers(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Rules = []PolicyRule{
+		DenyRule("goshPolicyRulesTest", "prod"),
+		DenyRule("git", "push", "**"),
+	}
+	if got := ResolveWithPolicy("goshPolicyRulesTest prod", policy); got.Kind != RouteRejected || got.Command != "goshPolicyRulesTest" {
+		t.Fatalf("call = %+v", got)
+	}
+	if got := ResolveWithPolicy("goshPolicyRulesTest staging", policy); got.Kind != RouteGoshCommand {
+		t.Fatalf("call = %+v", got)
+	}
+	for _, input := range []string{`env git push`, `sh -c "git status && git push --force"`} {
+		if got := ResolveWithPolicy(input, policy); got.Kind != RouteRejected || !strings.Contains(got.Reason, "deny git push") {
+			t.Errorf("%s: %+v", input, got)
+		}
+	}
+}
+
+func TestPolicyRulesAllowDoesNotBypassRiskLimits(t *testing.T) {
+	policy := SafePolicy()
+	policy.Rules = []PolicyRule{AllowRule("go", "version")}
+	if got := ResolveWithPolicy("go version", policy); got.Kind != RouteExternalCLI {
+		t.Fatalf("go version = %+v", got)
+	}
+	policy.Rules = []PolicyRule{AllowRule("go")}
+	if got := ResolveWithPolicy("go build", policy); got.Kind != RouteRejected || got.Risk != RiskHigh {
+		t.Fatalf("go build = %+v", got)
+	}
+}
+
+func TestPolicyRulesInvalid(t *testing.T) {
+	policy := Policy{AllowExternal: true, Rules: []PolicyRule{AllowRule("ls", "/[/")}}
+	if got := ResolveWithPolicy("ls x", policy); got.Kind != RouteRejected || !strings.Contains(got.Reason, "invalid policy rule 1") {
+		t.Fatalf("invalid regex = %+v", got)
+	}
+	policy.Rules = []PolicyRule{{Action: "maybe", Command: "ls"}}
+	if got := ResolveWithPolicy("ls", policy); got.Kind != RouteRejected {
+		t.Fatalf("invalid action = %+v", got)
+	}
+}
+
+func TestScriptPolicyRulesRejectCalls(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Rules = []PolicyRule{DenyRule("echo", "secret")}
+	script := testScript(t.TempDir())
+	script.options.Policy = &policy
+	var errs []error
+	script.onErr = func(err error) { errs = append(errs, err) }
+	if _, err := captureStdout(func() error {
+		script.Run("echo public\necho secret")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "denied by policy rule 1") {
+		t.Fatalf("errs = %v", errs)
+	}
+}
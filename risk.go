@@ -0,0 +1,263 @@
+package gosh
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RiskRule assigns a risk level to external commands that match it.
+//
+// Command is matched against the executable base name, and Subcommand against
+// the leading non-flag arguments, in order. Flags are matched against every
+// argument; a rule with Flags only fires when at least one argument matches.
+// All of them are case-insensitive glob patterns, and each may list
+// alternatives separated by `|`, such as `push|commit`. The value of an
+// option written as `--region us-east-1` counts as a non-flag argument.
+//
+// For each command, the most specific matching rule without Flags sets the
+// base level; a longer Subcommand is more specific, literal names are more
+// specific than patterns, and later rules win ties, so loaded rules override
+// the built-in ones. Matching rules with Flags can only raise that level.
+type RiskRule struct {
+	Name       string    `json:"name,omitempty"`
+	Command    string    `json:"command"`
+	Subcommand []string  `json:"subcommand,omitempty"`
+	Flags      []string  `json:"flags,omitempty"`
+	Level      RiskLevel `json:"level"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// riskRules holds the registered rules. Registering replaces the slice
+// rather than appending to it, so classifications can keep using the
+// rules they loaded.
+var riskRules struct {
+	sync.RWMutex
+	rules []RiskRule
+}
+
+// loadRiskRules returns the registered rules; callers must not modify them.
+func loadRiskRules() []RiskRule {
+	riskRules.RLock()
+	defer riskRules.RUnlock()
+	return riskRules.rules
+}
+
+// RegisterRiskRule adds rules to the risk registry used to classify
+// external commands.
+func RegisterRiskRule(rules ...RiskRule) error {
+	checked := make([]RiskRule, 0, len(rules))
+	for _, rule := range rules {
+		rule, err := checkRiskRule(rule)
+		if err != nil {
+			return err
+		}
+		checked = append(checked, rule)
+	}
+	riskRules.Lock()
+	defer riskRules.Unlock()
+	registered := make([]RiskRule, 0, len(riskRules.rules)+len(checked))
+	riskRules.rules = append(append(registered, riskRules.rules...), checked...)
+	return nil
+}
+
+// RiskRules returns the registered risk rules, built-in rules first.
+func RiskRules() []RiskRule {
+	return append([]RiskRule(nil), loadRiskRules()...)
+}
+
+// LoadRiskRules registers the rules in a JSON or YAML file. The file holds
+// either a list of rules or an object with a `rules` list:
+//
+//	rules:
+//	  - name: helm-install
+//	    command: helm
+//	    subcommand: [install]
+//	    level: high
+//	    reason: installs a release into the cluster
+func LoadRiskRules(path string) error {
+	var raw json.RawMessage
+	if err := readConfigFile(path, &raw); err != nil {
+		return err
+	}
+	var file struct {
+		Rules []RiskRule `json:"rules"`
+	}
+	if err := json.Unmarshal(raw, &file.Rules); err != nil {
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := RegisterRiskRule(file.Rules...); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func checkRiskRule(rule RiskRule) (RiskRule, error) {
+	rule.Command = strings.ToLower(strings.TrimSpace(rule.Command))
+	if rule.Command == "" {
+		return rule, fmt.Errorf("risk rule %q: command is required", rule.Name)
+	}
+	switch rule.Level {
+	case RiskLow, RiskMedium, RiskHigh:
+	default:
+		return rule, fmt.Errorf("risk rule %q: invalid level %q", rule.Name, rule.Level)
+	}
+	patterns := append(append([]string{rule.Command}, rule.Subcommand...), rule.Flags...)
+	for _, pattern := range patterns {
+		for _, alternative := range strings.Split(pattern, "|") {
+			if _, err := filepath.Match(alternative, ""); err != nil {
+				return rule, fmt.Errorf("risk rule %q: invalid pattern %q", rule.Name, pattern)
+			}
+		}
+	}
+	if rule.Name == "" {
+		rule.Name = strings.Join(append([]string{rule.Command}, rule.Subcommand...), " ")
+	}
+	return rule, nil
+}
+
+// specificity ranks rules without Flags; -1 means the rule does not match.
+func (rule RiskRule) specificity(name string, words []string) int {
+	score := 0
+	switch matchRiskPattern(rule.Command, name) {
+	case 0:
+		return -1
+	case 2:
+		score = 1
+	}
+	if len(rule.Subcommand) > len(words) {
+		return -1
+	}
+	for i, pattern := range rule.Subcommand {
+		match := matchRiskPattern(pattern, words[i])
+		if match == 0 {
+			return -1
+		}
+		score += 2 + match
+	}
+	return score
+}
+
+// matchRiskPattern reports 2 for a literal match, 1 for a glob match and 0
+// for no match.
+func matchRiskPattern(pattern, value string) int {
+	result := 0
+	for _, alternative := range strings.Split(strings.ToLower(pattern), "|") {
+		if alternative == value {
+			return 2
+		}
+		if matched, _ := filepath.Match(alternative, value); matched {
+			result = 1
+		}
+	}
+	return result
+}
+
+func (rule RiskRule) matchesFlags(args []string) bool {
+	for _, pattern := range rule.Flags {
+		for _, arg := range args {
+			if matchRiskPattern(pattern, arg) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchRiskRule returns the risk of one external command and the rule that
+// decided it. Commands no rule matches are low risk.
+func matchRiskRule(command string, args []string) (RiskLevel, *RiskRule) {
+	name := strings.ToLower(filepath.Base(command))
+	lower := make([]string, len(args))
+	var words []string
+	for i, arg := range args {
+		lower[i] = strings.ToLower(arg)
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			words = append(words, lower[i])
+		}
+	}
+
+	rules := loadRiskRules()
+	var base *RiskRule
+	best := -1
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.Flags) > 0 {
+			continue
+		}
+		if score := rule.specificity(name, words); score >= 0 && score >= best {
+			base, best = rule, score
+		}
+	}
+	level := RiskLow
+	decided := base
+	if base != nil {
+		level = base.Level
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.Flags) == 0 || riskRank(rule.Level) <= riskRank(level) {
+			continue
+		}
+		if rule.specificity(name, words) >= 0 && rule.matchesFlags(lower) {
+			level, decided = rule.Level, rule
+		}
+	}
+	return level, decided
+}
+
+func commandRisk(command string, args []string) RiskLevel {
+	level, _ := matchRiskRule(command, args)
+	return level
+}
+
+var _ = mustRegisterRiskRules(builtinRiskRules)
+
+func mustRegisterRiskRules(rulesJSON string) bool {
+	var rules []RiskRule
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		panic(err)
+	}
+	if err := RegisterRiskRule(rules...); err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// builtinRiskRules uses the same format as LoadRiskRules.
+const builtinRiskRules = `[
+	{"name": "force", "command": "*", "flags": ["-rf", "-fr", "*--force*"], "level": "high", "reason": "forces a destructive operation"},
+
+	{"name": "destructive", "command": "rm|rmdir|mkfs|shutdown|reboot", "level": "high", "reason": "deletes data or stops the machine"},
+	{"name": "network", "command": "curl|wget|ssh|scp|rsync|docker", "level": "medium", "reason": "reaches other machines or containers"},
+
+	{"name": "infra", "command": "terraform|kubectl", "level": "medium", "reason": "talks to infrastructure"},
+	{"name": "infra-change", "command": "terraform|kubectl", "subcommand": ["apply|destroy|import|taint|state|delete|create|replace|patch|scale|drain|exec"], "level": "high", "reason": "changes infrastructure"},
+
+	{"name": "find", "command": "find", "level": "low"},
+	{"name": "find-exec", "command": "find", "flags": ["-delete", "-exec", "-execdir", "-ok", "-okdir"], "level": "high", "reason": "deletes files or runs commands"},
+	{"name": "sed", "command": "sed", "level": "low"},
+	{"name": "sed-in-place", "command": "sed", "flags": ["-i*", "--in-place", "--in-place=*"], "level": "high", "reason": "edits files in place"},
+
+	{"name": "git", "command": "git", "level": "low"},
+	{"name": "git-any", "command": "git", "subcommand": ["*"], "level": "medium", "reason": "may change the repository"},
+	{"name": "git-read", "command": "git", "subcommand": ["status|diff|log|show|rev-parse"], "level": "low", "reason": "only reads the repository"},
+	{"name": "git-branch-list", "command": "git", "subcommand": ["branch"], "level": "low", "reason": "lists branches"},
+	{"name": "git-branch-create", "command": "git", "subcommand": ["branch", "*"], "level": "medium", "reason": "creates a branch"},
+	{"name": "git-branch-change", "command": "git", "subcommand": ["branch"], "flags": ["-d", "--delete", "-m", "--move", "-c", "--copy", "--set-upstream-to*", "--unset-upstream"], "level": "high", "reason": "deletes, renames or rewires branches"},
+	{"name": "git-write", "command": "git", "subcommand": ["push|commit|merge|rebase|checkout|switch|reset|clean|apply|am|stash|cherry-pick|revert"], "level": "high", "reason": "changes commits, branches or the working tree"},
+
+	{"name": "go", "command": "go", "level": "low"},
+	{"name": "go-any", "command": "go", "subcommand": ["*"], "level": "medium"},
+	{"name": "go-read", "command": "go", "subcommand": ["version|env|list"], "level": "low", "reason": "only reads toolchain state"},
+	{"name": "go-build", "command": "go", "subcommand": ["build|run|test|generate|install|mod|work"], "level": "high", "reason": "runs or installs code"},
+
+	{"name": "build-tool", "command": "npm|yarn|pnpm|make", "level": "low"},
+	{"name": "build-tool-any", "command": "npm|yarn|pnpm|make", "subcommand": ["*"], "level": "medium", "reason": "runs project scripts"},
+	{"name": "build-tool-read", "command": "npm|yarn|pnpm|make", "subcommand": ["version|env|list"], "level": "low", "reason": "only reads tool state"},
+	{"name": "build-tool-install", "command": "npm|yarn|pnpm|make", "subcommand": ["install|add|remove|publish|deploy"], "level": "high", "reason": "installs, removes or publishes packages"}
+]`
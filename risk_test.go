@@ -0,0 +1,160 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withRiskRules restores the risk registry when the test ends.
+func withRiskRules(t *testing.T) {
+	saved := loadRiskRules()
+	t.Cleanup(func() {
+		riskRules.Lock()
+		defer riskRules.Unlock()
+		riskRules.rules = saved
+	})
+}
+
+func TestBuiltinRiskRules(t *testing.T) {
+	cases := []struct {
+		input string
+		want  RiskLevel
+		rule  string
+	}{
+		{"git", RiskLow, "git"},
+		{"git status -s", RiskLow, "git-read"},
+		{"git fetch", RiskMedium, "git-any"},
+		{"git push origin main", RiskHigh, "git-write"},
+		{"git branch", RiskLow, "git-branch-list"},
+		{"git branch new", RiskMedium, "git-branch-create"},
+		{"git branch -D old", RiskHigh, "git-branch-change"},
+		{"find . -name x -delete", RiskHigh, "find-exec"},
+		{"sed -i.bak s/a/b/ file", RiskHigh, "sed-in-place"},
+		{"npm --silent install", RiskHigh, "build-tool-install"},
+		{"make", RiskLow, "build-tool"},
+		{"kubectl get pods", RiskMedium, "infra"},
+		{"terraform plan", RiskMedium, "infra"},
+		{"ls --force", RiskHigh, "force"},
+		{"ls -la", RiskLow, ""},
+	}
+	for _, c := range cases {
+		argv, err := SplitArgs(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		level, rule := matchRiskRule(argv[0], argv[1:])
+		name := ""
+		if rule != nil {
+			name = rule.Name
+		}
+		if level != c.want || name != c.rule {
+			t.Errorf("%s: %s by %q, want %s by %q", c.input, level, name, c.want, c.rule)
+		}
+	}
+}
+
+func TestRegisterRiskRuleOverridesBuiltins(t *testing.T) {
+	withRiskRules(t)
+	if err := RegisterRiskRule(RiskRule{Command: "git", Subcommand: []string{"fetch"}, Level: RiskLow}); err != nil {
+		t.Fatal(err)
+	}
+	if level, rule := matchRiskRule("git", []string{"fetch"}); level != RiskLow || rule.Name != "git fetch" {
+		t.Fatalf("git fetch = %s by %+v", level, rule)
+	}
+	// Flag rules only raise the level.
+	if err := RegisterRiskRule(RiskRule{Name: "quiet", Command: "*", Flags: []string{"-q"}, Level: RiskLow}); err != nil {
+		t.Fatal(err)
+	}
+	if level, _ := matchRiskRule("rm", []string{"-q", "file"}); level != RiskHigh {
+		t.Fatalf("rm -q = %s", level)
+	}
+}
+
+func TestRegisterRiskRuleValidates(t *testing.T) {
+	withRiskRules(t)
+	for _, rule := range []RiskRule{
+		{Level: RiskHigh},
+		{Command: "helm", Level: "extreme"},
+		{Command: "helm", Subcommand: []string{"[install"}, Level: RiskHigh},
+	} {
+		if err := RegisterRiskRule(rule); err == nil {
+			t.Errorf("%+v: expected error", rule)
+		}
+	}
+}
+
+func TestLoadRiskRules(t *testing.T) {
+	withRiskRules(t)
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "rules.yaml")
+	jsonPath := filepath.Join(dir, "rules.json")
+	yamlRules := `rules:
+  - name: helm-install
+    command: helm
+    subcommand: [install|upgrade]
+    level: high
+    reason: installs a release into the cluster
+`
+	jsonRules := `[{"name": "aws-s3-rm", "command": "aws", "subcommand": ["s3", "rm"], "level": "high"}]`
+	if err := os.WriteFile(yamlPath, []byte(yamlRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(jsonRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadRiskRules(yamlPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadRiskRules(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	if level := commandRisk("helm", []string{"upgrade", "app", "./chart"}); level != RiskHigh {
+		t.Fatalf("helm upgrade = %s", level)
+	}
+	if level := commandRisk("aws", []string{"--region=us-east-1", "s3", "rm", "s3://bucket/key"}); level != RiskHigh {
+		t.Fatalf("aws s3 rm = %s", level)
+	}
+	if level := commandRisk("aws", []string{"s3", "ls"}); level != RiskLow {
+		t.Fatalf("aws s3 ls = %s", level)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("- command: helm\n  level: nope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadRiskRules(bad); err == nil || !strings.Contains(err.Error(), "bad.yaml") {
+		t.Fatalf("bad rules error = %v", err)
+	}
+}
+
+func TestRouteReasonNamesRiskRule(t *testing.T) {
+	assessment := assessRisk("git", []string{"push"})
+	if assessment.Rule != "git-write" || !strings.Contains(assessment.describe("matched"), "risk rule git-write") {
+		t.Fatalf("assessment = %+v", assessment)
+	}
+	if !strings.Contains(assessment.Reasons[0], "by rule git-write") {
+		t.Fatalf("reasons = %q", assessment.Reasons)
+	}
+}
+
+func TestRiskRulesAreSafeForConcurrentUse(t *testing.T) {
+	withRiskRules(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			commandRisk("helm", []string{"install", "x"})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := RegisterRiskRule(RiskRule{Command: "helm", Subcommand: []string{"install"}, Level: RiskHigh}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if level := commandRisk("helm", []string{"install", "x"}); level != RiskHigh {
+		t.Fatalf("helm install = %s", level)
+	}
+}
@@ -42,27 +42,71 @@ type RouteResult struct {
 	Risk             RiskLevel `json:"risk,omitempty"`
 	RequiresApproval bool      `json:"requires_approval,omitempty"`
 	Reason           string    `json:"reason,omitempty"`
+	RiskReasons      []string  `json:"risk_reasons,omitempty"`
 	ValidationErrors []string  `json:"validation_errors,omitempty"`
+
+	// Suggestions lists registered gosh commands and executables on PATH
+	// that resemble an unknown command, best first.
+	Suggestions []string `json:"suggestions,omitempty"`
+
+	// CorrectedFrom is the command as typed when Policy.AutoCorrect routed
+	// the line to a suggestion instead; Command holds the correction.
+	CorrectedFrom string `json:"corrected_from,omitempty"`
+
+	// MatchedTerms lists the words of a natural-language input that matched
+	// the tool it was routed to, with Command and Args filled from the input.
+	// Candidates holds the tools such an input matched, best first, when none
+	// was confident enough to route to.
+	MatchedTerms []string      `json:"matched_terms,omitempty"`
+	Candidates   []RouteResult `json:"candidates,omitempty"`
 }
 
 // Policy controls which external commands are considered routable.
 type Policy struct {
-	AllowExternal bool
+	AllowExternal bool `json:"allow_external"`
 
 	// AllowedExternal and DeniedExternal are compared to the executable base
 	// name, case-insensitively. When AllowedExternal is non-empty, only those
 	// commands are allowed.
-	AllowedExternal []string
-	DeniedExternal  []string
+	AllowedExternal []string `json:"allowed_external,omitempty"`
+	DeniedExternal  []string `json:"denied_external,omitempty"`
 
 	// RejectHighRiskExternal rejects high-risk external commands instead of
 	// routing them. Gosh commands are still classified with risk, but are not
 	// blocked by this policy because callers may attach their own approval flow.
-	RejectHighRiskExternal bool
+	RejectHighRiskExternal bool `json:"reject_high_risk_external"`
 
 	// MaxExternalRisk rejects external commands above the provided risk level.
 	// Leave it empty to allow any risk level that is not otherwise rejected.
-	MaxExternalRisk RiskLevel
+	MaxExternalRisk RiskLevel `json:"max_external_risk,omitempty"`
+
+	// MaxCallRisk rejects registered gosh commands above the provided risk
+	// level. Leave it empty to allow gosh commands of any risk.
+	MaxCallRisk RiskLevel `json:"max_call_risk,omitempty"`
+
+	// Rules allow or deny command lines by command and argument patterns,
+	// for registered gosh commands and external commands alike. They are
+	// evaluated in order and the first match decides; an allow rule admits
+	// external commands missing from AllowedExternal, but risk limits still
+	// apply. Lines no rule matches fall back to the settings above.
+	Rules []PolicyRule `json:"rules,omitempty"`
+
+	// EnvAllow, EnvDeny and Limits restrict the environment and resources of
+	// external commands run under the policy, as in ScriptOptions.
+	EnvAllow []string `json:"env_allow,omitempty"`
+	EnvDeny  []string `json:"env_deny,omitempty"`
+	Limits   Limits   `json:"limits"`
+
+	// AutoCorrect routes an unknown command to the only known command one
+	// edit away, such as `gti` to `git`, when the command has at least four
+	// letters. The corrected line is classified under the same policy.
+	AutoCorrect bool `json:"auto_correct,omitempty"`
+
+	// MatchThreshold is the confidence at which input that names no command,
+	// such as "deploy to staging with 3 replicas", is routed to the exported
+	// tool it matches by name, description and parameters. Zero uses 0.8;
+	// above 1 never routes, and only lists the matches as Candidates.
+	MatchThreshold float64 `json:"match_threshold,omitempty"`
 }
 
 // DefaultPolicy preserves Gosh's historical behavior: registered commands and
@@ -79,6 +123,24 @@ func SafePolicy() Policy {
 		AllowedExternal:        []string{"cat", "git", "ls", "pwd", "rg", "wc"},
 		RejectHighRiskExternal: true,
 		MaxExternalRisk:        RiskLow,
+		EnvDeny:                append([]string(nil), SecretEnvPatterns...),
+	}
+}
+
+// ReadOnlyPolicy routes only commands that inspect files and repositories:
+// low-risk external commands from a fixed list and low-risk gosh commands,
+// without the builtins that create or delete files.
+func ReadOnlyPolicy() Policy {
+	return Policy{
+		AllowExternal:          false,
+		AllowedExternal:        []string{"cat", "df", "diff", "du", "file", "find", "git", "grep", "head", "ls", "pwd", "rg", "stat", "tail", "tree", "wc", "which"},
+		RejectHighRiskExternal: true,
+		MaxExternalRisk:        RiskLow,
+		MaxCallRisk:            RiskLow,
+		EnvDeny:                append([]string(nil), SecretEnvPatterns...),
+		Rules: []PolicyRule{
+			{Action: PolicyDeny, Command: "mkdir|rm|rmdir", Reason: "the readonly policy does not change files"},
+		},
 	}
 }
 
@@ -129,8 +191,20 @@ func ResolveWithPolicy(input string, policy Policy) RouteResult {
 		}
 	}
 
-	command := args[0]
-	rest := args[1:]
+	result := classifyCommand(input, args[0], args[1:], policy)
+	if result.Kind == RouteNeedsAI || (result.Kind == RouteRejected && len(result.ValidationErrors) > 0) {
+		result = withToolMatches(input, result, policy)
+	}
+	return result
+}
+
+// classifyCommand classifies an already split command line.
+func classifyCommand(input string, command string, rest []string, policy Policy) RouteResult {
+	verdict := policy.evaluateRules(command, rest)
+	if verdict.Action == PolicyDeny {
+		return deniedByRule(input, command, rest, verdict)
+	}
+
 	if call, ok := Calls[strings.ToLower(command)]; ok {
 		validation := validateCallArgs(call, rest)
 		if !validation.Valid {
@@ -147,6 +221,19 @@ func ResolveWithPolicy(input string, policy Policy) RouteResult {
 				ValidationErrors: validation.Errors,
 			}
 		}
+		if policy.MaxCallRisk != "" && riskRank(call.Tool.Risk) > riskRank(policy.MaxCallRisk) {
+			return RouteResult{
+				Kind:             RouteRejected,
+				Input:            input,
+				Command:          call.Name,
+				Args:             rest,
+				Confidence:       1,
+				Valid:            false,
+				Risk:             call.Tool.Risk,
+				RequiresApproval: call.Tool.RequiresApproval,
+				Reason:           fmt.Sprintf("gosh command risk %s exceeds policy max %s", call.Tool.Risk, policy.MaxCallRisk),
+			}
+		}
 		return RouteResult{
 			Kind:             RouteGoshCommand,
 			Input:            input,
@@ -162,68 +249,94 @@ func ResolveWithPolicy(input string, policy Policy) RouteResult {
 
 	executable, err := exec.LookPath(command)
 	if err == nil {
-		risk := commandRisk(filepath.Base(command), rest)
-		if !policy.externalAllowed(command) {
+		assessment := assessRisk(command, rest)
+		risk := assessment.Level
+		if verdict.Action != PolicyAllow && !policy.externalAllowed(command) {
 			return RouteResult{
-				Kind:       RouteRejected,
-				Input:      input,
-				Command:    command,
-				Args:       rest,
-				Executable: executable,
-				Confidence: 1,
-				Valid:      false,
-				Risk:       risk,
-				Reason:     "external command is not allowed by policy",
+				Kind:        RouteRejected,
+				Input:       input,
+				Command:     command,
+				Args:        rest,
+				Executable:  executable,
+				Confidence:  1,
+				Valid:       false,
+				Risk:        risk,
+				RiskReasons: assessment.Reasons,
+				Reason:      "external command is not allowed by policy",
 			}
 		}
 		if policy.RejectHighRiskExternal && risk == RiskHigh {
 			return RouteResult{
-				Kind:       RouteRejected,
-				Input:      input,
-				Command:    command,
-				Args:       rest,
-				Executable: executable,
-				Confidence: 1,
-				Valid:      false,
-				Risk:       risk,
-				Reason:     "high-risk external command rejected by policy",
+				Kind:        RouteRejected,
+				Input:       input,
+				Command:     command,
+				Args:        rest,
+				Executable:  executable,
+				Confidence:  1,
+				Valid:       false,
+				Risk:        risk,
+				RiskReasons: assessment.Reasons,
+				Reason:      assessment.describe("high-risk external command rejected by policy"),
 			}
 		}
 		if policy.MaxExternalRisk != "" && riskRank(risk) > riskRank(policy.MaxExternalRisk) {
 			return RouteResult{
-				Kind:       RouteRejected,
-				Input:      input,
-				Command:    command,
-				Args:       rest,
-				Executable: executable,
-				Confidence: 1,
-				Valid:      false,
-				Risk:       risk,
-				Reason:     fmt.Sprintf("external command risk %s exceeds policy max %s", risk, policy.MaxExternalRisk),
+				Kind:        RouteRejected,
+				Input:       input,
+				Command:     command,
+				Args:        rest,
+				Executable:  executable,
+				Confidence:  1,
+				Valid:       false,
+				Risk:        risk,
+				RiskReasons: assessment.Reasons,
+				Reason:      assessment.describe(fmt.Sprintf("external command risk %s exceeds policy max %s", risk, policy.MaxExternalRisk)),
 			}
 		}
 		return RouteResult{
-			Kind:       RouteExternalCLI,
-			Input:      input,
-			Command:    command,
-			Args:       rest,
-			Executable: executable,
-			Confidence: 1,
-			Valid:      true,
-			Risk:       risk,
-			Reason:     "matched executable on PATH",
+			Kind:        RouteExternalCLI,
+			Input:       input,
+			Command:     command,
+			Args:        rest,
+			Executable:  executable,
+			Confidence:  1,
+			Valid:       true,
+			Risk:        risk,
+			RiskReasons: assessment.Reasons,
+			Reason:      assessment.describe("matched executable on PATH"),
 		}
 	}
 
-	return RouteResult{
-		Kind:       RouteNeedsAI,
-		Input:      input,
-		Command:    command,
-		Args:       rest,
-		Confidence: 0.25,
-		Valid:      false,
-		Reason:     "no registered gosh command or executable matched",
+	return unknownCommand(input, command, rest, policy)
+}
+
+// unknownCommand classifies a command that is neither registered nor on
+// PATH. Its confidence drops as the closest suggestion gets closer, since a
+// likely typo is not really a request for the AI backend.
+func unknownCommand(input string, command string, rest []string, policy Policy) RouteResult {
+	suggestions := suggestCommands(command)
+	if correction, ok := autoCorrection(command, suggestions); ok && policy.AutoCorrect {
+		result := classifyCommand(correctedInput(input, command, correction), correction, rest, policy)
+		result.Input = input
+		result.CorrectedFrom = command
+		result.Confidence = suggestions[0].score
+		result.Reason = fmt.Sprintf("corrected %s to %s; %s", command, correction, result.Reason)
+		return result
 	}
+	result := RouteResult{
+		Kind:        RouteNeedsAI,
+		Input:       input,
+		Command:     command,
+		Args:        rest,
+		Confidence:  0.25,
+		Valid:       false,
+		Reason:      "no registered gosh command or executable matched",
+		Suggestions: suggestionNames(suggestions),
+	}
+	if len(suggestions) > 0 && 1-suggestions[0].score < result.Confidence {
+		result.Confidence = 1 - suggestions[0].score
+	}
+	return result
 }
 
 // AIBackend handles inputs that cannot be routed deterministically.
@@ -231,6 +344,14 @@ type AIBackend interface {
 	Run(ctx context.Context, input string) error
 }
 
+// RoutedBackend is an AIBackend that is also told how the input was routed,
+// including its suggestions and candidate tools. RouteWithOptions calls
+// RunRouted instead of Run when a backend implements it.
+type RoutedBackend interface {
+	AIBackend
+	RunRouted(ctx context.Context, result RouteResult) error
+}
+
 // RouteOptions configures RouteWithOptions.
 type RouteOptions struct {
 	Policy    Policy
@@ -238,6 +359,22 @@ type RouteOptions struct {
 	Backend   AIBackend
 	Stdout    io.Writer
 	Stderr    io.Writer
+
+	// Approver is asked before routed commands that require approval or
+	// have high risk run, as in ScriptOptions.
+	Approver Approver
+
+	// Workspace and Sandbox confine routed commands as in ScriptOptions.
+	Workspace string
+	Sandbox   bool
+
+	// OnSession receives the record of each input handed to the AI backend,
+	// and HistoryDir, when set, is where the record is saved. See AISession.
+	OnSession  func(AISession)
+	HistoryDir string
+
+	// Journal, when set, records the input as a CLI run.
+	Journal *Journal
 }
 
 // Route routes one input line. Deterministic commands run directly; unmatched
@@ -251,26 +388,93 @@ func RouteWithOptions(ctx context.Context, input string, options RouteOptions) e
 	if !options.PolicySet && policyIsZero(options.Policy) {
 		options.Policy = DefaultPolicy()
 	}
+	// The scripts and AI backend a route starts share one secret set.
+	ctx, secrets := withSecrets(scriptContext(ctx))
 	result := ResolveWithPolicy(input, options.Policy)
+	if options.Journal == nil {
+		return maskError(routeResult(ctx, input, result, options), secrets)
+	}
+	entry := JournalEntry{Input: result.Input, Route: result, Caller: CallerCLI}
+	onSession := options.OnSession
+	options.OnSession = func(session AISession) {
+		entry.Session = session.ID
+		if onSession != nil {
+			onSession(session)
+		}
+	}
+	return maskError(options.Journal.run(ctx, &entry, func(ctx context.Context) error {
+		return routeResult(ctx, input, result, options)
+	}), secrets)
+}
+
+// routedInput returns the line to run for a resolved input: the corrected
+// command, or the tool call a natural-language input matched.
+func routedInput(input string, result RouteResult) string {
+	if result.CorrectedFrom != "" {
+		input = correctedInput(input, result.CorrectedFrom, result.Command)
+	}
+	if result.MatchedTerms != nil {
+		input = commandLine(result.Command, result.Args)
+	}
+	return input
+}
+
+// routeResult runs, hands to the AI backend or rejects a resolved input.
+func routeResult(ctx context.Context, input string, result RouteResult, options RouteOptions) error {
 	switch result.Kind {
 	case RouteGoshCommand, RouteExternalCLI:
-		return runEContext(ctx, input)
+		return runEContext(ctx, routedInput(input, result), ScriptOptions{
+			Policy:    &options.Policy,
+			Approver:  options.Approver,
+			Workspace: options.Workspace,
+			Sandbox:   options.Sandbox,
+		})
 	case RouteNeedsAI:
 		backend := options.Backend
 		if backend == nil {
-			codex := DefaultCodexBackend()
-			codex.Stdout = defaultWriter(options.Stdout, os.Stdout)
-			codex.Stderr = defaultWriter(options.Stderr, os.Stderr)
-			backend = codex
+			backend = defaultAIBackend(options)
+		}
+		err := runAIBackend(ctx, backend, result, options)
+		switch {
+		case err != nil && len(result.Suggestions) > 0:
+			return fmt.Errorf("%w (%s is not a known command; %s)", err, result.Command, didYouMean(result.Suggestions))
+		case err != nil && len(result.Candidates) > 0:
+			return fmt.Errorf("%w (%s)", err, describeCandidates(result.Candidates))
 		}
-		return backend.Run(ctx, input)
+		return err
 	case RouteRejected:
+		if len(result.Candidates) > 0 {
+			return fmt.Errorf("input rejected: %s (%s)", result.Reason, describeCandidates(result.Candidates))
+		}
 		return fmt.Errorf("input rejected: %s", result.Reason)
 	default:
 		return fmt.Errorf("unknown route kind: %s", result.Kind)
 	}
 }
 
+func deniedByRule(input string, command string, rest []string, verdict policyVerdict) RouteResult {
+	result := RouteResult{
+		Kind:       RouteRejected,
+		Input:      input,
+		Command:    command,
+		Args:       rest,
+		Confidence: 1,
+		Valid:      false,
+		Reason:     verdict.reason(),
+	}
+	if call, ok := Calls[strings.ToLower(command)]; ok {
+		result.Command = call.Name
+		result.Risk = call.Tool.Risk
+		result.RequiresApproval = call.Tool.RequiresApproval
+	} else if executable, err := exec.LookPath(command); err == nil {
+		assessment := assessRisk(command, rest)
+		result.Executable = executable
+		result.Risk = assessment.Level
+		result.RiskReasons = assessment.Reasons
+	}
+	return result
+}
+
 func (p Policy) externalAllowed(command string) bool {
 	name := strings.ToLower(filepath.Base(command))
 	for _, denied := range p.DeniedExternal {
@@ -294,122 +498,14 @@ func policyIsZero(policy Policy) bool {
 		len(policy.AllowedExternal) == 0 &&
 		len(policy.DeniedExternal) == 0 &&
 		!policy.RejectHighRiskExternal &&
-		policy.MaxExternalRisk == ""
-}
-
-func commandRisk(command string, args []string) RiskLevel {
-	name := strings.ToLower(filepath.Base(command))
-
-	for _, arg := range args {
-		arg = strings.ToLower(arg)
-		if arg == "-rf" || arg == "-fr" || strings.Contains(arg, "--force") {
-			return RiskHigh
-		}
-	}
-
-	switch name {
-	case "rm", "rmdir", "mkfs", "shutdown", "reboot":
-		return RiskHigh
-	case "curl", "wget", "ssh", "scp", "rsync", "docker", "kubectl", "terraform":
-		return RiskMedium
-	case "find":
-		return findRisk(args)
-	case "sed":
-		return sedRisk(args)
-	case "git":
-		return gitRisk(args)
-	case "go":
-		return goRisk(args)
-	case "npm", "yarn", "pnpm", "make":
-		return buildToolRisk(args)
-	default:
-		return RiskLow
-	}
-}
-
-func gitRisk(args []string) RiskLevel {
-	if len(args) == 0 {
-		return RiskLow
-	}
-	switch strings.ToLower(args[0]) {
-	case "status", "diff", "log", "show", "rev-parse":
-		return RiskLow
-	case "branch":
-		return gitBranchRisk(args[1:])
-	case "push", "commit", "merge", "rebase", "checkout", "switch", "reset", "clean", "apply", "am", "stash", "cherry-pick", "revert":
-		return RiskHigh
-	default:
-		return RiskMedium
-	}
-}
-
-func gitBranchRisk(args []string) RiskLevel {
-	if len(args) == 0 {
-		return RiskLow
-	}
-	for _, arg := range args {
-		switch strings.ToLower(arg) {
-		case "-d", "-D", "--delete", "-m", "-M", "--move", "-c", "-C", "--copy", "--set-upstream-to", "--unset-upstream":
-			return RiskHigh
-		}
-	}
-	for _, arg := range args {
-		if !strings.HasPrefix(arg, "-") {
-			return RiskMedium
-		}
-	}
-	return RiskLow
-}
-
-func findRisk(args []string) RiskLevel {
-	for _, arg := range args {
-		switch strings.ToLower(arg) {
-		case "-delete", "-exec", "-execdir", "-ok", "-okdir":
-			return RiskHigh
-		}
-	}
-	return RiskLow
-}
-
-func sedRisk(args []string) RiskLevel {
-	for _, arg := range args {
-		lower := strings.ToLower(arg)
-		if lower == "-i" || strings.HasPrefix(lower, "-i") || lower == "--in-place" || strings.HasPrefix(lower, "--in-place=") {
-			return RiskHigh
-		}
-	}
-	return RiskLow
-}
-
-func goRisk(args []string) RiskLevel {
-	if len(args) == 0 {
-		return RiskLow
-	}
-	switch strings.ToLower(args[0]) {
-	case "version", "env", "list":
-		return RiskLow
-	case "build", "run", "test", "generate", "install", "mod", "work":
-		return RiskHigh
-	default:
-		return RiskMedium
-	}
-}
-
-func buildToolRisk(args []string) RiskLevel {
-	if len(args) == 0 {
-		return RiskLow
-	}
-	first := strings.ToLower(args[0])
-	switch first {
-	case "version", "env", "list":
-		return RiskLow
-	case "test":
-		return RiskMedium
-	case "install", "add", "remove", "publish", "deploy":
-		return RiskHigh
-	default:
-		return RiskMedium
-	}
+		policy.MaxExternalRisk == "" &&
+		policy.MaxCallRisk == "" &&
+		len(policy.Rules) == 0 &&
+		len(policy.EnvAllow) == 0 &&
+		len(policy.EnvDeny) == 0 &&
+		policy.Limits == Limits{} &&
+		!policy.AutoCorrect &&
+		policy.MatchThreshold == 0
 }
 
 func riskRank(level RiskLevel) int {
@@ -424,7 +520,7 @@ func riskRank(level RiskLevel) int {
 }
 
 func writeRouteJSON(w io.Writer, result RouteResult) error {
-	return writeJSON(w, result)
+	return writeJSON(w, result.masked(nil))
 }
 
 func writeJSON(w io.Writer, value interface{}) error {
@@ -0,0 +1,139 @@
+//go:build linux
+// +build linux
+
+package gosh
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock syscalls and constants from linux/landlock.h.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+	prSetNoNewPrivs              = 38
+
+	landlockWriteFile  = 1 << 1
+	landlockRemoveDir  = 1 << 4
+	landlockRemoveFile = 1 << 5
+	landlockMakeChar   = 1 << 6
+	landlockMakeDir    = 1 << 7
+	landlockMakeReg    = 1 << 8
+	landlockMakeSock   = 1 << 9
+	landlockMakeFifo   = 1 << 10
+	landlockMakeBlock  = 1 << 11
+	landlockMakeSym    = 1 << 12
+	landlockRefer      = 1 << 13
+	landlockTruncate   = 1 << 14
+
+	landlockFileAccess = landlockWriteFile | landlockTruncate
+)
+
+type landlockRulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// landlockPathBeneathAttr is packed in C; the kernel reads its first 12 bytes.
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFD      int32
+}
+
+func landlockABI() int {
+	version, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0
+	}
+	return int(version)
+}
+
+// startSandboxed calls start so that the command it starts, and everything
+// that command runs, can only write beneath the writable paths. Reading and
+// executing stay unrestricted.
+//
+// Landlock restricts the calling thread, and children inherit the
+// restriction of the thread that forks them, so start is called from a
+// dedicated locked thread. That thread is never unlocked, so the Go runtime
+// discards it when the goroutine returns instead of reusing it.
+func startSandboxed(start func() error, writable []string) error {
+	abi := landlockABI()
+	if abi < 1 {
+		return ErrSandboxUnsupported
+	}
+	handled := uint64(landlockWriteFile | landlockRemoveDir | landlockRemoveFile | landlockMakeChar |
+		landlockMakeDir | landlockMakeReg | landlockMakeSock | landlockMakeFifo | landlockMakeBlock | landlockMakeSym)
+	if abi >= 2 {
+		handled |= landlockRefer
+	}
+	if abi >= 3 {
+		handled |= landlockTruncate
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := restrictThread(handled, writable); err != nil {
+			done <- err
+			return
+		}
+		done <- start()
+	}()
+	return <-done
+}
+
+func restrictThread(handled uint64, writable []string) error {
+	attr := landlockRulesetAttr{handledAccessFS: handled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: create ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	for _, path := range writable {
+		if err := addLandlockPath(int(fd), path, handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: set no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: restrict self: %w", errno)
+	}
+	return nil
+}
+
+func addLandlockPath(ruleset int, path string, handled uint64) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("landlock: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("landlock: %w", err)
+	}
+
+	access := handled
+	if !info.IsDir() {
+		access &= landlockFileAccess
+	}
+	rule := landlockPathBeneathAttr{allowedAccess: access, parentFD: int32(f.Fd())}
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: allow %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package gosh
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandboxConfinesWritesToWorkspace(t *testing.T) {
+	if landlockABI() < 1 {
+		t.Skip("landlock is not available")
+	}
+	if _, err := exec.LookPath("touch"); err != nil {
+		t.Skip("touch is not on PATH")
+	}
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	options := ScriptOptions{Workspace: workspace, Sandbox: true}
+
+	inside := filepath.Join(workspace, "inside.txt")
+	if err := RunWithOptions(context.Background(), "touch "+inside, options); err != nil {
+		t.Fatalf("write inside workspace: %v", err)
+	}
+	if _, err := os.Stat(inside); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := filepath.Join(outside, "outside.txt")
+	if err := RunWithOptions(context.Background(), "touch "+blocked, options); err == nil {
+		t.Fatalf("write outside workspace succeeded")
+	}
+	if _, err := os.Stat(blocked); !os.IsNotExist(err) {
+		t.Fatalf("outside file exists: %v", err)
+	}
+
+	// The restriction stays with the child; this process can still write.
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatalf("parent lost write access: %v", err)
+	}
+}
+
+func TestSandboxRequiresWorkspace(t *testing.T) {
+	err := RunWithOptions(context.Background(), "true", ScriptOptions{Sandbox: true})
+	if err == nil {
+		t.Fatalf("sandbox without workspace succeeded")
+	}
+}
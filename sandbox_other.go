@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package gosh
+
+func startSandboxed(start func() error, writable []string) error {
+	return ErrSandboxUnsupported
+}
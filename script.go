@@ -2,10 +2,12 @@ package gosh
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"runtime"
 	"strings"
 )
 
@@ -22,35 +24,145 @@ type Script struct {
 	env      map[string]string
 	ctx      context.Context
 	firstErr error
+	options  ScriptOptions
+	funcs    map[string]*scriptFunc
+	args     []string // $0, $1, ... inside functions and sourced files
+	file     string   // script file being sourced, for error messages
+	depth    int
+	check    *scriptCheck  // collects diagnostics while Check walks the script
+	stderr   io.Writer     // stderr of external commands; os.Stderr when nil
+	output   *outputDigest // digest of the journaled run in progress, if any
+	secrets  *secretSet    // secret values masked in the script's output
+}
+
+// ScriptOptions configures RunWithOptions.
+type ScriptOptions struct {
+	// Glob expands unquoted `*`, `?`, `[...]` and `**` arguments against the
+	// script's current directory. Scripts can also enable it with
+	// `shopt -s glob`.
+	Glob bool
+
+	// NullGlob removes patterns that match nothing instead of passing them
+	// on literally, like the shell's nullglob.
+	NullGlob bool
+
+	// Policy, when set, classifies every line after expansion, including
+	// lines of functions and sourced files, and rejects it with a
+	// *PolicyError before it runs. Scripts a Call starts inherit it: those
+	// started with Run or RunE on the Call's goroutine, and those started
+	// with its script's Context, such as gosh.RunWithOptions(s.Context(), ...).
+	Policy *Policy
+
+	// Approver, when set, is asked before each line that requires approval
+	// or has high risk; a line it declines fails with an *ApprovalError.
+	// Without one, such lines run as before. Scripts a Call starts inherit
+	// it like Policy.
+	Approver Approver
+
+	// Workspace, when set, confines the paths given to the cd, pushd, mkDir,
+	// rm, rmDir and source builtins to this directory tree, after following
+	// symlinks. Paths that leave it are rejected with a *WorkspaceError.
+	// Scripts start in the working directory if it is inside the workspace,
+	// and in the workspace otherwise.
+	Workspace string
+
+	// Sandbox restricts external commands so they can only write inside
+	// Workspace and Writable. It uses Landlock and needs Linux 5.13 or later;
+	// elsewhere commands fail with ErrSandboxUnsupported rather than run
+	// unrestricted.
+	Sandbox bool
+
+	// Writable lists extra paths sandboxed commands may write, such as a
+	// temporary or cache directory.
+	Writable []string
+
+	// EnvAllow and EnvDeny filter the environment of external commands by
+	// case-insensitive glob patterns on variable names, such as `*_TOKEN`
+	// or `AWS_*`. With EnvAllow, only matching variables are passed; EnvDeny
+	// always wins. The policy's filters apply as well.
+	EnvAllow []string
+	EnvDeny  []string
+
+	// Limits bounds each external command's resources. Where both the
+	// script and its policy set a limit, the smaller one applies.
+	Limits Limits
+
+	// DryRun walks the script without running it: variables are expanded,
+	// cd, pushd, set and source are tracked, and every other line is routed
+	// and reported as a PlanStep. External programs and Go calls do not run
+	// unless the tool registered a DryRun hook. Steps go to OnPlan, or are
+	// printed to stdout with WritePlan's format when OnPlan is nil.
+	DryRun bool
+	OnPlan func(PlanStep)
+
+	// Journal, when set, records every command line the script runs, after
+	// expansion, as a script run.
+	Journal *Journal
+
+	// Secrets sets script variables whose values are masked in gosh's
+	// output, as Script.Secret does.
+	Secrets map[string]string
 }
 
 // Run creates a new execution script context.
 func Run(cmdScript string) {
-	if err := runEContext(context.Background(), cmdScript); err != nil {
+	if err := runEContext(context.Background(), cmdScript, ScriptOptions{}); err != nil {
 		defaultErr(err)
 	}
 }
 
 // RunE creates a new execution script context and returns the first error.
 func RunE(cmdScript string) error {
-	return runEContext(context.Background(), cmdScript)
+	return runEContext(context.Background(), cmdScript, ScriptOptions{})
+}
+
+// RunWithOptions runs a script with explicit options and returns the first
+// error.
+func RunWithOptions(ctx context.Context, cmdScript string, options ScriptOptions) error {
+	return runEContext(ctx, cmdScript, options)
 }
 
-func runEContext(ctx context.Context, cmdScript string) error {
-	workingDir, _ := os.Getwd()
+func runEContext(ctx context.Context, cmdScript string, options ScriptOptions) error {
+	script := newScript(ctx, options)
+	script.cmds = strings.Split(strings.Trim(cmdScript, "\n"), "\n")
+	script.RunCmds()
+	return script.firstErr
+}
+
+// newScript creates a script context in the process working directory and
+// environment.
+func newScript(ctx context.Context, options ScriptOptions) *Script {
+	ctx, secrets := withSecrets(scriptContext(ctx))
+	guard := currentCallGuard()
+	if options.Policy == nil {
+		options.Policy = contextPolicy(ctx)
+	}
+	if options.Policy == nil {
+		options.Policy = guard.policy
+	}
+	if options.Approver == nil {
+		options.Approver = contextApprover(ctx)
+	}
+	if options.Approver == nil {
+		options.Approver = guard.approver
+	}
 	env := make(map[string]string, len(os.Environ()))
 	for _, pair := range os.Environ() {
 		i := strings.Index(pair, "=")
 		env[pair[0:i]] = pair[i+1:]
 	}
-	script := Script{
-		cmds: strings.Split(strings.Trim(cmdScript, "\n"), "\n"),
-		dirs: []string{workingDir},
-		env:  env,
-		ctx:  scriptContext(ctx),
+	script := &Script{
+		dirs:    []string{startDir(options)},
+		env:     env,
+		ctx:     ctx,
+		options: options,
+		output:  contextOutputDigest(ctx),
+		secrets: secrets,
 	}
-	script.RunCmds()
-	return script.firstErr
+	for name, value := range options.Secrets {
+		script.Secret(name, value)
+	}
+	return script
 }
 
 // Run executes all commands defined in a script.
@@ -61,46 +173,251 @@ func (s *Script) Run(cmdScript string) {
 
 // RunCmds executes all commands defined in a script.
 func (s *Script) RunCmds() {
-	for lineNum, cmd := range s.cmds {
-		cmd = strings.Trim(strings.ReplaceAll(cmd, "\t", " "), " ")
-		if cmd == "" || strings.HasPrefix(cmd, "//") || strings.HasPrefix(cmd, "#") {
-			continue
+	for _, line := range parseScriptLines(s.cmds) {
+		s.runLine(line)
+	}
+}
+
+func (s *Script) runLine(line scriptLine) {
+	lineNum, cmd := line.num, line.text
+	if s.check != nil {
+		defer s.check.at(s.file, lineNum)()
+	}
+	if line.err != nil {
+		s.reportErr(fmt.Errorf("error parsing script, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, line.err))
+		return
+	}
+	if line.def != nil {
+		s.define(line.def)
+		if s.check != nil {
+			s.checkFunc(line.def)
 		}
-		cmd = os.Expand(cmd, func(x string) string { return s.env[x] })
-
-		space := strings.Index(cmd, " ")
-		firstWord := cmd
-		otherWords := ""
-		if space != -1 {
-			firstWord = cmd[0:space]
-			otherWords = cmd[space+1:]
-		}
-
-		if f, ok := Calls[strings.ToLower(firstWord)]; ok {
-			args := []string{}
-			if f.Tool.Structured {
-				params, err := SplitArgs(cmd)
-				if err != nil {
-					s.reportErr(fmt.Errorf("error parsing args, line %d\n[%s]\n%w", lineNum, cmd, err))
-					continue
-				}
-				if len(params) > 1 {
-					args = params[1:]
-				}
+		return
+	}
+
+	stdin, err := s.heredoc(line)
+	if err != nil {
+		s.reportErr(fmt.Errorf("error expanding variables, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+		return
+	}
+
+	space := strings.Index(cmd, " ")
+	firstWord := cmd
+	otherWords := ""
+	if space != -1 {
+		firstWord = cmd[0:space]
+		otherWords = cmd[space+1:]
+	}
+	firstWord, err = s.expander().expandRaw(firstWord)
+	if err != nil {
+		s.reportErr(fmt.Errorf("error expanding variables, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+		return
+	}
+
+	if def, ok := s.funcs[strings.ToLower(firstWord)]; ok {
+		params, err := s.expandArgs(cmd)
+		if err != nil {
+			s.reportErr(fmt.Errorf("error parsing args, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+			return
+		}
+		args := params[1:]
+		if stdin != nil {
+			args = append(args, *stdin)
+		}
+		if err := s.callFunc(def, args); err != nil {
+			s.reportErr(fmt.Errorf("error in script func, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+		}
+		return
+	}
+
+	if f, ok := Calls[strings.ToLower(firstWord)]; ok {
+		args := []string{}
+		if f.Tool.Structured {
+			params, err := s.expandArgs(cmd)
+			if err != nil {
+				s.reportErr(fmt.Errorf("error parsing args, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+				return
 			}
-			if err := invokeCall(s, f, otherWords, args); err != nil {
-				s.reportErr(fmt.Errorf("error in Go code, line %d\n[%s]\n%w", lineNum, cmd, err))
-				continue
+			if len(params) > 1 {
+				args = params[1:]
 			}
+			if stdin != nil {
+				args = append(args, *stdin)
+			}
+			// Secret arguments are masked from here on, so a line that is
+			// planned, rejected or invalid does not show them either.
+			s.secrets.addArgs(f.Tool, args)
 		} else {
-			// run executable program
-			err := s.Exec(cmd)
+			otherWords, err = s.expander().expandRaw(otherWords)
 			if err != nil {
-				s.reportErr(fmt.Errorf("error executing program, line %d\n[%s]\n%w", lineNum, cmd, err))
-				continue
+				s.reportErr(fmt.Errorf("error expanding variables, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+				return
+			}
+			if stdin != nil {
+				otherWords = joinHeredoc(otherWords, *stdin)
+			}
+		}
+		argv := append([]string{firstWord}, args...)
+		if !f.Tool.Structured {
+			argv = legacyArgv(firstWord, otherWords)
+		}
+		if s.options.DryRun {
+			if !s.planLine(lineNum, cmd, argv, &f) {
+				return
+			}
+		} else if err := s.guard(lineNum, cmd, argv); err != nil {
+			s.reportErr(err)
+			return
+		}
+		err := s.journal(argv, func() error {
+			return invokeCall(s, f, otherWords, args)
+		})
+		if err != nil {
+			s.reportErr(fmt.Errorf("error in Go code, %s\n[%s]\n%w", s.lineRef(lineNum), s.secrets.mask(cmd), err))
+		}
+		return
+	}
+
+	// run executable program
+	params, err := s.expandArgs(cmd)
+	if err == nil && s.options.DryRun {
+		if len(params) > 0 {
+			s.planLine(lineNum, cmd, params, nil)
+		}
+		return
+	}
+	if err == nil {
+		if err := s.guard(lineNum, cmd, params); err != nil {
+			s.reportErr(err)
+			return
+		}
+		var in io.Reader
+		if stdin != nil {
+			in = strings.NewReader(*stdin)
+		}
+		err = s.journal(params, func() error { return s.execArgs(params, in) })
+		if errors.Is(err, exec.ErrNotFound) {
+			if hint := didYouMean(suggestionNames(suggestCommands(params[0]))); hint != "" {
+				err = fmt.Errorf("%w; %s", err, hint)
 			}
 		}
 	}
+	if err != nil {
+		s.reportErr(fmt.Errorf("error executing program, %s\n[%s]\n%w", s.lineRef(lineNum), cmd, err))
+	}
+}
+
+// journal runs fn as one journaled run of argv when the script has a
+// journal. Builtins that only change the script's state, like cd and set,
+// are not journaled, and neither are dry runs, whose DryRun hooks a later
+// rerun must not replay as the real tool.
+func (s *Script) journal(argv []string, fn func() error) error {
+	if s.options.Journal == nil || s.options.DryRun || plannedBuiltins[strings.ToLower(argv[0])] {
+		return fn()
+	}
+	input := commandLine(argv[0], argv[1:])
+	entry := JournalEntry{Input: input, Route: s.classify(input, argv), Caller: CallerScript, Dir: s.dirs[0]}
+	return s.options.Journal.run(s.ctx, &entry, func(ctx context.Context) error {
+		outer := s.output
+		s.output = contextOutputDigest(ctx)
+		defer func() { s.output = outer }()
+		return fn()
+	})
+}
+
+// heredoc returns the expanded heredoc body for a line, or nil if it has none.
+func (s *Script) heredoc(line scriptLine) (*string, error) {
+	if line.heredoc == nil || line.literal {
+		return line.heredoc, nil
+	}
+	body, err := s.expander().expandHeredoc(*line.heredoc)
+	if err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// joinHeredoc appends a heredoc body to a legacy command's raw input.
+func joinHeredoc(rawArgs, body string) string {
+	if strings.TrimSpace(rawArgs) == "" {
+		return body
+	}
+	return rawArgs + "\n" + body
+}
+
+// expandArgs tokenizes a line and then expands variables in each token, so
+// values containing spaces are never re-split. When globbing is enabled,
+// unquoted patterns in arguments after the first are expanded too.
+func (s *Script) expandArgs(line string) ([]string, error) {
+	words, err := lexWords(line)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(words))
+	for i, w := range words {
+		expanded, err := buildWord(w, s.expander().expand)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || !s.options.Glob {
+			args = append(args, expanded.value)
+			continue
+		}
+		matches, err := globArgs(s.dirs[0], expanded, s.options.NullGlob)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, matches...)
+	}
+	return args, nil
+}
+
+// pathArgs returns the paths named by a builtin's raw input. Without
+// globbing the whole input is one path, as it always has been.
+func (s *Script) pathArgs(input string) ([]string, error) {
+	if !s.options.Glob {
+		return []string{input}, nil
+	}
+	words, err := lexWords(input)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, w := range words {
+		literal, err := buildWord(w, nil)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := globArgs(s.dirs[0], literal, s.options.NullGlob)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+func (s *Script) expander() expander {
+	return expander{
+		args: s.args,
+		lookup: func(name string) (string, bool) {
+			value, ok := s.env[name]
+			return value, ok
+		},
+		assign: func(name, value string) {
+			if s.env == nil {
+				s.env = map[string]string{}
+			}
+			s.env[name] = value
+		},
+		unset: s.unsetVariable,
+	}
+}
+
+// Context returns the script's context. Scripts started with it inherit
+// the script's policy and Approver, and mask its secrets.
+func (s *Script) Context() context.Context {
+	return withApprover(withPolicy(scriptContext(s.ctx), s.options.Policy), s.options.Approver)
 }
 
 // Exec runs a program on the operating system.
@@ -109,6 +426,10 @@ func (s *Script) Exec(input string) error {
 	if err != nil {
 		return err
 	}
+	return s.execArgs(params, nil)
+}
+
+func (s *Script) execArgs(params []string, stdin io.Reader) error {
 	if len(params) == 0 {
 		return nil
 	}
@@ -117,14 +438,66 @@ func (s *Script) Exec(input string) error {
 	if len(params) > 1 {
 		args = params[1:]
 	}
+	limits := s.limits()
+	if limits.rlimited() && !rlimitsSupported {
+		return ErrLimitsUnsupported
+	}
 	c := exec.CommandContext(scriptContext(s.ctx), cmd, args...)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
+	c.Stdout = s.output.tee(os.Stdout)
+	c.Stderr = defaultWriter(s.stderr, os.Stderr)
+	c.Stdin = stdin
 	c.Dir = s.dirs[0]
-	for k, v := range s.env {
-		c.Env = append(c.Env, k+"="+v)
+	c.Env = s.childEnv()
+	var output *outputLimit
+	if limits.OutputBytes > 0 {
+		// Programs the command starts share its output, so the whole
+		// process group is stopped.
+		setProcessGroup(c)
+		output = &outputLimit{remaining: limits.OutputBytes, stop: func() { killProcessGroup(c) }}
+		c.Stdout = output.writer(c.Stdout)
+		c.Stderr = output.writer(c.Stderr)
+	}
+
+	if err := s.startCommand(c, limits); err != nil {
+		if c.Process != nil && c.ProcessState == nil {
+			_ = c.Wait()
+		}
+		return err
+	}
+	err := c.Wait()
+	switch {
+	case output != nil && output.wasExceeded():
+		return &LimitError{Command: cmd, Limit: "output bytes", Value: limits.OutputBytes, Err: ErrOutputLimit}
+	case cpuLimitExceeded(c.ProcessState, limits):
+		return &LimitError{Command: cmd, Limit: "cpu seconds", Value: int64(limits.CPUSeconds), Err: ErrCPULimit}
+	}
+	return err
+}
+
+// startCommand starts an external command, sandboxed and with resource
+// limits if the script asks for them.
+func (s *Script) startCommand(c *exec.Cmd, limits Limits) error {
+	start := c.Start
+	if limits.rlimited() {
+		start = func() error { return startLimited(c, limits) }
+	}
+	if s.options.Sandbox {
+		writable, err := s.sandboxPaths()
+		if err != nil {
+			return err
+		}
+		return startSandboxed(start, writable)
+	}
+	if !limits.rlimited() {
+		return start()
 	}
-	return c.Run()
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		done <- start()
+	}()
+	return <-done
 }
 
 func scriptContext(ctx context.Context) context.Context {
@@ -138,6 +511,7 @@ func (s *Script) reportErr(err error) {
 	if err == nil {
 		return
 	}
+	err = maskError(err, s.secrets)
 	if s.firstErr == nil {
 		s.firstErr = err
 	}
@@ -149,7 +523,8 @@ func (s *Script) reportErr(err error) {
 // ///////////// Built in calls /////////
 
 var _ = Register((*Script).echo, (*Script).getwd, (*Script).cd, (*Script).mkDir,
-	(*Script).pushd, (*Script).popd, (*Script).rm, (*Script).rmDir, (*Script).set)
+	(*Script).pushd, (*Script).popd, (*Script).rm, (*Script).rmDir, (*Script).set,
+	(*Script).shopt, (*Script).source)
 
 // Echo writes to standard output.
 func (*Script) echo(text string) error {
@@ -164,19 +539,39 @@ func (s *Script) getwd() (dir string) {
 
 // Cd changes out of the current directory.
 func (s *Script) cd(dir string) error {
-	s.dirs[0] = filepath.Join(s.dirs[0], dir)
+	path, err := s.builtinPath(dir)
+	if err != nil {
+		return err
+	}
+	s.dirs[0] = path
 	return nil
 }
 
 // MkDir adds a directory to the file system.
-func (s *Script) mkDir(dir string) error {
-	dir = filepath.Join(s.dirs[0], dir)
-	return os.MkdirAll(dir, 0744)
+func (s *Script) mkDir(input string) error {
+	dirs, err := s.pathArgs(input)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		path, err := s.builtinPath(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path, 0744); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Pushd changes out of the current directory to the previous directory.
 func (s *Script) pushd(dir string) error {
-	s.dirs = append([]string{dir}, s.dirs...)
+	path, err := s.resolvePath(dir)
+	if err != nil {
+		return err
+	}
+	s.dirs = append([]string{path}, s.dirs...)
 	return nil
 }
 
@@ -189,15 +584,39 @@ func (s *Script) popd(_ string) error {
 }
 
 // Rm removes a file from the file system.
-func (s *Script) rm(file string) error {
-	file = filepath.Join(s.dirs[0], file)
-	return os.Remove(file)
+func (s *Script) rm(input string) error {
+	files, err := s.pathArgs(input)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path, err := s.builtinPath(file)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // RmDir removes a directory from the file system.
-func (s *Script) rmDir(dir string) error {
-	dir = filepath.Join(s.dirs[0], dir)
-	return os.RemoveAll(dir)
+func (s *Script) rmDir(input string) error {
+	dirs, err := s.pathArgs(input)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		path, err := s.builtinPath(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Set adds or removes a named string to the script's environment.
@@ -207,4 +626,24 @@ func (s *Script) set(pair string) error {
 	return nil
 }
 
+// Shopt turns script options on (-s) or off (-u).
+func (s *Script) shopt(input string) error {
+	fields := strings.Fields(input)
+	if len(fields) < 2 || (fields[0] != "-s" && fields[0] != "-u") {
+		return fmt.Errorf("usage: shopt -s|-u glob|nullglob")
+	}
+	on := fields[0] == "-s"
+	for _, name := range fields[1:] {
+		switch name {
+		case "glob":
+			s.options.Glob = on
+		case "nullglob":
+			s.options.NullGlob = on
+		default:
+			return fmt.Errorf("unknown shell option %q", name)
+		}
+	}
+	return nil
+}
+
 // ///////////// Built in calls /////////
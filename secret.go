@@ -0,0 +1,222 @@
+package gosh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretMask replaces secret values in gosh's output.
+const secretMask = "********"
+
+// minMaskedLength is the shortest secret value masked wherever it appears.
+// Shorter values are only masked where gosh knows they are secret, such as
+// the arguments of secret parameters, so output stays readable.
+const minMaskedLength = 4
+
+// secretSet holds the secret values seen by one script, with the scripts
+// started with its Context, or by one MCP session, longest first. A nil
+// *secretSet holds none.
+type secretSet struct {
+	sync.RWMutex
+	values []string
+}
+
+// secretsKey is the context key of the secret set scripts started with
+// that context share.
+type secretsKey struct{}
+
+// withSecrets returns ctx carrying a secret set, and the set: the one ctx
+// already carries, or a new one.
+func withSecrets(ctx context.Context) (context.Context, *secretSet) {
+	if secrets := contextSecrets(ctx); secrets != nil {
+		return ctx, secrets
+	}
+	secrets := &secretSet{}
+	return context.WithValue(ctx, secretsKey{}, secrets), secrets
+}
+
+// contextSecrets returns the secret set carried by ctx, if any.
+func contextSecrets(ctx context.Context) *secretSet {
+	secrets, _ := ctx.Value(secretsKey{}).(*secretSet)
+	return secrets
+}
+
+// Secret sets a script variable like `set`, and masks its value in gosh's
+// output for the rest of the script and the scripts started with its
+// Context.
+func (s *Script) Secret(name string, value string) {
+	if s.env == nil {
+		s.env = map[string]string{}
+	}
+	s.env[name] = value
+	s.secrets.add(value)
+}
+
+// add masks value in output masked with the set from now on.
+func (s *secretSet) add(value string) {
+	if s == nil || value == "" {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, known := range s.values {
+		if known == value {
+			return
+		}
+	}
+	s.values = append(s.values, value)
+	sort.Slice(s.values, func(i, j int) bool {
+		return len(s.values[i]) > len(s.values[j])
+	})
+}
+
+// addArgs adds the arguments a tool takes in secret parameters.
+func (s *secretSet) addArgs(tool ToolSpec, args []string) {
+	for _, arg := range secretArgs(tool.Params, args) {
+		s.add(arg)
+	}
+}
+
+// secretArgs returns the arguments passed to secret parameters.
+func secretArgs(params []ParamSpec, args []string) []string {
+	var values []string
+	for i, param := range params {
+		if param.Secret && i < len(args) && args[i] != "" {
+			values = append(values, args[i])
+		}
+	}
+	return values
+}
+
+// mask replaces the secret values in text.
+func (s *secretSet) mask(text string) string {
+	if s == nil {
+		return text
+	}
+	s.RLock()
+	defer s.RUnlock()
+	return maskValues(text, s.values)
+}
+
+// maskValues replaces values, longest first, in text.
+func maskValues(text string, values []string) string {
+	for _, value := range values {
+		if len(value) >= minMaskedLength {
+			text = strings.ReplaceAll(text, value, secretMask)
+		}
+	}
+	return text
+}
+
+// maskedError is an error whose message has its secrets masked. It unwraps
+// to the original error.
+type maskedError struct {
+	err     error
+	secrets *secretSet
+}
+
+func (e maskedError) Error() string {
+	return e.secrets.mask(e.err.Error())
+}
+
+func (e maskedError) Unwrap() error {
+	return e.err
+}
+
+// maskError masks the secrets in err's message. Errors already masked with
+// the same secrets are returned as they are.
+func maskError(err error, secrets *secretSet) error {
+	if err == nil {
+		return nil
+	}
+	var masked maskedError
+	if errors.As(err, &masked) && masked.secrets == secrets {
+		return err
+	}
+	return maskedError{err: err, secrets: secrets}
+}
+
+// routeParams returns the params of the tool a result routes to, if any.
+func routeParams(r RouteResult) []ParamSpec {
+	if call, ok := Calls[strings.ToLower(r.Command)]; ok {
+		return call.Tool.Params
+	}
+	return nil
+}
+
+// maskRoute returns a function masking the values in secrets, and the
+// secret arguments of r, in text about r. Secret arguments are masked even
+// if the command never ran.
+func maskRoute(r RouteResult, secrets *secretSet) func(string) string {
+	own := secretArgs(routeParams(r), r.Args)
+	sort.Slice(own, func(i, j int) bool { return len(own[i]) > len(own[j]) })
+	return func(text string) string {
+		return maskValues(secrets.mask(text), own)
+	}
+}
+
+// masked returns a copy of the result with secret arguments, and the
+// values of those and of secrets in its text, masked.
+func (r RouteResult) masked(secrets *secretSet) RouteResult {
+	params := routeParams(r)
+	mask := maskRoute(r, secrets)
+	if r.Args != nil {
+		args := make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			if i < len(params) && params[i].Secret && arg != "" {
+				args[i] = secretMask
+			} else {
+				args[i] = mask(arg)
+			}
+		}
+		r.Args = args
+	}
+	r.Input = mask(r.Input)
+	r.Reason = mask(r.Reason)
+	if r.ValidationErrors != nil {
+		errors := make([]string, len(r.ValidationErrors))
+		for i, message := range r.ValidationErrors {
+			errors[i] = mask(message)
+		}
+		r.ValidationErrors = errors
+	}
+	if r.Candidates != nil {
+		candidates := make([]RouteResult, len(r.Candidates))
+		for i, candidate := range r.Candidates {
+			candidates[i] = candidate.masked(secrets)
+		}
+		r.Candidates = candidates
+	}
+	return r
+}
+
+// masked returns a copy of the entry with its secrets masked.
+func (e JournalEntry) masked(secrets *secretSet) JournalEntry {
+	mask := maskRoute(e.Route, secrets)
+	e.Input = mask(e.Input)
+	e.Route = e.Route.masked(secrets)
+	e.Error = mask(e.Error)
+	return e
+}
+
+// masked returns a copy of the session with its secrets masked.
+func (s AISession) masked(secrets *secretSet) AISession {
+	s.Input = secrets.mask(s.Input)
+	s.Route = s.Route.masked(secrets)
+	s.Prompt = secrets.mask(s.Prompt)
+	s.Error = secrets.mask(s.Error)
+	s.Stdout = secrets.mask(s.Stdout)
+	s.Stderr = secrets.mask(s.Stderr)
+	if s.Events != nil {
+		events := make([]json.RawMessage, len(s.Events))
+		for i, event := range s.Events {
+			events[i] = json.RawMessage(secrets.mask(string(event)))
+		}
+		s.Events = events
+	}
+	return s
+}
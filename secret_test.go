@@ -0,0 +1,162 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var errGoshSecretTestDenied = errors.New("denied")
+
+var _ = Tool("GoshSecretTestLogin", func(user string, token string) error {
+	_, _ = os.Stdout.WriteString("logging in with " + token + "\n")
+	return fmt.Errorf("login %s with %s: %w", user, token, errGoshSecretTestDenied)
+},
+	Desc("Log in for secret tests"),
+	Param("user"),
+	Param("token", Secret()),
+)
+
+func TestSecretParamMetadata(t *testing.T) {
+	call := Calls[strings.ToLower("GoshSecretTestLogin")]
+	properties := call.Tool.inputSchema()["properties"].(map[string]interface{})
+	if properties["token"].(map[string]interface{})["writeOnly"] != true || properties["user"].(map[string]interface{})["writeOnly"] != nil {
+		t.Fatalf("properties = %+v", properties)
+	}
+	if !secretParam(call.Tool.Params[1]) {
+		t.Fatal("secret param is not redacted in audit events")
+	}
+
+	var usage bytes.Buffer
+	showUsageFromReflection(&usage)
+	if !strings.Contains(usage.String(), "GoshSecretTestLogin [user] [token (secret)]") {
+		t.Fatalf("usage = %q", usage.String())
+	}
+}
+
+func TestResolveMasksSecretArgs(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeRouteJSON(&out, ResolveWithPolicy("GoshSecretTestLogin ann resolve-secret-1", DefaultPolicy())); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "resolve-secret-1") || !strings.Contains(out.String(), `"`+secretMask+`"`) {
+		t.Fatalf("resolve JSON = %s", out.String())
+	}
+
+	// Short values are masked as arguments, though not in free text.
+	result := ResolveWithPolicy("GoshSecretTestLogin ann abc", DefaultPolicy()).masked(nil)
+	if result.Args[0] != "ann" || result.Args[1] != secretMask {
+		t.Fatalf("args = %q", result.Args)
+	}
+}
+
+func TestScriptMasksSecrets(t *testing.T) {
+	journal := testJournal(t)
+	var steps []PlanStep
+	err := RunWithOptions(context.Background(), "GoshSecretTestLogin ann script-secret-1", ScriptOptions{Journal: journal})
+	if err == nil || strings.Contains(err.Error(), "script-secret-1") || !strings.Contains(err.Error(), secretMask) {
+		t.Fatalf("err = %v", err)
+	}
+	if !errors.Is(err, errGoshSecretTestDenied) {
+		t.Fatalf("masked error does not unwrap: %v", err)
+	}
+	entries, _ := journal.Entries()
+	if len(entries) != 1 || strings.Contains(fmt.Sprintf("%+v", entries[0]), "script-secret-1") {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	err = RunWithOptions(context.Background(), "GoshSecretTestLogin ann ${TOKEN}", ScriptOptions{
+		Secrets: map[string]string{"TOKEN": "script-secret-2"},
+		DryRun:  true,
+		OnPlan:  func(step PlanStep) { steps = append(steps, step) },
+	})
+	if err != nil || len(steps) != 1 || steps[0].Args[1] != secretMask {
+		t.Fatalf("plan = %+v, %v", steps, err)
+	}
+
+	s := newScript(context.Background(), ScriptOptions{})
+	s.Secret("PASSWORD", "script-secret-3")
+	if s.env["PASSWORD"] != "script-secret-3" || s.secrets.mask("pw=script-secret-3") != "pw="+secretMask {
+		t.Fatalf("env = %q", s.env["PASSWORD"])
+	}
+	if nested := newScript(s.Context(), ScriptOptions{}); nested.secrets.mask("script-secret-3") != secretMask {
+		t.Fatal("a script started with the script's Context does not mask its secrets")
+	}
+}
+
+func TestScriptMasksSecretsOfLinesThatDoNotRun(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Rules = []PolicyRule{DenyRule("GoshSecretTestLogin", "**")}
+	err := RunWithOptions(context.Background(), "GoshSecretTestLogin ann rejected-secret-1", ScriptOptions{Policy: &policy})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || strings.Contains(fmt.Sprintf("%v %+v", err, *policyErr), "rejected-secret-1") {
+		t.Fatalf("rejected line leaks a secret: %v", err)
+	}
+
+	err = RunWithOptions(context.Background(), "GoshSecretTestLogin ann invalid-secret-1 extra", ScriptOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid arguments") || strings.Contains(err.Error(), "invalid-secret-1") {
+		t.Fatalf("invalid line = %v", err)
+	}
+
+	var steps []PlanStep
+	err = RunWithOptions(context.Background(), "GoshSecretTestLogin ann planned-secret-1", ScriptOptions{
+		DryRun: true,
+		OnPlan: func(step PlanStep) { steps = append(steps, step) },
+	})
+	if err != nil || len(steps) != 1 || strings.Contains(fmt.Sprintf("%+v", steps[0]), "planned-secret-1") {
+		t.Fatalf("plan = %+v, %v", steps, err)
+	}
+}
+
+func TestSecretsAreScopedToTheirScript(t *testing.T) {
+	// Classifying a line does not record its secret arguments anywhere.
+	result := ResolveWithPolicy("GoshSecretTestLogin ann resolve-secret-2", DefaultPolicy())
+	if result.Kind != RouteGoshCommand {
+		t.Fatalf("result = %+v", result)
+	}
+
+	first := newScript(context.Background(), ScriptOptions{})
+	first.Secret("TOKEN", "scoped-secret-1")
+	second := newScript(context.Background(), ScriptOptions{})
+	if second.secrets.mask("scoped-secret-1 resolve-secret-2") != "scoped-secret-1 resolve-secret-2" {
+		t.Fatal("secrets leak between scripts")
+	}
+
+	// A rejected MCP call's input is masked from its own arguments.
+	rejected := runCommandResult(runCommandOutput{Route: result, ExitCode: -1, Error: "rejected"}, true, nil)
+	if text := fmt.Sprint(rejected); strings.Contains(text, "resolve-secret-2") {
+		t.Fatalf("rejected run_command leaks a secret: %s", text)
+	}
+}
+
+func TestMCPMasksSecrets(t *testing.T) {
+	var events []MCPAuditEvent
+	options := MCPOptions{Audit: MCPAuditorFunc(func(event MCPAuditEvent) error {
+		events = append(events, event)
+		return nil
+	})}
+	result, rpcErr := callMCPToolWithOptions("GoshSecretTestLogin", map[string]interface{}{"user": "ann", "token": "mcp-secret-1"}, options)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if text := fmt.Sprint(result); strings.Contains(text, "mcp-secret-1") || !strings.Contains(text, secretMask) {
+		t.Fatalf("result = %s", text)
+	}
+	if len(events) != 1 || events[0].Arguments["token"] != redacted {
+		t.Fatalf("events = %+v", events)
+	}
+
+	events = nil
+	options.RunCommand = true
+	result, rpcErr = callRunCommand(map[string]interface{}{"command": "GoshSecretTestLogin ann mcp-secret-2"}, options)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if text := fmt.Sprint(result, events); strings.Contains(text, "mcp-secret-2") {
+		t.Fatalf("run_command leaks a secret: %s", text)
+	}
+}
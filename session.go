@@ -0,0 +1,287 @@
+package gosh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryDirEnv names the environment variable that turns on recording:
+// Menu records AI sessions and the journal of runs in the directory it
+// names. Recording is off when it is unset or `off`.
+const HistoryDirEnv = "GOSH_HISTORY_DIR"
+
+// maxSessionOutput bounds the stdout and stderr kept in a session.
+const maxSessionOutput = 1 << 20
+
+// AISession records one input handed to an AI backend: what was asked, how
+// the backend was configured, what it printed and how it ended.
+type AISession struct {
+	ID       string            `json:"id"`
+	Input    string            `json:"input"`
+	Route    RouteResult       `json:"route"`
+	Backend  string            `json:"backend"`
+	Config   map[string]string `json:"config,omitempty"`
+	Prompt   string            `json:"prompt,omitempty"`
+	Dir      string            `json:"dir,omitempty"`
+	Started  time.Time         `json:"started"`
+	Duration time.Duration     `json:"duration_ns"`
+	ExitCode int               `json:"exit_code"`
+	Error    string            `json:"error,omitempty"`
+	Stdout   string            `json:"stdout,omitempty"`
+	Stderr   string            `json:"stderr,omitempty"`
+
+	// Events holds the backend's structured event stream, such as the
+	// JSON events of `codex exec --json` or an OpenAI chat transcript.
+	Events []json.RawMessage `json:"events,omitempty"`
+}
+
+// SessionBackend is an AIBackend that records what it did. RouteWithOptions
+// calls RunSession instead of Run or RunRouted when a backend implements it.
+type SessionBackend interface {
+	AIBackend
+	RunSession(ctx context.Context, result RouteResult) (*AISession, error)
+}
+
+// newAISession starts a session for a routed input.
+func newAISession(backend string, result RouteResult) *AISession {
+	dir, _ := os.Getwd()
+	return &AISession{
+		ID:      newSessionID(time.Now()),
+		Input:   result.Input,
+		Route:   result,
+		Backend: backend,
+		Dir:     dir,
+		Started: time.Now(),
+	}
+}
+
+// finish records how a session ended and returns err.
+func (s *AISession) finish(err error) error {
+	s.Duration = time.Since(s.Started)
+	s.ExitCode = exitCode(err)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return err
+}
+
+// capture tees w into capped buffers for the session's stdout or stderr.
+func (s *AISession) capture(w io.Writer, field *string) (io.Writer, func()) {
+	buffer := &cappedBuffer{limit: maxSessionOutput}
+	return io.MultiWriter(w, buffer), func() { *field = buffer.String() }
+}
+
+// newSessionID returns a sortable ID: the start time and a random suffix.
+func newSessionID(now time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// exitCode returns the exit status a command error carries, 0 for nil and 1
+// for errors that are not exit statuses.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// cappedBuffer keeps the first limit bytes written to it.
+type cappedBuffer struct {
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - len(b.data)
+	if room < len(p) {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		b.data = append(b.data, p[:room]...)
+		return len(p), nil
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return string(b.data) + "\n[output truncated]\n"
+	}
+	return string(b.data)
+}
+
+// runAIBackend hands a routed input to backend and records the session,
+// passing it to options.OnSession and saving it in options.HistoryDir.
+// Backends that do not record sessions get one with the input, timing and
+// error.
+func runAIBackend(ctx context.Context, backend AIBackend, result RouteResult, options RouteOptions) error {
+	var session *AISession
+	var err error
+	switch b := backend.(type) {
+	case SessionBackend:
+		session, err = b.RunSession(ctx, result)
+	case RoutedBackend:
+		session = newAISession(fmt.Sprintf("%T", backend), result)
+		err = session.finish(b.RunRouted(ctx, result))
+	default:
+		session = newAISession(fmt.Sprintf("%T", backend), result)
+		err = session.finish(backend.Run(ctx, result.Input))
+	}
+	if session == nil {
+		return err
+	}
+	*session = session.masked(contextSecrets(ctx))
+	if options.OnSession != nil {
+		options.OnSession(*session)
+	}
+	if options.HistoryDir != "" {
+		if saveErr := SaveSession(options.HistoryDir, *session); saveErr != nil {
+			writef(defaultWriter(options.Stderr, os.Stderr), "gosh: recording AI session: %v\n", saveErr)
+		}
+	}
+	return err
+}
+
+// DefaultHistoryDir returns the directory in HistoryDirEnv. Recording is
+// opt-in, like the journal: it returns "" when HistoryDirEnv is unset or
+// `off`.
+func DefaultHistoryDir() string {
+	if value := os.Getenv(HistoryDirEnv); !strings.EqualFold(value, "off") {
+		return value
+	}
+	return ""
+}
+
+// SaveSession writes a session to dir as <id>.json.
+func SaveSession(dir string, session AISession) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(session.masked(nil), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, session.ID+".json"), append(data, '\n'), 0o600)
+}
+
+// Sessions returns the sessions saved in dir, newest first.
+func Sessions(dir string) ([]AISession, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []AISession
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		session, err := readSession(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+// LoadSession returns the session in dir whose ID is id or, if only one
+// matches, starts with id.
+func LoadSession(dir string, id string) (AISession, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return AISession{}, fmt.Errorf("invalid session id %q", id)
+	}
+	if session, err := readSession(filepath.Join(dir, id+".json")); err == nil {
+		return session, nil
+	}
+	sessions, err := Sessions(dir)
+	if err != nil {
+		return AISession{}, err
+	}
+	var found []AISession
+	for _, session := range sessions {
+		if strings.HasPrefix(session.ID, id) {
+			found = append(found, session)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return AISession{}, fmt.Errorf("no AI session %q in %s", id, dir)
+	case 1:
+		return found[0], nil
+	}
+	return AISession{}, fmt.Errorf("AI session id %q is ambiguous: %d sessions match", id, len(found))
+}
+
+func readSession(path string) (AISession, error) {
+	var session AISession
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return session, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, fmt.Errorf("%s: %w", path, err)
+	}
+	return session, nil
+}
+
+// writeSession prints a session for people.
+func writeSession(w io.Writer, session AISession) {
+	writef(w, "session:  %s\n", session.ID)
+	writef(w, "input:    %s\n", session.Input)
+	writef(w, "backend:  %s\n", session.Backend)
+	keys := make([]string, 0, len(session.Config))
+	for key := range session.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writef(w, "  %s: %s\n", key, session.Config[key])
+	}
+	writef(w, "dir:      %s\n", session.Dir)
+	writef(w, "started:  %s\n", session.Started.Local().Format(time.RFC3339))
+	writef(w, "duration: %s\n", session.Duration)
+	writef(w, "exit:     %d\n", session.ExitCode)
+	if session.Error != "" {
+		writef(w, "error:    %s\n", session.Error)
+	}
+	if len(session.Events) > 0 {
+		writef(w, "events:   %d\n", len(session.Events))
+	}
+	for _, part := range []struct{ name, text string }{{"prompt", session.Prompt}, {"stdout", session.Stdout}, {"stderr", session.Stderr}} {
+		if part.text != "" {
+			writef(w, "\n--- %s ---\n%s\n", part.name, strings.TrimRight(part.text, "\n"))
+		}
+	}
+}
+
+// sessionBackendName shortens Go type names such as gosh.CodexBackend.
+func sessionBackendName(name string) string {
+	name = strings.TrimPrefix(name[strings.LastIndex(name, ".")+1:], "*")
+	return strings.ToLower(strings.TrimSuffix(name, "Backend"))
+}
@@ -0,0 +1,155 @@
+package gosh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteRecordsCodexSession(t *testing.T) {
+	dir := t.TempDir()
+	fakeCodex := filepath.Join(dir, "codex")
+	script := "#!/bin/sh\n" +
+		"echo '{\"type\":\"thread.started\",\"thread_id\":\"t1\"}'\n" +
+		"echo '{\"type\":\"item.completed\",\"item\":{\"type\":\"agent_message\",\"text\":\"All done.\"}}'\n" +
+		"echo 'not json'\n" +
+		"echo warning >&2\n" +
+		"for arg in \"$@\"; do [ \"$arg\" = --json ] && exit 3; done\nexit 0\n"
+	if err := os.WriteFile(fakeCodex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	history := filepath.Join(dir, "history")
+	var stdout, stderr bytes.Buffer
+	var sessions []AISession
+	err := RouteWithOptions(context.Background(), "summarize the repository", RouteOptions{
+		Policy:     DefaultPolicy(),
+		Backend:    CodexBackend{Binary: fakeCodex, Dir: dir, Model: "m1", JSON: true, Stdout: &stdout, Stderr: &stderr},
+		OnSession:  func(session AISession) { sessions = append(sessions, session) },
+		HistoryDir: history,
+	})
+	if exitCode(err) != 3 {
+		t.Fatalf("RouteWithOptions = %v", err)
+	}
+	if stdout.String() != "All done.\nnot json\n" || stderr.String() != "warning\n" {
+		t.Fatalf("stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("sessions = %d", len(sessions))
+	}
+	session := sessions[0]
+	if session.Backend != "codex" || session.Input != "summarize the repository" || session.Route.Kind != RouteNeedsAI ||
+		session.Config["model"] != "m1" || session.Dir != dir || session.ExitCode != 3 || session.Error == "" ||
+		!strings.Contains(session.Prompt, "summarize the repository") || len(session.Events) != 2 ||
+		session.Stdout != stdout.String() || session.Stderr != "warning\n" || session.Duration <= 0 {
+		t.Fatalf("session = %+v", session)
+	}
+
+	saved, err := LoadSession(history, session.ID[:len(session.ID)-2])
+	if err != nil || saved.ID != session.ID || len(saved.Events) != 2 || saved.Stdout != session.Stdout {
+		t.Fatalf("LoadSession = %+v, %v", saved, err)
+	}
+}
+
+func TestRouteRecordsSessionsForOtherBackends(t *testing.T) {
+	var session AISession
+	err := RouteWithOptions(context.Background(), "do something clever", RouteOptions{
+		Policy:    DefaultPolicy(),
+		Backend:   failingBackend{err: errors.New("offline")},
+		OnSession: func(s AISession) { session = s },
+	})
+	if err == nil || session.Backend != "gosh.failingBackend" || session.Error != "offline" || session.ExitCode != 1 {
+		t.Fatalf("err=%v session=%+v", err, session)
+	}
+	if sessionBackendName(session.Backend) != "failing" {
+		t.Fatalf("backend name = %q", sessionBackendName(session.Backend))
+	}
+}
+
+func TestOpenAIBackendRecordsMessages(t *testing.T) {
+	server, _ := fakeChatServer(t, `{"role":"assistant","content":"Nothing to do."}`)
+	backend := OpenAIBackend{BaseURL: server.URL + "/v1", APIKey: "test-key", Model: "local", Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	session, err := backend.RunSession(context.Background(), RouteResult{Kind: RouteNeedsAI, Input: "anything?"})
+	if err != nil || len(session.Events) != 3 || session.Stdout != "Nothing to do.\n" || session.Config["model"] != "local" {
+		t.Fatalf("RunSession = %+v, %v", session, err)
+	}
+	if strings.Contains(string(session.Events[1]), "test-key") || !strings.Contains(string(session.Events[1]), "anything?") {
+		t.Fatalf("events = %s", session.Events)
+	}
+}
+
+func TestSessionsAndLoadSession(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, input := range []string{"first", "second"} {
+		session := AISession{ID: newSessionID(started.Add(time.Duration(i) * time.Hour)), Input: input, Backend: "codex", Started: started, Stdout: input + " output\n"}
+		if err := SaveSession(dir, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := Sessions(dir)
+	if err != nil || len(sessions) != 2 || sessions[0].Input != "second" {
+		t.Fatalf("Sessions = %+v, %v", sessions, err)
+	}
+	session, err := LoadSession(dir, "20240501-1200")
+	if err != nil || session.Input != "first" {
+		t.Fatalf("LoadSession = %+v, %v", session, err)
+	}
+	var out bytes.Buffer
+	writeSession(&out, session)
+	if !strings.Contains(out.String(), "input:    first") || !strings.Contains(out.String(), "--- stdout ---\nfirst output") {
+		t.Fatalf("writeSession = %q", out.String())
+	}
+
+	if _, err := LoadSession(dir, "2024"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("ambiguous id = %v", err)
+	}
+	if _, err := LoadSession(dir, "../x"); err == nil {
+		t.Fatal("path in session id accepted")
+	}
+	if sessions, err := Sessions(filepath.Join(dir, "missing")); err != nil || sessions != nil {
+		t.Fatalf("missing dir = %v, %v", sessions, err)
+	}
+
+	// Sessions are listed without a journal.
+	out.Reset()
+	if err := runHistory(&out, []string{"--sessions"}, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "codex") || !strings.HasSuffix(lines[0], "second") {
+		t.Fatalf("history --sessions = %q", out.String())
+	}
+	out.Reset()
+	if err := runHistory(&out, []string{"--sessions", "--json"}, t.TempDir(), nil); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Fatalf("history --sessions --json = %q, %v", out.String(), err)
+	}
+	if err := runHistory(&out, []string{"--sessions"}, "", nil); err == nil || !strings.Contains(err.Error(), HistoryDirEnv) {
+		t.Fatalf("history --sessions without a directory = %v", err)
+	}
+}
+
+func TestDefaultHistoryDirAndCappedOutput(t *testing.T) {
+	for _, value := range []string{"", "off"} {
+		t.Setenv(HistoryDirEnv, value)
+		if dir := DefaultHistoryDir(); dir != "" {
+			t.Fatalf("%q = %q", value, dir)
+		}
+	}
+	t.Setenv(HistoryDirEnv, "/tmp/gosh-history")
+	if dir := DefaultHistoryDir(); dir != "/tmp/gosh-history" {
+		t.Fatalf("env = %q", dir)
+	}
+
+	buffer := &cappedBuffer{limit: 4}
+	if n, err := buffer.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if buffer.String() != "abcd\n[output truncated]\n" {
+		t.Fatalf("capped = %q", buffer.String())
+	}
+}
@@ -0,0 +1,202 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions bounds RouteResult.Suggestions.
+const maxSuggestions = 3
+
+// commandSuggestion is a known command that resembles an unknown one.
+type commandSuggestion struct {
+	name     string
+	distance int
+	score    float64 // 0 to 1; 1 is an exact match
+}
+
+// suggestCommands returns registered gosh commands and executables on PATH
+// that resemble command, best first: names within a small edit distance, and
+// names command is a prefix of.
+func suggestCommands(command string) []commandSuggestion {
+	typed := strings.ToLower(filepath.Base(command))
+	if typed == "" || strings.ContainsAny(command, `/\`) {
+		return nil
+	}
+	best := map[string]commandSuggestion{}
+	consider := func(name string) {
+		lower := strings.ToLower(name)
+		if lower == typed {
+			return
+		}
+		if _, seen := best[lower]; seen {
+			return
+		}
+		if suggestion, ok := scoreSuggestion(typed, name); ok {
+			best[lower] = suggestion
+		}
+	}
+	for _, call := range Calls {
+		consider(call.Name)
+	}
+	for _, name := range pathExecutables() {
+		consider(name)
+	}
+
+	suggestions := make([]commandSuggestion, 0, len(best))
+	for _, suggestion := range best {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].score != suggestions[j].score {
+			return suggestions[i].score > suggestions[j].score
+		}
+		return strings.ToLower(suggestions[i].name) < strings.ToLower(suggestions[j].name)
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// scoreSuggestion reports whether name is close enough to the lower-cased
+// typed command to suggest, and how close. Short commands only match names
+// one edit away, so `ls` does not suggest every two-letter program.
+func scoreSuggestion(typed string, name string) (commandSuggestion, bool) {
+	lower := strings.ToLower(name)
+	distance := editDistance(typed, lower)
+	longest := len(typed)
+	if len(lower) > longest {
+		longest = len(lower)
+	}
+	suggestion := commandSuggestion{name: name, distance: distance, score: 1 - float64(distance)/float64(longest)}
+	maxDistance := 1
+	if len(typed) >= 5 {
+		maxDistance = 2
+	}
+	if distance <= maxDistance && distance < len(typed) {
+		return suggestion, true
+	}
+	if len(typed) >= 3 && strings.HasPrefix(lower, typed) {
+		suggestion.score = 0.5 * float64(len(typed)) / float64(len(lower))
+		return suggestion, true
+	}
+	return suggestion, false
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent bytes each
+// cost one.
+func editDistance(a string, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// pathExecutables lists the names of executables in PATH directories, with
+// Windows executable extensions removed.
+func pathExecutables() []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if name, ok := executableName(dir, entry); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func executableName(dir string, entry os.DirEntry) (string, bool) {
+	name := entry.Name()
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		for _, pathExt := range filepath.SplitList(strings.ToLower(os.Getenv("PATHEXT"))) {
+			if ext != "" && ext == pathExt {
+				return strings.TrimSuffix(name, filepath.Ext(name)), true
+			}
+		}
+		return "", false
+	}
+	info, err := os.Stat(filepath.Join(dir, name))
+	if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+		return "", false
+	}
+	return name, true
+}
+
+// suggestionNames returns the names of suggestions, for RouteResult.
+func suggestionNames(suggestions []commandSuggestion) []string {
+	if len(suggestions) == 0 {
+		return nil
+	}
+	names := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		names[i] = suggestion.name
+	}
+	return names
+}
+
+// autoCorrection returns the command a typo almost certainly meant: the only
+// suggestion one edit away from a command of at least four letters.
+func autoCorrection(command string, suggestions []commandSuggestion) (string, bool) {
+	if len(command) < 4 || len(suggestions) == 0 || suggestions[0].distance != 1 {
+		return "", false
+	}
+	if len(suggestions) > 1 && suggestions[1].distance == 1 {
+		return "", false
+	}
+	return suggestions[0].name, true
+}
+
+// didYouMean formats suggestions for error messages, or returns "".
+func didYouMean(suggestions []string) string {
+	switch len(suggestions) {
+	case 0:
+		return ""
+	case 1:
+		return "did you mean " + suggestions[0] + "?"
+	}
+	return "did you mean " + strings.Join(suggestions[:len(suggestions)-1], ", ") + " or " + suggestions[len(suggestions)-1] + "?"
+}
+
+// correctedInput replaces the first occurrence of the command in input with
+// its correction.
+func correctedInput(input string, command string, correction string) string {
+	return strings.Replace(input, command, correction, 1)
+}
@@ -0,0 +1,152 @@
+package gosh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var _ = Tool("GoshSuggestTestDeploy", func(env string) {})
+
+type failingBackend struct{ err error }
+
+func (b failingBackend) Run(context.Context, string) error { return b.err }
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"git", "git", 0},
+		{"gti", "git", 1},
+		{"gt", "git", 1},
+		{"gitt", "git", 1},
+		{"kubectl", "kubetcl", 1},
+		{"make", "cmake", 1},
+		{"deploy", "dpeloy", 1},
+		{"abc", "xyz", 3},
+	}
+	for _, tc := range cases {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Fatalf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// withPathExecutables replaces PATH for the test with a directory of small
+// scripts named names, plus one file that is not executable.
+func withPathExecutables(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho $0 \"$@\"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notexec"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+func TestResolveSuggestsCommands(t *testing.T) {
+	withPathExecutables(t, "gitk", "kubectl")
+
+	result := Resolve("goshsuggesttestdeploj staging")
+	if result.Kind != RouteNeedsAI || !reflect.DeepEqual(result.Suggestions, []string{"GoshSuggestTestDeploy"}) {
+		t.Fatalf("registered typo = %+v", result)
+	}
+	if result.Confidence >= 0.25 {
+		t.Fatalf("typo confidence = %v, want below 0.25", result.Confidence)
+	}
+
+	result = Resolve("kubetcl get pods")
+	if !reflect.DeepEqual(result.Suggestions, []string{"kubectl"}) {
+		t.Fatalf("PATH typo suggestions = %v", result.Suggestions)
+	}
+	result = Resolve("kube get pods")
+	if !reflect.DeepEqual(result.Suggestions, []string{"kubectl"}) {
+		t.Fatalf("prefix suggestions = %v", result.Suggestions)
+	}
+
+	result = Resolve("notexe")
+	if len(result.Suggestions) != 0 || result.Confidence != 0.25 {
+		t.Fatalf("non-executable files should not be suggested: %+v", result)
+	}
+	result = Resolve("qqqqqqqq")
+	if len(result.Suggestions) != 0 || result.Confidence != 0.25 {
+		t.Fatalf("unrelated command = %+v", result)
+	}
+}
+
+func TestAutoCorrectRoutesUnderPolicy(t *testing.T) {
+	dir := withPathExecutables(t, "kubectl", "gitk")
+
+	policy := DefaultPolicy()
+	if result := ResolveWithPolicy("kubetcl get pods", policy); result.Kind != RouteNeedsAI {
+		t.Fatalf("without AutoCorrect = %+v", result)
+	}
+
+	policy.AutoCorrect = true
+	result := ResolveWithPolicy("kubetcl get pods", policy)
+	if result.Kind != RouteExternalCLI || result.Command != "kubectl" || result.CorrectedFrom != "kubetcl" ||
+		result.Executable != filepath.Join(dir, "kubectl") || result.Input != "kubetcl get pods" ||
+		result.Confidence >= 1 || !strings.HasPrefix(result.Reason, "corrected kubetcl to kubectl") {
+		t.Fatalf("corrected = %+v", result)
+	}
+
+	// Two letters are too short to correct, and the corrected command is
+	// still subject to the policy.
+	if result := ResolveWithPolicy("gi status", policy); result.Kind != RouteNeedsAI {
+		t.Fatalf("short command corrected: %+v", result)
+	}
+	policy.DeniedExternal = []string{"kubectl"}
+	if result := ResolveWithPolicy("kubetcl get pods", policy); result.Kind != RouteRejected || result.CorrectedFrom != "kubetcl" {
+		t.Fatalf("corrected to a denied command: %+v", result)
+	}
+
+	backend := &recordingBackend{}
+	err := RouteWithOptions(context.Background(), "kubetcl get pods", RouteOptions{
+		Policy:  Policy{AllowExternal: true, AutoCorrect: true},
+		Backend: backend,
+	})
+	if err != nil || backend.called {
+		t.Fatalf("RouteWithOptions corrected = %v, backend called %v", err, backend.called)
+	}
+}
+
+func TestUnknownCommandErrorsSuggest(t *testing.T) {
+	withPathExecutables(t, "kubectl")
+
+	err := RunE("kubetcl get pods")
+	if err == nil || !strings.Contains(err.Error(), "did you mean kubectl?") {
+		t.Fatalf("script error = %v", err)
+	}
+
+	err = RouteWithOptions(context.Background(), "kubetcl get pods", RouteOptions{
+		Policy:  DefaultPolicy(),
+		Backend: failingBackend{err: os.ErrNotExist},
+	})
+	if err == nil || !strings.Contains(err.Error(), "kubetcl is not a known command; did you mean kubectl?") {
+		t.Fatalf("route error = %v", err)
+	}
+
+	diags := Check("kubetcl get pods")
+	if len(diags) != 1 || !strings.Contains(diags[0].Message, "did you mean kubectl?") {
+		t.Fatalf("check diagnostics = %v", diags)
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	if got := didYouMean(nil); got != "" {
+		t.Fatalf("no suggestions = %q", got)
+	}
+	if got := didYouMean([]string{"a", "b", "c"}); got != "did you mean a, b or c?" {
+		t.Fatalf("three suggestions = %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package gosh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSandboxUnsupported is returned when ScriptOptions.Sandbox is set but
+// the operating system cannot restrict child processes.
+var ErrSandboxUnsupported = errors.New("sandbox is not supported on this system")
+
+// WorkspaceError reports a builtin path that resolves outside the script's
+// workspace.
+type WorkspaceError struct {
+	Path      string
+	Resolved  string
+	Workspace string
+}
+
+func (e *WorkspaceError) Error() string {
+	return fmt.Sprintf("path %s resolves to %s, outside workspace %s", e.Path, e.Resolved, e.Workspace)
+}
+
+// resolvePath returns the absolute path a builtin argument refers to.
+// Relative paths are relative to the current directory. With a workspace,
+// paths that leave it once symlinks are followed are rejected with a
+// *WorkspaceError.
+func (s *Script) resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dirs[0], path)
+	}
+	path = filepath.Clean(path)
+	if s.options.Workspace == "" {
+		return path, nil
+	}
+	root, err := s.workspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	resolved, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(root, resolved) {
+		return "", &WorkspaceError{Path: path, Resolved: resolved, Workspace: root}
+	}
+	return path, nil
+}
+
+// builtinPath returns the path the cd, mkdir, rm and rmdir builtins act on.
+// Without a workspace it is joined to the current directory even when
+// absolute, as these builtins always have; with one, it is resolved and
+// confined by resolvePath.
+func (s *Script) builtinPath(path string) (string, error) {
+	if s.options.Workspace == "" {
+		return filepath.Join(s.dirs[0], path), nil
+	}
+	return s.resolvePath(path)
+}
+
+// workspaceRoot returns the workspace with symlinks resolved.
+func (s *Script) workspaceRoot() (string, error) {
+	root, err := filepath.Abs(s.options.Workspace)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("workspace: %w", err)
+	}
+	return root, nil
+}
+
+// evalExistingSymlinks resolves symlinks in the longest existing prefix of
+// path, so paths that are about to be created can be checked too.
+func evalExistingSymlinks(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
+
+func withinDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// startDir returns the directory a new script starts in: the process
+// working directory, or the workspace root when that is outside it.
+func startDir(options ScriptOptions) string {
+	workingDir, _ := os.Getwd()
+	if options.Workspace == "" {
+		return workingDir
+	}
+	root, err := filepath.Abs(options.Workspace)
+	if err != nil {
+		return workingDir
+	}
+	resolvedRoot, rootErr := filepath.EvalSymlinks(root)
+	resolvedDir, dirErr := filepath.EvalSymlinks(workingDir)
+	if rootErr == nil && dirErr == nil && withinDir(resolvedRoot, resolvedDir) {
+		return workingDir
+	}
+	return root
+}
+
+// sandboxPaths returns the paths sandboxed child processes may write.
+func (s *Script) sandboxPaths() ([]string, error) {
+	if s.options.Workspace == "" {
+		return nil, fmt.Errorf("sandbox requires a workspace")
+	}
+	root, err := s.workspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{root, os.DevNull}
+	return append(paths, s.options.Writable...), nil
+}
@@ -0,0 +1,111 @@
+package gosh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceConfinesBuiltins(t *testing.T) {
+	parent := t.TempDir()
+	workspace := filepath.Join(parent, "project")
+	outside := filepath.Join(parent, "outside")
+	for _, dir := range []string{filepath.Join(workspace, "src"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(workspace, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	script := testScript(filepath.Join(workspace, "src"))
+	script.options.Workspace = workspace
+
+	allowed := []func() error{
+		func() error { return script.mkDir("build/out") },
+		func() error { return script.cd("..") },
+		func() error { return script.pushd("src") },
+		func() error { return script.popd("") },
+		func() error { return script.rmDir(filepath.Join(workspace, "build")) },
+	}
+	for i, fn := range allowed {
+		if err := fn(); err != nil {
+			t.Fatalf("allowed %d: %v", i, err)
+		}
+	}
+	if script.dirs[0] != workspace {
+		t.Fatalf("dir = %s", script.dirs[0])
+	}
+
+	escapes := []func() error{
+		func() error { return script.rmDir("../outside") },
+		func() error { return script.rmDir("../../..") },
+		func() error { return script.cd("/") },
+		func() error { return script.pushd("escape") },
+		func() error { return script.mkDir("escape/new") },
+		func() error { return script.rm("escape/file") },
+		func() error { return script.source("../outside/script.gosh") },
+	}
+	for i, fn := range escapes {
+		var wsErr *WorkspaceError
+		if err := fn(); !errors.As(err, &wsErr) {
+			t.Errorf("escape %d: err = %v", i, err)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("outside dir removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Fatalf("outside dir created: %v", err)
+	}
+}
+
+func TestWorkspaceStartDirAndAbsoluteCd(t *testing.T) {
+	workspace := t.TempDir()
+	options := ScriptOptions{Workspace: workspace}
+	if got := startDir(options); got != workspace {
+		wd, _ := os.Getwd()
+		if got != wd {
+			t.Fatalf("startDir = %s", got)
+		}
+	}
+
+	target := filepath.Join(workspace, "sub")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := testScript(t.TempDir())
+	script.options = options
+	if err := script.cd(target); err != nil || script.dirs[0] != target {
+		t.Fatalf("absolute cd in workspace = %s, %v", script.dirs[0], err)
+	}
+
+	// Without a workspace, cd, mkdir, rm and rmdir join even absolute paths
+	// to the current directory, as they always have.
+	dir := t.TempDir()
+	script = testScript(dir)
+	if err := script.rmDir("/gosh-workspace-test"); err != nil || script.getwd() != dir {
+		t.Fatal(err)
+	}
+	if err := script.mkDir("/made"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "made")); err != nil {
+		t.Fatalf("absolute mkdir was not joined to the current directory: %v", err)
+	}
+	if err := script.cd("/made"); err != nil || script.getwd() != filepath.Join(dir, "made") {
+		t.Fatalf("absolute cd = %s, %v", script.getwd(), err)
+	}
+}
+
+func TestWorkspaceErrorsFromRun(t *testing.T) {
+	workspace := t.TempDir()
+	err := RunWithOptions(context.Background(), "cd "+workspace+"\nrmDir ..", ScriptOptions{Workspace: workspace})
+	var wsErr *WorkspaceError
+	if !errors.As(err, &wsErr) || wsErr.Workspace == "" {
+		t.Fatalf("err = %v", err)
+	}
+}
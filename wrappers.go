@@ -0,0 +1,296 @@
+package gosh
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxRiskDepth bounds how many wrappers are unwrapped when assessing risk.
+const maxRiskDepth = 8
+
+// riskAssessment is the highest risk found in a command line, with the
+// chain of reasons that led to it and the name of the risk rule that set it.
+type riskAssessment struct {
+	Level   RiskLevel
+	Reasons []string
+	Rule    string
+}
+
+func (a *riskAssessment) raise(level RiskLevel, reason string) {
+	a.raiseRule(level, reason, "")
+}
+
+func (a *riskAssessment) raiseRule(level RiskLevel, reason, rule string) {
+	if riskRank(level) > riskRank(a.Level) || a.Level == "" {
+		a.Level = level
+		a.Rule = rule
+	}
+	a.Reasons = append(a.Reasons, reason)
+}
+
+// describe appends the deciding risk rule to a routing reason.
+func (a riskAssessment) describe(reason string) string {
+	if a.Rule == "" {
+		return reason
+	}
+	return fmt.Sprintf("%s (risk rule %s)", reason, a.Rule)
+}
+
+// commandWrapper describes a program that runs another command, such as
+// sudo or timeout.
+type commandWrapper struct {
+	// floor is the minimum risk of running anything through the wrapper.
+	floor RiskLevel
+	// valueFlags take a separate value argument that must be skipped.
+	valueFlags []string
+	// positional is the number of non-flag arguments before the command.
+	positional int
+	// assignments skips leading NAME=value arguments, like env.
+	assignments bool
+	// bare is the risk of the wrapper without a command, such as `sudo -s`.
+	bare RiskLevel
+	// fallback is the command run when none is given, like xargs' echo.
+	fallback string
+	// what describes how the wrapper runs the command.
+	what string
+}
+
+var commandWrappers = map[string]commandWrapper{
+	"sudo":    {floor: RiskMedium, bare: RiskHigh, valueFlags: []string{"-u", "-g", "-h", "-p", "-c", "-r", "-t", "-C", "-D", "-U", "-T", "--user", "--group", "--host", "--prompt", "--role", "--type", "--close-from", "--chdir", "--other-user", "--command-timeout"}, what: "runs the command with elevated privileges"},
+	"doas":    {floor: RiskMedium, bare: RiskHigh, valueFlags: []string{"-u", "-C"}, what: "runs the command with elevated privileges"},
+	"env":     {valueFlags: []string{"-u", "-C", "-S", "--unset", "--chdir", "--split-string"}, assignments: true, what: "runs the command with a modified environment"},
+	"nice":    {valueFlags: []string{"-n", "--adjustment"}, what: "runs the command with a different priority"},
+	"ionice":  {valueFlags: []string{"-c", "-n", "-p", "-P", "-u", "--class", "--classdata"}, what: "runs the command with a different I/O priority"},
+	"nohup":   {what: "runs the command immune to hangups"},
+	"time":    {valueFlags: []string{"-f", "-o", "--format", "--output"}, what: "times the command"},
+	"command": {what: "runs the command"},
+	"exec":    {what: "runs the command"},
+	"stdbuf":  {valueFlags: []string{"-i", "-o", "-e", "--input", "--output", "--error"}, what: "runs the command with modified buffering"},
+	"chrt":    {positional: 1, what: "runs the command with a different scheduling policy"},
+	"taskset": {positional: 1, what: "runs the command on selected CPUs"},
+	"timeout": {valueFlags: []string{"-s", "-k", "--signal", "--kill-after"}, positional: 1, what: "runs the command with a time limit"},
+	"watch":   {valueFlags: []string{"-n", "-d", "--interval", "--differences"}, what: "runs the command repeatedly"},
+	"xargs":   {floor: RiskMedium, valueFlags: []string{"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter", "--max-args", "--max-procs", "--max-lines", "--max-chars", "--replace"}, fallback: "echo", what: "runs the command with arguments read from input"},
+}
+
+var shellInterpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "mksh": true, "fish": true, "ash": true,
+}
+
+// assessRisk estimates the risk of a command line. Wrappers like sudo, env,
+// xargs and timeout, and shell interpreters given `-c`, are unwrapped so the
+// wrapped command is assessed too; the highest risk found wins.
+func assessRisk(command string, args []string) riskAssessment {
+	var assessment riskAssessment
+	assessRiskInto(&assessment, command, args, 0)
+	if assessment.Level == "" {
+		assessment.Level = RiskLow
+	}
+	return assessment
+}
+
+func assessRiskInto(a *riskAssessment, command string, args []string, depth int) {
+	name := strings.ToLower(filepath.Base(command))
+	line := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	if depth >= maxRiskDepth {
+		a.raise(RiskHigh, fmt.Sprintf("%s: too many nested wrappers to assess", line))
+		return
+	}
+
+	if wrapper, ok := commandWrappers[name]; ok {
+		inner, innerArgs, found := unwrapCommand(wrapper, args)
+		if !found && wrapper.fallback != "" {
+			inner, innerArgs, found = wrapper.fallback, nil, true
+		}
+		if !found {
+			level := wrapper.bare
+			if level == "" {
+				level = wrapper.floor
+			}
+			if level == "" {
+				level = RiskLow
+			}
+			a.raise(level, fmt.Sprintf("%s: %s", line, level))
+			return
+		}
+		if wrapper.floor != "" {
+			a.raise(wrapper.floor, fmt.Sprintf("%s %s (at least %s)", name, wrapper.what, wrapper.floor))
+		} else {
+			a.Reasons = append(a.Reasons, fmt.Sprintf("%s %s", name, wrapper.what))
+		}
+		assessRiskInto(a, inner, innerArgs, depth+1)
+		return
+	}
+
+	if shellInterpreters[name] {
+		assessShell(a, name, line, args, depth)
+		return
+	}
+
+	level, rule := matchRiskRule(name, args)
+	if rule == nil {
+		a.raise(level, fmt.Sprintf("%s: %s", line, level))
+		return
+	}
+	reason := fmt.Sprintf("%s: %s by rule %s", line, level, rule.Name)
+	if rule.Reason != "" {
+		reason += ", " + rule.Reason
+	}
+	a.raiseRule(level, reason, rule.Name)
+}
+
+// unwrapCommand skips a wrapper's own options and returns the command it
+// runs.
+func unwrapCommand(wrapper commandWrapper, args []string) (string, []string, bool) {
+	positional := wrapper.positional
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if positional == 0 && i+1 < len(args) {
+				return args[i+1], args[i+2:], true
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			if !strings.Contains(arg, "=") && hasString(wrapper.valueFlags, arg) {
+				i++
+			}
+		case wrapper.assignments && strings.Contains(arg, "=") && !strings.HasPrefix(arg, "="):
+		case positional > 0:
+			positional--
+		default:
+			return arg, args[i+1:], true
+		}
+	}
+	return "", nil, false
+}
+
+// assessShell assesses `sh -c 'script'` by splitting the script into
+// commands on shell control operators and assessing each of them.
+func assessShell(a *riskAssessment, name, line string, args []string, depth int) {
+	script, found := shellScript(args)
+	if !found {
+		a.raise(RiskMedium, fmt.Sprintf("%s: shell interpreters can run arbitrary commands (at least %s)", line, RiskMedium))
+		return
+	}
+
+	a.raise(RiskMedium, fmt.Sprintf("%s -c runs a shell script (at least %s)", name, RiskMedium))
+	if strings.Contains(script, "$(") || strings.Contains(script, "`") {
+		a.raise(RiskHigh, fmt.Sprintf("%s -c script uses command substitution, which cannot be assessed", name))
+	}
+	for _, argv := range shellCommands(script) {
+		assessRiskInto(a, argv[0], argv[1:], depth+1)
+	}
+}
+
+// shellScript returns the script given to a shell with `-c`.
+func shellScript(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "-c" || (strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c")) {
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+	}
+	return "", false
+}
+
+// shellCommands splits a shell script into the argv of each command.
+func shellCommands(script string) [][]string {
+	var commands [][]string
+	for _, segment := range splitShellCommands(script) {
+		argv, err := SplitArgs(segment)
+		if err != nil {
+			argv = strings.Fields(segment)
+		}
+		if len(argv) > 0 {
+			commands = append(commands, argv)
+		}
+	}
+	return commands
+}
+
+// commandChain returns a command line followed by every command it wraps,
+// such as `git push` for `sudo env bash -c "git push"`.
+func commandChain(command string, args []string) [][]string {
+	var chain [][]string
+	var walk func(command string, args []string, depth int)
+	walk = func(command string, args []string, depth int) {
+		chain = append(chain, append([]string{command}, args...))
+		if depth >= maxRiskDepth {
+			return
+		}
+		name := strings.ToLower(filepath.Base(command))
+		if wrapper, ok := commandWrappers[name]; ok {
+			if inner, innerArgs, found := unwrapCommand(wrapper, args); found {
+				walk(inner, innerArgs, depth+1)
+			}
+			return
+		}
+		if !shellInterpreters[name] {
+			return
+		}
+		if script, found := shellScript(args); found {
+			for _, argv := range shellCommands(script) {
+				walk(argv[0], argv[1:], depth+1)
+			}
+		}
+	}
+	walk(command, args, 0)
+	return chain
+}
+
+// splitShellCommands splits shell text on ;, &, |, && and || and newlines
+// outside of quotes.
+func splitShellCommands(script string) []string {
+	var segments []string
+	var current strings.Builder
+	var quote rune
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\\' && quote != '\'' && i+1 < len(runes):
+			current.WriteRune(ch)
+			current.WriteRune(runes[i+1])
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+			current.WriteRune(ch)
+		case ch == '\'' || ch == '"':
+			quote = ch
+			current.WriteRune(ch)
+		case ch == ';' || ch == '&' || ch == '|' || ch == '\n' || ch == '(' || ch == ')':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	segments = append(segments, current.String())
+
+	out := segments[:0]
+	for _, segment := range segments {
+		segment = strings.TrimSpace(segment)
+		segment = strings.TrimPrefix(segment, "!")
+		if segment = strings.TrimSpace(segment); segment != "" {
+			out = append(out, segment)
+		}
+	}
+	return out
+}
+
+func hasString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
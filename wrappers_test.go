@@ -0,0 +1,80 @@
+package gosh
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestAssessRiskUnwrapsCommands(t *testing.T) {
+	cases := []struct {
+		input string
+		want  RiskLevel
+	}{
+		{"sudo rm -r /", RiskHigh},
+		{"sudo ls", RiskMedium},
+		{"sudo -u root -- ls", RiskMedium},
+		{"sudo -s", RiskHigh},
+		{"env FOO=1 -u BAR rm file", RiskHigh},
+		{"env", RiskLow},
+		{"xargs rm", RiskHigh},
+		{"xargs -n 1", RiskMedium},
+		{`bash -c "rm -r ."`, RiskHigh},
+		{`sh -c "echo hi && git push"`, RiskHigh},
+		{`sh -c "echo hi; ls"`, RiskMedium},
+		{`bash -c "echo $(cat secret)"`, RiskHigh},
+		{"bash script.sh", RiskMedium},
+		{"nice -n 5 git push", RiskHigh},
+		{"nice git status", RiskLow},
+		{"timeout 5 terraform apply", RiskHigh},
+		{"timeout -s KILL 5s terraform plan", RiskMedium},
+		{"nohup time stdbuf -oL sed -i s/a/b/ file", RiskHigh},
+		{"/usr/bin/sudo /bin/rm file", RiskHigh},
+	}
+	for _, c := range cases {
+		argv, err := SplitArgs(c.input)
+		if err != nil {
+			t.Fatalf("%s: %v", c.input, err)
+		}
+		got := assessRisk(argv[0], argv[1:])
+		if got.Level != c.want {
+			t.Errorf("%s: risk %s, want %s (%v)", c.input, got.Level, c.want, got.Reasons)
+		}
+		if len(got.Reasons) == 0 {
+			t.Errorf("%s: no reasons", c.input)
+		}
+	}
+}
+
+func TestAssessRiskReasonChain(t *testing.T) {
+	got := assessRisk("sudo", []string{"env", "X=1", "bash", "-c", "rm -r tmp"})
+	want := []string{"sudo", "env", "bash -c", "rm -r tmp: high"}
+	if len(got.Reasons) != len(want) {
+		t.Fatalf("reasons = %q", got.Reasons)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(got.Reasons[i], prefix) {
+			t.Fatalf("reason %d = %q, want prefix %q", i, got.Reasons[i], prefix)
+		}
+	}
+}
+
+func TestAssessRiskDepthLimit(t *testing.T) {
+	args := []string{}
+	for i := 0; i < maxRiskDepth+2; i++ {
+		args = append(args, "nohup")
+	}
+	if got := assessRisk("nohup", append(args, "ls")); got.Level != RiskHigh {
+		t.Fatalf("deep wrappers = %+v", got)
+	}
+}
+
+func TestRouteResultIncludesRiskReasons(t *testing.T) {
+	if _, err := exec.LookPath("env"); err != nil {
+		t.Skip("env is not on PATH")
+	}
+	result := ResolveWithPolicy("env rm file", DefaultPolicy())
+	if result.Risk != RiskHigh || len(result.RiskReasons) != 2 {
+		t.Fatalf("route = %+v", result)
+	}
+}
@@ -0,0 +1,324 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readConfigFile decodes a JSON or YAML file into v. Files ending in .json,
+// or starting with `{` or `[`, are read as JSON; anything else as YAML.
+func readConfigFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+	if err := unmarshalYAML(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// unmarshalYAML decodes the subset of YAML used by gosh config files into v,
+// using v's JSON field tags.
+//
+// The subset covers block mappings and sequences, flow sequences like
+// `[a, b]`, plain, single- and double-quoted scalars, and comments. Anchors,
+// multi-line scalars and flow mappings are not supported.
+func unmarshalYAML(data []byte, v interface{}) error {
+	value, err := parseYAML(string(data))
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(input string) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n") {
+		text := stripYAMLComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || strings.TrimSpace(trimmed) == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	value, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && !isYAMLSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case content == "":
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			value, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		case isYAMLSeqItem(content) || yamlKeyEnd(content) >= 0:
+			// `- key: value` starts a nested block at the content's column.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: line.indent + len(line.text) - len(content), text: content}
+			value, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		default:
+			value, err := yamlScalar(content, line.num)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			p.pos++
+		}
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	values := map[string]interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if isYAMLSeqItem(line.text) {
+			break
+		}
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: expected `key: value`", line.num)
+		}
+		key, err := yamlKey(line.text[:end], line.num)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := values[key]; found {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		rest := strings.TrimSpace(line.text[end+1:])
+		p.pos++
+		if rest != "" {
+			value, err := yamlScalar(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+			continue
+		}
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLSeqItem(next.text)) {
+				value, err := p.block(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				values[key] = value
+				continue
+			}
+		}
+		values[key] = nil
+	}
+	return values, nil
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// yamlKeyEnd returns the index of the colon ending a mapping key, or -1.
+func yamlKeyEnd(text string) int {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return -1
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case (ch == '"' || ch == '\'') && i == 0:
+			quote = ch
+		case ch == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlKey(text string, num int) (string, error) {
+	key, err := yamlScalar(strings.TrimSpace(text), num)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return "", nil
+	}
+	return fmt.Sprint(key), nil
+}
+
+func yamlScalar(text string, num int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", num, text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", num, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		return yamlFlowSequence(text, num)
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(text, "{"), strings.HasPrefix(text, "|"), strings.HasPrefix(text, ">"),
+		strings.HasPrefix(text, "&"), strings.HasPrefix(text, "*"):
+		return nil, fmt.Errorf("line %d: unsupported YAML syntax %s", num, text)
+	case text == "~" || text == "null":
+		return nil, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	}
+	if number, err := strconv.ParseFloat(text, 64); err == nil && strings.IndexFunc(text, isYAMLNumberRune) < 0 {
+		return number, nil
+	}
+	return text, nil
+}
+
+func isYAMLNumberRune(r rune) bool {
+	return !(r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+' || r == 'e' || r == 'E')
+}
+
+func yamlFlowSequence(text string, num int) (interface{}, error) {
+	if !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("line %d: unterminated flow sequence %s", num, text)
+	}
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	items := []interface{}{}
+	if inner == "" {
+		return items, nil
+	}
+	var quote byte
+	start := 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			ch := inner[i]
+			if quote != 0 {
+				if ch == quote {
+					quote = 0
+				}
+				continue
+			}
+			if ch == '"' || ch == '\'' {
+				quote = ch
+				continue
+			}
+			if ch == '[' || ch == '{' {
+				return nil, fmt.Errorf("line %d: nested flow collections are not supported", num)
+			}
+			if ch != ',' {
+				continue
+			}
+		}
+		item := strings.TrimSpace(inner[start:i])
+		value, err := yamlScalar(item, num)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		start = i + 1
+	}
+	return items, nil
+}
+
+// stripYAMLComment removes a `#` comment that starts a line or follows
+// whitespace outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '[' || line[i-1] == ',' || line[i-1] == ':' {
+				quote = ch
+			}
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
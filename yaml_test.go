@@ -0,0 +1,89 @@
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalYAML(t *testing.T) {
+	input := `# risk rules
+---
+rules:
+  - name: helm-install   # trailing comment
+    command: helm
+    subcommand: [install, "up grade"]
+    flags:
+      - --force
+      - '-i'
+    level: high
+    reason: "installs: a release"
+  -
+    command: 'it''s'
+    level: low
+count: 3
+enabled: true
+empty: []
+nothing:
+url: http://example.com/#anchor
+`
+	var got struct {
+		Rules   []RiskRule  `json:"rules"`
+		Count   int         `json:"count"`
+		Enabled bool        `json:"enabled"`
+		Empty   []string    `json:"empty"`
+		Nothing interface{} `json:"nothing"`
+		URL     string      `json:"url"`
+	}
+	if err := unmarshalYAML([]byte(input), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []RiskRule{
+		{Name: "helm-install", Command: "helm", Subcommand: []string{"install", "up grade"}, Flags: []string{"--force", "-i"}, Level: RiskHigh, Reason: "installs: a release"},
+		{Command: "it's", Level: RiskLow},
+	}
+	if !reflect.DeepEqual(got.Rules, want) {
+		t.Fatalf("rules = %+v", got.Rules)
+	}
+	if got.Count != 3 || !got.Enabled || got.Empty == nil || len(got.Empty) != 0 || got.Nothing != nil || got.URL != "http://example.com/#anchor" {
+		t.Fatalf("decoded = %+v", got)
+	}
+}
+
+func TestUnmarshalYAMLErrors(t *testing.T) {
+	for _, input := range []string{
+		"a: 1\n   b: 2\n",
+		"a: 1\na: 2\n",
+		"a: |\n  text\n",
+		"a: [b, [c]]\n",
+		"a: \"open\n",
+		"just text\n",
+		"a:\n\t- b\n",
+	} {
+		var value interface{}
+		if err := unmarshalYAML([]byte(input), &value); err == nil {
+			t.Errorf("%q: expected error, got %#v", input, value)
+		}
+	}
+}
+
+func TestReadConfigFileJSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "config.json")
+	yamlPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(jsonPath, []byte(`{"name": "json"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(yamlPath, []byte("name: yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{jsonPath: "json", yamlPath: "yaml"} {
+		var got struct {
+			Name string `json:"name"`
+		}
+		if err := readConfigFile(path, &got); err != nil || got.Name != want {
+			t.Fatalf("%s: %+v, %v", path, got, err)
+		}
+	}
+}